@@ -8,6 +8,11 @@ CREATE TABLE IF NOT EXISTS users (
     username TEXT NOT NULL UNIQUE,
     email TEXT NOT NULL UNIQUE,
     password BLOB NOT NULL, -- BLOB (от англ. Binary Large OBject) — это тип данных в базах данных, предназначенный для хранения больших объемов бинарной информации
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+    likes_public BOOLEAN NOT NULL DEFAULT 0, -- показывать лайкнутые посты на публичной странице
+    avatar_type TEXT NOT NULL DEFAULT '', -- MIME-тип загруженного аватара ('' - генерируемый идентикон)
+    avatar_version INTEGER NOT NULL DEFAULT 0, -- растёт при каждой смене аватара, входит в его адрес
+    reputation INTEGER NOT NULL DEFAULT 0, -- сумма likes.points по постам и комментариям пользователя
     created DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -29,21 +34,52 @@ CREATE TABLE IF NOT EXISTS posts (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     title TEXT NOT NULL,
     content TEXT NOT NULL,
+    content_html TEXT NOT NULL DEFAULT '', -- отрендеренный Markdown (кэш)
     user_id INTEGER NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1, -- увеличивается при каждой правке (оптимистичная блокировка)
+    published BOOLEAN NOT NULL DEFAULT 1, -- 0, пока пост ждёт публикации; такой пост видят только автор и модераторы
+    publish_at DATETIME, -- время отложенной публикации (пусто, если расписание отменено)
+    review TEXT, -- new, пока новый пост ждёт проверки модератором (такой пост не опубликован); edit, пока ждёт проверки правка из pending_edits
     created DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
 CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts(user_id);
+CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts(publish_at) WHERE published = 0;
 CREATE INDEX IF NOT EXISTS idx_posts_created ON posts(created);
+CREATE INDEX IF NOT EXISTS idx_posts_review ON posts(review) WHERE review IS NOT NULL;
+
+-- Посты, объединённые модератором с другим постом: старый адрес /post/{id}
+-- перенаправляет на пост, в который перенесено обсуждение
+CREATE TABLE IF NOT EXISTS post_redirects (
+    post_id INTEGER PRIMARY KEY,        -- удалённый пост
+    target_id INTEGER NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (target_id) REFERENCES posts(id) ON DELETE CASCADE
+);
 
 CREATE TABLE IF NOT EXISTS categories (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     name TEXT NOT NULL UNIQUE,
     slug TEXT NOT NULL UNIQUE,
     description TEXT,
-    created DATETIME DEFAULT CURRENT_TIMESTAMP
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    parent_id INTEGER,                 -- родительская категория, NULL у корневых
+    FOREIGN KEY (parent_id) REFERENCES categories(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);
+
+-- Права на действия в категории. Если у категории нет правил для действия,
+-- они наследуются от ближайшего предка с правилами; без правил во всей цепочке
+-- действие доступно всем. Администраторам доступно всё
+CREATE TABLE IF NOT EXISTS category_permissions (
+    category_id INTEGER NOT NULL,
+    action TEXT NOT NULL,              -- view, post или comment
+    role TEXT NOT NULL,                -- guest, user, moderator или admin
+    PRIMARY KEY (category_id, action, role),
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
 );
 
 -- Связь многие-ко-многим между постами и категориями
@@ -67,21 +103,52 @@ INSERT OR IGNORE INTO categories (name, slug, description) VALUES
     ('Teaware & Accessories', 'teaware', 'Teapots, gaiwans, cups, filters, and other tools'),
     ('Tea & Health', 'health', 'Health benefits, risks, and wellness tips related to tea');
 
+-- Подкатегории: slug уникален во всём дереве, поэтому адрес остаётся /category/{slug}
+INSERT OR IGNORE INTO categories (name, slug, description, parent_id) VALUES
+    ('Green Tea', 'green', 'Chinese and Japanese green teas', (SELECT id FROM categories WHERE slug = 'tea-types')),
+    ('Oolong', 'oolong', 'Lightly and heavily oxidized oolongs', (SELECT id FROM categories WHERE slug = 'tea-types')),
+    ('Pu-erh', 'pu-erh', 'Sheng, shou and aged pu-erh', (SELECT id FROM categories WHERE slug = 'tea-types'));
+
+INSERT OR IGNORE INTO categories (name, slug, description, parent_id) VALUES
+    ('Dancong', 'dancong', 'Phoenix single bush oolongs from Guangdong', (SELECT id FROM categories WHERE slug = 'oolong'));
+
+-- Служебные категории с ограниченным доступом
+INSERT OR IGNORE INTO categories (name, slug, description) VALUES
+    ('Announcements', 'announcements', 'Forum news from the moderators'),
+    ('Staff Lounge', 'staff', 'Private discussions of the forum staff'),
+    ('Archive', 'archive', 'Old discussions, read-only');
+
+INSERT OR IGNORE INTO category_permissions (category_id, action, role)
+    SELECT id, 'post', 'moderator' FROM categories WHERE slug = 'announcements';
+
+INSERT OR IGNORE INTO category_permissions (category_id, action, role)
+    SELECT c.id, a.action, 'moderator' FROM categories c, (SELECT 'view' AS action UNION SELECT 'post' UNION SELECT 'comment') a
+    WHERE c.slug = 'staff';
+
+INSERT OR IGNORE INTO category_permissions (category_id, action, role)
+    SELECT c.id, a.action, 'admin' FROM categories c, (SELECT 'post' AS action UNION SELECT 'comment') a
+    WHERE c.slug = 'archive';
+
 
 CREATE TABLE IF NOT EXISTS comments (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     content TEXT NOT NULL,
+    content_html TEXT NOT NULL DEFAULT '', -- отрендеренный Markdown (кэш)
     post_id INTEGER NOT NULL,
+    parent_id INTEGER, -- комментарий, на который это ответ
     user_id INTEGER NOT NULL,
+    review TEXT, -- new, пока комментарий ждёт проверки модератором; такой комментарий скрыт
     created DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE SET NULL,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
 CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
 CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(user_id);
 CREATE INDEX IF NOT EXISTS idx_comments_created ON comments(created);
+CREATE INDEX IF NOT EXISTS idx_comments_review ON comments(review) WHERE review IS NOT NULL;
 
 CREATE TABLE IF NOT EXISTS likes (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -89,6 +156,7 @@ CREATE TABLE IF NOT EXISTS likes (
     post_id INTEGER,
     comment_id INTEGER,
     is_dislike BOOLEAN NOT NULL DEFAULT false,
+    points INTEGER NOT NULL DEFAULT 0, -- очки репутации, начисленные автору с учётом дневного лимита
     created DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
@@ -103,4 +171,439 @@ CREATE TABLE IF NOT EXISTS likes (
 CREATE INDEX IF NOT EXISTS idx_likes_user_id ON likes(user_id);
 CREATE INDEX IF NOT EXISTS idx_likes_post_id ON likes(post_id);
 CREATE INDEX IF NOT EXISTS idx_likes_comment_id ON likes(comment_id);
-CREATE INDEX IF NOT EXISTS idx_likes_created ON likes(created);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_likes_created ON likes(created);
+
+-- История правок постов: каждая версия хранится целиком
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    editor_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post_id ON post_revisions(post_id);
+
+-- Набор категорий, который был у поста в момент правки
+CREATE TABLE IF NOT EXISTS post_revision_categories (
+    revision_id INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    PRIMARY KEY (revision_id, category_id),
+    FOREIGN KEY (revision_id) REFERENCES post_revisions(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- Правка опубликованного поста, которую фильтр отправил на проверку. До одобрения
+-- пост показывается в прежнем виде; у поста не больше одной такой правки.
+-- Новые теги и изменения изображений правки хранятся рядом и применяются вместе с ней
+CREATE TABLE IF NOT EXISTS pending_edits (
+    post_id INTEGER PRIMARY KEY,
+    editor_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pending_edit_categories (
+    post_id INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, category_id),
+    FOREIGN KEY (post_id) REFERENCES pending_edits(post_id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pending_edit_tags (
+    post_id INTEGER NOT NULL,
+    name TEXT NOT NULL, -- нормализованное имя; тег создаётся при одобрении правки
+    PRIMARY KEY (post_id, name),
+    FOREIGN KEY (post_id) REFERENCES pending_edits(post_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pending_edit_attachments (
+    post_id INTEGER NOT NULL,
+    attachment_id INTEGER NOT NULL,
+    removed BOOLEAN NOT NULL DEFAULT 0, -- 1 - правка отвязывает вложение поста, 0 - привязывает новую загрузку
+    PRIMARY KEY (post_id, attachment_id),
+    FOREIGN KEY (post_id) REFERENCES pending_edits(post_id) ON DELETE CASCADE,
+    FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+);
+
+-- История правок комментариев
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    comment_id INTEGER NOT NULL,
+    editor_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_revisions_comment_id ON comment_revisions(comment_id);
+
+-- Вложения (изображения). Файлы хранятся по sha256 содержимого;
+-- post_id пуст, пока загрузка не привязана к посту
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER,
+    user_id INTEGER NOT NULL,
+    hash TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    filename TEXT NOT NULL DEFAULT '',
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE SET NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments(post_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_hash ON attachments(hash);
+CREATE INDEX IF NOT EXISTS idx_attachments_created ON attachments(created);
+
+-- Варианты изображения (оригинал без метаданных, medium, thumbnail)
+CREATE TABLE IF NOT EXISTS attachment_variants (
+    attachment_id INTEGER NOT NULL,
+    variant TEXT NOT NULL CHECK (variant IN ('original', 'medium', 'thumbnail')),
+    hash TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    PRIMARY KEY (attachment_id, variant),
+    FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_variants_hash ON attachment_variants(hash);
+
+-- Пользовательские теги (в отличие от категорий, создаются автоматически)
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE, -- нормализованное имя: нижний регистр, без лишних пробелов
+    created DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, tag_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag_id ON post_tags(tag_id);
+
+-- Опросы, прикреплённые к постам (не больше одного на пост)
+CREATE TABLE IF NOT EXISTS polls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL UNIQUE,
+    question TEXT NOT NULL,
+    multiple BOOLEAN NOT NULL DEFAULT 0,
+    results_after_vote BOOLEAN NOT NULL DEFAULT 0,
+    closes_at DATETIME,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    poll_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE
+);
+
+-- Один голос пользователя на опрос; выбранные варианты хранятся отдельно
+CREATE TABLE IF NOT EXISTS poll_votes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    poll_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (poll_id, user_id),
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS poll_vote_options (
+    vote_id INTEGER NOT NULL,
+    option_id INTEGER NOT NULL,
+    PRIMARY KEY (vote_id, option_id),
+    FOREIGN KEY (vote_id) REFERENCES poll_votes(id) ON DELETE CASCADE,
+    FOREIGN KEY (option_id) REFERENCES poll_options(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_options_poll_id ON poll_options(poll_id);
+
+-- Упоминания @username. Запись остаётся и после удаления упоминания из текста,
+-- чтобы повторное упоминание при правке не создавало новое уведомление
+CREATE TABLE IF NOT EXISTS mentions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,      -- кого упомянули
+    author_id INTEGER NOT NULL,    -- кто упомянул
+    post_id INTEGER NOT NULL,
+    comment_id INTEGER,            -- NULL, если упоминание в самом посте
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_post ON mentions(user_id, post_id) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_comment ON mentions(user_id, comment_id) WHERE comment_id IS NOT NULL;
+
+-- Уведомления пользователей
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,      -- получатель
+    actor_id INTEGER NOT NULL,     -- кто вызвал уведомление
+    type TEXT NOT NULL,            -- comment, reply, reaction, mention, watched_post, watched_category, badge или moved
+    post_id INTEGER,
+    comment_id INTEGER,
+    badge TEXT NOT NULL DEFAULT '', -- код полученного значка для badge
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    read_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created);
+
+-- Типы уведомлений, отключённые пользователем
+CREATE TABLE IF NOT EXISTS notification_opt_outs (
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Подписки на посты. subscribed = 0 хранит явную отписку, чтобы новый
+-- комментарий пользователя не подписывал его снова
+CREATE TABLE IF NOT EXISTS post_subscriptions (
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    subscribed BOOLEAN NOT NULL DEFAULT 1,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_subscriptions_post_id ON post_subscriptions(post_id);
+
+-- Подписки на категории: уведомления о новых постах
+CREATE TABLE IF NOT EXISTS category_subscriptions (
+    user_id INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, category_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_category_subscriptions_category_id ON category_subscriptions(category_id);
+
+-- Папки закладок пользователя
+CREATE TABLE IF NOT EXISTS bookmark_folders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Сохранённые посты. folder_id пуст, если закладка не разложена по папкам
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    folder_id INTEGER,
+    note TEXT NOT NULL DEFAULT '', -- личная заметка, видна только владельцу
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (folder_id) REFERENCES bookmark_folders(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post_id ON bookmarks(post_id);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_folder_id ON bookmarks(folder_id);
+
+-- Черновики постов. post_id пуст для нового поста; для правки существующего
+-- поста у пользователя не больше одного черновика
+CREATE TABLE IF NOT EXISTS drafts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER,
+    title TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '', -- теги в том виде, как введены в форму
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_drafts_user_id ON drafts(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_drafts_user_post ON drafts(user_id, post_id) WHERE post_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS draft_categories (
+    draft_id INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    PRIMARY KEY (draft_id, category_id),
+    FOREIGN KEY (draft_id) REFERENCES drafts(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- Личные переписки: диалоги один на один и небольшие группы.
+-- Сообщения не попадают ни в поиск, ни в публичные ленты
+CREATE TABLE IF NOT EXISTS conversations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subject TEXT NOT NULL DEFAULT '',
+    created_by INTEGER NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated DATETIME DEFAULT CURRENT_TIMESTAMP, -- время последнего сообщения
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_created_by ON conversations(created_by, created);
+
+-- Участники переписки. Архив и удаление у каждого участника свои:
+-- удаление скрывает сообщения до hidden_before включительно
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0, -- последнее прочитанное сообщение
+    hidden_before INTEGER NOT NULL DEFAULT 0,
+    archived BOOLEAN NOT NULL DEFAULT 0,
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user_id ON conversation_members(user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    conversation_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id, id);
+
+-- Заблокированные отправители: blocked_id не может писать user_id
+CREATE TABLE IF NOT EXISTS user_blocks (
+    user_id INTEGER NOT NULL,
+    blocked_id INTEGER NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, blocked_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Подписки на пользователей: посты тех, на кого подписан пользователь,
+-- попадают в его ленту «Подписки»
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id INTEGER NOT NULL,
+    followee_id INTEGER NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (followee_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_followee_id ON follows(followee_id);
+
+-- Выданные значки. Автоматические выдаются по правилам из BadgeRules,
+-- ручные выдают и отзывают администраторы
+CREATE TABLE IF NOT EXISTS user_badges (
+    user_id INTEGER NOT NULL,
+    badge TEXT NOT NULL,     -- код значка
+    awarded_by INTEGER,      -- администратор, выдавший ручной значок
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, badge),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (awarded_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Группы пользователей («Дегустаторы», «Продавцы»). Участников добавляют
+-- администраторы и владелец группы, либо пользователь вступает по коду приглашения
+CREATE TABLE IF NOT EXISTS user_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    slug TEXT NOT NULL UNIQUE,       -- для ссылки /group/{slug} и упоминания @slug
+    description TEXT NOT NULL DEFAULT '',
+    owner_id INTEGER,
+    invite_code TEXT NOT NULL UNIQUE,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES user_groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members(user_id);
+
+-- Журнал изменений групп. Записи удалённых групп сохраняются,
+-- поэтому название группы хранится вместе с записью
+CREATE TABLE IF NOT EXISTS group_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    group_name TEXT NOT NULL,
+    actor_id INTEGER,                -- кто выполнил действие
+    action TEXT NOT NULL,            -- create, delete, add, remove, join, leave, invite или owner
+    user_id INTEGER,                 -- участник, которого коснулось действие
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_audit_group_id ON group_audit(group_id);
+
+-- Права групп на действия в категории. Дополняют category_permissions:
+-- действие разрешено, если подходит роль пользователя или одна из его групп
+CREATE TABLE IF NOT EXISTS category_group_permissions (
+    category_id INTEGER NOT NULL,
+    action TEXT NOT NULL,            -- view, post или comment
+    group_id INTEGER NOT NULL,
+    PRIMARY KEY (category_id, action, group_id),
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES user_groups(id) ON DELETE CASCADE
+);
+
+-- Журнал решений фильтра нового содержимого. Отклонённое содержимое не
+-- сохраняется, поэтому у таких записей нет поста и комментария
+CREATE TABLE IF NOT EXISTS content_checks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,              -- post, edit или comment
+    post_id INTEGER,
+    comment_id INTEGER,
+    user_id INTEGER NOT NULL,        -- автор проверенного текста
+    decision TEXT NOT NULL,          -- publish, hold или reject
+    score INTEGER NOT NULL DEFAULT 0,
+    reasons TEXT NOT NULL DEFAULT '', -- причины через "; "
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE SET NULL,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE SET NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_checks_created ON content_checks(created);
@@ -3,7 +3,16 @@ module forum
 go 1.24.2
 
 require (
+	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/yuin/goldmark v1.8.6
+	golang.org/x/crypto v0.39.0
+	golang.org/x/image v0.30.0
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/gofrs/uuid v4.4.0+incompatible // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
-	golang.org/x/crypto v0.39.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	golang.org/x/net v0.26.0 // indirect
 )
@@ -0,0 +1,580 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/imaging"
+	"forum/internal/models"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAttachmentNotFound     = errors.New("вложение не найдено")
+	ErrAttachmentTooLarge     = errors.New("файл превышает допустимый размер")
+	ErrAttachmentType         = errors.New("допускаются только изображения JPEG, PNG, GIF и WebP")
+	ErrAttachmentSaveFailed   = errors.New("ошибка сохранения файла")
+	ErrTooManyAttachments     = errors.New("слишком много вложений в одном посте")
+	ErrAttachmentCreateFailed = errors.New("ошибка создания вложения")
+)
+
+const (
+	// Максимальное количество вложений в посте
+	MaxPostAttachments = 10
+)
+
+// allowedImageTypes - типы, которые http.DetectContentType возвращает для разрешённых изображений
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type AttachmentService struct {
+	db      *Database
+	dir     string // Корневая директория для файлов
+	maxSize int64  // Максимальный размер одного файла в байтах
+}
+
+func NewAttachmentService(db *Database, dir string, maxSize int64) *AttachmentService {
+	return &AttachmentService{db: db, dir: dir, maxSize: maxSize}
+}
+
+// MaxSize возвращает максимальный размер одного файла
+func (as *AttachmentService) MaxSize() int64 {
+	return as.maxSize
+}
+
+// SaveUpload сохраняет загруженный файл и создаёт непривязанное вложение.
+// Тип файла определяется по содержимому, а не по расширению. На диск попадают
+// только перекодированные варианты, исходный файл с метаданными не сохраняется
+func (as *AttachmentService) SaveUpload(userID int, filename string, r io.Reader) (*models.Attachment, error) {
+	data, err := io.ReadAll(io.LimitReader(r, as.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAttachmentSaveFailed, err)
+	}
+	if int64(len(data)) > as.maxSize {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	variants, err := as.processImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := as.db.DBConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	original := variants[0]
+	attachment := models.Attachment{
+		UserID:   userID,
+		Hash:     original.Hash,
+		MimeType: original.MimeType,
+		Size:     original.Size,
+		Width:    original.Width,
+		Height:   original.Height,
+		Filename: filepath.Base(filename),
+		Variants: variants,
+	}
+
+	query := `INSERT INTO attachments (user_id, hash, mime_type, size, width, height, filename, created)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created`
+	err = tx.QueryRow(query, userID, attachment.Hash, attachment.MimeType, attachment.Size,
+		attachment.Width, attachment.Height, attachment.Filename, time.Now()).Scan(&attachment.ID, &attachment.Created)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAttachmentCreateFailed, err)
+	}
+
+	if err = insertVariants(tx, attachment.ID, variants); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return &attachment, nil
+}
+
+// BackfillVariants создаёт варианты для вложений, загруженных до их появления,
+// и заменяет исходные файлы перекодированными. Возвращает число обработанных вложений
+func (as *AttachmentService) BackfillVariants() (int, error) {
+	rows, err := as.db.DBConn.Query(`SELECT id, hash FROM attachments
+			  WHERE id NOT IN (SELECT attachment_id FROM attachment_variants)
+			  ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		id   int
+		hash string
+	}
+	var attachments []pending
+	for rows.Next() {
+		var a pending
+		if err := rows.Scan(&a.id, &a.hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		attachments = append(attachments, a)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, a := range attachments {
+		data, err := os.ReadFile(as.filePath(a.hash))
+		if err != nil {
+			return processed, fmt.Errorf("ошибка чтения вложения %d: %v", a.id, err)
+		}
+
+		variants, err := as.processImage(data)
+		if err != nil {
+			return processed, fmt.Errorf("ошибка обработки вложения %d: %v", a.id, err)
+		}
+
+		if err := as.replaceVariants(a.id, variants); err != nil {
+			return processed, err
+		}
+
+		// Исходный файл мог содержать EXIF - удаляем, если он больше не нужен
+		if err := as.removeUnreferencedFile(a.hash); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// processImage проверяет тип по содержимому, создаёт варианты и записывает их файлы.
+// Первым в списке всегда идёт оригинал
+func (as *AttachmentService) processImage(data []byte) ([]*models.AttachmentVariant, error) {
+	mimeType := http.DetectContentType(data)
+	if !allowedImageTypes[mimeType] {
+		return nil, ErrAttachmentType
+	}
+
+	processed, err := imaging.Process(data, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []*models.AttachmentVariant
+	for _, p := range processed {
+		sum := sha256.Sum256(p.Data)
+		variant := &models.AttachmentVariant{
+			Name:     p.Name,
+			Hash:     hex.EncodeToString(sum[:]),
+			MimeType: p.MimeType,
+			Width:    p.Width,
+			Height:   p.Height,
+			Size:     int64(len(p.Data)),
+		}
+		if err := as.writeFile(variant.Hash, p.Data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAttachmentSaveFailed, err)
+		}
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// replaceVariants обновляет вложение данными нового оригинала и его вариантами
+func (as *AttachmentService) replaceVariants(attachmentID int, variants []*models.AttachmentVariant) error {
+	tx, err := as.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	original := variants[0]
+	query := `UPDATE attachments SET hash = ?, mime_type = ?, size = ?, width = ?, height = ? WHERE id = ?`
+	_, err = tx.Exec(query, original.Hash, original.MimeType, original.Size, original.Width, original.Height, attachmentID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления вложения %d: %v", attachmentID, err)
+	}
+
+	if _, err = tx.Exec(`DELETE FROM attachment_variants WHERE attachment_id = ?`, attachmentID); err != nil {
+		return err
+	}
+
+	if err = insertVariants(tx, attachmentID, variants); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertVariants сохраняет варианты вложения в рамках транзакции
+func insertVariants(tx *sql.Tx, attachmentID int, variants []*models.AttachmentVariant) error {
+	query := `INSERT INTO attachment_variants (attachment_id, variant, hash, mime_type, width, height, size)
+			  VALUES (?, ?, ?, ?, ?, ?, ?)`
+	for _, v := range variants {
+		_, err := tx.Exec(query, attachmentID, v.Name, v.Hash, v.MimeType, v.Width, v.Height, v.Size)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения варианта %s: %v", v.Name, err)
+		}
+	}
+	return nil
+}
+
+// attachUploads привязывает к посту загрузки пользователя userID и новые загрузки
+// правки поста, ждущей проверки. Чужие и уже привязанные вложения пропускаются
+func attachUploads(tx *sql.Tx, postID, userID int, attachmentIDs []int) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM attachments WHERE post_id = ?`, postID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count+len(attachmentIDs) > MaxPostAttachments {
+		return ErrTooManyAttachments
+	}
+
+	for _, attachmentID := range attachmentIDs {
+		ok, err := canAttachUpload(tx, postID, userID, attachmentID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE attachments SET post_id = ? WHERE id = ?`, postID, attachmentID); err != nil {
+			return fmt.Errorf("ошибка привязки вложения %d: %v", attachmentID, err)
+		}
+	}
+
+	return nil
+}
+
+// canAttachUpload проверяет, что загрузку можно привязать к посту
+func canAttachUpload(db execer, postID, userID, attachmentID int) (bool, error) {
+	var ok bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM attachments
+							WHERE id = ? AND post_id IS NULL
+							  AND (user_id = ? OR id IN (SELECT attachment_id FROM pending_edit_attachments
+														 WHERE post_id = ? AND NOT removed)))`,
+		attachmentID, userID, postID).Scan(&ok)
+	return ok, err
+}
+
+// detachAttachments отвязывает вложения от поста; файлы удалит сборщик сирот
+func detachAttachments(tx *sql.Tx, postID int, attachmentIDs []int) error {
+	for _, attachmentID := range attachmentIDs {
+		_, err := tx.Exec(`UPDATE attachments SET post_id = NULL WHERE id = ? AND post_id = ?`, attachmentID, postID)
+		if err != nil {
+			return fmt.Errorf("ошибка отвязки вложения %d: %v", attachmentID, err)
+		}
+	}
+	return nil
+}
+
+// GetAttachments получает вложения по ID, например новые загрузки правки на проверке
+func (as *AttachmentService) GetAttachments(attachmentIDs []int) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	for _, attachmentID := range attachmentIDs {
+		row := as.db.DBConn.QueryRow(`SELECT id, post_id, user_id, hash, mime_type, size, width, height, filename, created
+									  FROM attachments WHERE id = ?`, attachmentID)
+		attachment, err := scanAttachment(row)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return nil, err
+		}
+
+		attachment.Variants, err = as.getVariants(attachment.ID)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+// GetPostAttachments получает вложения поста в порядке загрузки
+func (as *AttachmentService) GetPostAttachments(postID int) ([]*models.Attachment, error) {
+	query := `SELECT id, post_id, user_id, hash, mime_type, size, width, height, filename, created
+			  FROM attachments
+			  WHERE post_id = ?
+			  ORDER BY id`
+
+	rows, err := as.db.DBConn.Query(query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*models.Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		variants, err := as.getVariants(attachment.ID)
+		if err != nil {
+			return nil, err
+		}
+		attachment.Variants = variants
+	}
+
+	return attachments, nil
+}
+
+// getVariants получает варианты вложения, от меньшего к большему
+func (as *AttachmentService) getVariants(attachmentID int) ([]*models.AttachmentVariant, error) {
+	query := `SELECT variant, hash, mime_type, width, height, size
+			  FROM attachment_variants
+			  WHERE attachment_id = ?
+			  ORDER BY width`
+
+	rows, err := as.db.DBConn.Query(query, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []*models.AttachmentVariant
+	for rows.Next() {
+		var v models.AttachmentVariant
+		if err := rows.Scan(&v.Name, &v.Hash, &v.MimeType, &v.Width, &v.Height, &v.Size); err != nil {
+			return nil, err
+		}
+		variants = append(variants, &v)
+	}
+
+	return variants, rows.Err()
+}
+
+// GetFileInfo получает тип и дату загрузки файла по хешу: это может быть
+// вложение или любой из его вариантов
+func (as *AttachmentService) GetFileInfo(hash string) (string, time.Time, error) {
+	query := `SELECT v.mime_type, a.created
+			  FROM attachment_variants v
+			  JOIN attachments a ON v.attachment_id = a.id
+			  WHERE v.hash = ?
+			  UNION ALL
+			  SELECT mime_type, created FROM attachments WHERE hash = ?
+			  LIMIT 1`
+
+	var mimeType string
+	var created time.Time
+	err := as.db.DBConn.QueryRow(query, hash, hash).Scan(&mimeType, &created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", time.Time{}, ErrAttachmentNotFound
+		}
+		return "", time.Time{}, err
+	}
+
+	return mimeType, created, nil
+}
+
+// GetFileOwners получает посты, к которым привязан файл с этим хешем (как
+// вложение или его вариант), и авторов ещё не привязанных загрузок этого файла.
+// Одинаковые файлы хранятся один раз, поэтому владельцев может быть несколько
+func (as *AttachmentService) GetFileOwners(hash string) ([]int, []int, error) {
+	query := `SELECT a.post_id, a.user_id
+			  FROM attachments a
+			  WHERE a.hash = ?
+				 OR a.id IN (SELECT attachment_id FROM attachment_variants WHERE hash = ?)`
+
+	rows, err := as.db.DBConn.Query(query, hash, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var postIDs, uploaderIDs []int
+	for rows.Next() {
+		var postID sql.NullInt64
+		var userID int
+		if err := rows.Scan(&postID, &userID); err != nil {
+			return nil, nil, err
+		}
+		if postID.Valid {
+			postIDs = append(postIDs, int(postID.Int64))
+		} else {
+			uploaderIDs = append(uploaderIDs, userID)
+		}
+	}
+
+	return postIDs, uploaderIDs, rows.Err()
+}
+
+// Open открывает файл вложения для чтения
+func (as *AttachmentService) Open(hash string) (*os.File, error) {
+	return os.Open(as.filePath(hash))
+}
+
+// DeleteOrphans удаляет вложения, не привязанные к существующим постам дольше maxAge,
+// и файлы, на которые больше не ссылается ни одно вложение
+func (as *AttachmentService) DeleteOrphans(maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	// Новые загрузки правки на проверке ждут решения модератора
+	orphans := `SELECT id FROM attachments
+			  WHERE (post_id IS NULL OR post_id NOT IN (SELECT id FROM posts)) AND created < ?
+				AND id NOT IN (SELECT attachment_id FROM pending_edit_attachments WHERE NOT removed)`
+
+	rows, err := as.db.DBConn.Query(`SELECT hash FROM attachments WHERE id IN (`+orphans+`)
+			  UNION
+			  SELECT hash FROM attachment_variants WHERE attachment_id IN (`+orphans+`)`, cutoff, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := as.db.DBConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM attachment_variants WHERE attachment_id IN (`+orphans+`)`, cutoff); err != nil {
+		return 0, fmt.Errorf("ошибка удаления вариантов: %v", err)
+	}
+	result, err := tx.Exec(`DELETE FROM attachments WHERE id IN (`+orphans+`)`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления осиротевших вложений: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	// Один файл может использоваться несколькими вложениями
+	for _, hash := range hashes {
+		if err := as.removeUnreferencedFile(hash); err != nil {
+			return int(deleted), err
+		}
+	}
+
+	return int(deleted), nil
+}
+
+// removeUnreferencedFile удаляет файл, если на него не ссылается ни одно вложение или вариант
+func (as *AttachmentService) removeUnreferencedFile(hash string) error {
+	var exists int
+	err := as.db.DBConn.QueryRow(`SELECT 1 FROM attachments WHERE hash = ?
+			  UNION ALL
+			  SELECT 1 FROM attachment_variants WHERE hash = ?
+			  LIMIT 1`, hash, hash).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	if err := os.Remove(as.filePath(hash)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// filePath возвращает путь к файлу: <dir>/ab/abcdef...
+func (as *AttachmentService) filePath(hash string) string {
+	return filepath.Join(as.dir, hash[:2], hash)
+}
+
+// writeFile атомарно записывает файл, если его ещё нет
+func (as *AttachmentService) writeFile(hash string, data []byte) error {
+	path := as.filePath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, bytes.NewReader(data)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// IsAttachmentHash проверяет формат хеша из URL
+func IsAttachmentHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	return strings.Trim(hash, "0123456789abcdef") == ""
+}
+
+// rowScanner - общий интерфейс для *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAttachment читает вложение из строки результата
+func scanAttachment(row rowScanner) (*models.Attachment, error) {
+	var attachment models.Attachment
+	var postID sql.NullInt64
+
+	err := row.Scan(&attachment.ID, &postID, &attachment.UserID, &attachment.Hash,
+		&attachment.MimeType, &attachment.Size, &attachment.Width, &attachment.Height,
+		&attachment.Filename, &attachment.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	if postID.Valid {
+		attachment.PostID = int(postID.Int64)
+	}
+
+	return &attachment, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/imaging"
+	"forum/internal/models"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	ErrAvatarSize     = errors.New("недопустимый размер аватара")
+	ErrAvatarNotFound = errors.New("аватар не найден")
+	ErrNoAvatarFile   = errors.New("выберите изображение для аватара")
+)
+
+type AvatarService struct {
+	db      *Database
+	dir     string // Директория файлов аватаров
+	maxSize int64  // Максимальный размер загружаемого файла в байтах
+}
+
+func NewAvatarService(db *Database, dir string, maxSize int64) *AvatarService {
+	return &AvatarService{db: db, dir: dir, maxSize: maxSize}
+}
+
+// IsAvatarSize проверяет, что для размера создаются варианты аватара
+func IsAvatarSize(size int) bool {
+	for _, s := range imaging.AvatarSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveAvatar проверяет загруженное изображение, обрезает его до квадрата,
+// сохраняет варианты всех размеров и увеличивает версию аватара
+func (as *AvatarService) SaveAvatar(userID int, r io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(r, as.maxSize+1))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAttachmentSaveFailed, err)
+	}
+	if int64(len(data)) > as.maxSize {
+		return ErrAttachmentTooLarge
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !allowedImageTypes[mimeType] {
+		return ErrAttachmentType
+	}
+
+	variants, err := imaging.Avatar(data, mimeType)
+	if err != nil {
+		return err
+	}
+
+	version, err := as.GetAvatarVersion(userID)
+	if err != nil {
+		return err
+	}
+
+	// Файлы новой версии пишутся рядом со старыми, поэтому по старому
+	// адресу никогда не отдаётся новая картинка
+	for _, variant := range variants {
+		size, _ := strconv.Atoi(variant.Name)
+		if err := as.writeFile(as.filePath(userID, version+1, size), variant.Data); err != nil {
+			return fmt.Errorf("%w: %v", ErrAttachmentSaveFailed, err)
+		}
+	}
+
+	// Все варианты одного формата, поэтому тип хранится один на пользователя
+	_, err = as.db.DBConn.Exec(`UPDATE users SET avatar_type = ?, avatar_version = ? WHERE id = ?`,
+		variants[0].MimeType, version+1, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения аватара: %v", err)
+	}
+
+	return as.removeFiles(userID, version)
+}
+
+// DeleteAvatar удаляет загруженный аватар; пользователь снова получает идентикон
+func (as *AvatarService) DeleteAvatar(userID int) error {
+	version, err := as.GetAvatarVersion(userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = as.db.DBConn.Exec(`UPDATE users SET avatar_type = '', avatar_version = ? WHERE id = ?`,
+		version+1, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления аватара: %v", err)
+	}
+
+	return as.removeFiles(userID, version)
+}
+
+// GetAvatar получает аватар пользователя заданного размера. Если аватар
+// не загружен, возвращается идентикон, построенный по ID пользователя
+func (as *AvatarService) GetAvatar(userID, size int) (*models.Avatar, error) {
+	if !IsAvatarSize(size) {
+		return nil, ErrAvatarSize
+	}
+
+	avatar := models.Avatar{}
+	err := as.db.DBConn.QueryRow(`SELECT avatar_type, avatar_version FROM users WHERE id = ?`, userID).Scan(
+		&avatar.MimeType, &avatar.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAvatarNotFound
+		}
+		return nil, err
+	}
+
+	if avatar.MimeType != "" {
+		avatar.Data, err = os.ReadFile(as.filePath(userID, avatar.Version, size))
+		if err == nil {
+			return &avatar, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		// Файл потерян - показываем идентикон, а не битую картинку
+	}
+
+	avatar.MimeType = "image/png"
+	avatar.Data, err = imaging.Identicon(strconv.Itoa(userID), size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &avatar, nil
+}
+
+// GetAvatarVersion получает версию аватара пользователя
+func (as *AvatarService) GetAvatarVersion(userID int) (int, error) {
+	var version int
+	err := as.db.DBConn.QueryRow(`SELECT avatar_version FROM users WHERE id = ?`, userID).Scan(&version)
+	return version, err
+}
+
+// removeFiles удаляет файлы одной версии аватара
+func (as *AvatarService) removeFiles(userID, version int) error {
+	for _, size := range imaging.AvatarSizes {
+		if err := os.Remove(as.filePath(userID, version, size)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// filePath возвращает путь к файлу аватара: <dir>/<id>-<версия>-<размер>
+func (as *AvatarService) filePath(userID, version, size int) string {
+	return filepath.Join(as.dir, fmt.Sprintf("%d-%d-%d", userID, version, size))
+}
+
+// writeFile атомарно записывает файл аватара
+func (as *AvatarService) writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(as.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(as.dir, ".avatar-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"log"
+	"time"
+)
+
+var (
+	ErrUnknownBadge   = errors.New("неизвестный значок")
+	ErrBadgeNotManual = errors.New("этот значок выдаётся автоматически")
+)
+
+// BadgeRule описывает значок. Автоматический значок выдаётся, когда показатель
+// Metric - SQL-выражение от пользователя u - достигает Threshold. Значок без
+// Metric выдают и отзывают администраторы
+type BadgeRule struct {
+	Code        string
+	Name        string
+	Description string
+	Metric      string
+	Threshold   int
+}
+
+// BadgeRules - все значки в порядке отображения
+var BadgeRules = []*BadgeRule{
+	{
+		Code:        "first_post",
+		Name:        "Первый пост",
+		Description: "Опубликовал первый пост",
+		Metric:      `(SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.published = 1)`,
+		Threshold:   1,
+	},
+	{
+		Code:        "commentator",
+		Name:        "Собеседник",
+		Description: "Оставил 50 комментариев",
+		Metric:      `(SELECT COUNT(*) FROM comments c WHERE c.user_id = u.id AND c.review IS NULL)`,
+		Threshold:   50,
+	},
+	{
+		Code:        "likes_100",
+		Name:        "100 лайков",
+		Description: "Получил 100 лайков на посты и комментарии",
+		Metric: `(SELECT COUNT(*) FROM likes l JOIN posts p ON l.post_id = p.id
+				  WHERE p.user_id = u.id AND l.user_id != u.id AND NOT l.is_dislike)
+				 + (SELECT COUNT(*) FROM likes l JOIN comments c ON l.comment_id = c.id
+				  WHERE c.user_id = u.id AND l.user_id != u.id AND NOT l.is_dislike)`,
+		Threshold: 100,
+	},
+	{
+		Code:        "tea_reviewer",
+		Name:        "Чайный обозреватель",
+		Description: "Опубликовал 10 постов в категории обзоров",
+		Metric: `(SELECT COUNT(*) FROM posts p
+				  JOIN post_categories pc ON pc.post_id = p.id
+				  JOIN categories cat ON cat.id = pc.category_id
+				  WHERE p.user_id = u.id AND p.published = 1 AND cat.slug = 'reviews')`,
+		Threshold: 10,
+	},
+	{
+		Code:        "anniversary",
+		Name:        "Годовщина",
+		Description: "На форуме больше года",
+		Metric:      `CAST(julianday('now') - julianday(u.created) AS INTEGER)`,
+		Threshold:   365,
+	},
+	{
+		Code:        "tea_master",
+		Name:        "Чайный мастер",
+		Description: "Признанный знаток чая",
+	},
+	{
+		Code:        "helper",
+		Name:        "Помощник",
+		Description: "Помогает форуму и новичкам",
+	},
+}
+
+// Manual сообщает, выдаётся ли значок вручную
+func (b *BadgeRule) Manual() bool {
+	return b.Metric == ""
+}
+
+// findBadge ищет значок по коду
+func findBadge(code string) *BadgeRule {
+	for _, rule := range BadgeRules {
+		if rule.Code == code {
+			return rule
+		}
+	}
+	return nil
+}
+
+// BadgeName возвращает название значка, а для неизвестного - его код
+func BadgeName(code string) string {
+	if rule := findBadge(code); rule != nil {
+		return rule.Name
+	}
+	return code
+}
+
+// model возвращает значок без даты выдачи
+func (b *BadgeRule) model() *models.Badge {
+	return &models.Badge{Code: b.Code, Name: b.Name, Description: b.Description, Manual: b.Manual()}
+}
+
+type BadgeService struct {
+	db *Database
+}
+
+func NewBadgeService(db *Database) *BadgeService {
+	return &BadgeService{db: db}
+}
+
+// GetUserBadges получает значки пользователя в порядке BadgeRules.
+// Значки, правила которых удалены, не показываются
+func (bs *BadgeService) GetUserBadges(userID int) ([]*models.Badge, error) {
+	rows, err := bs.db.DBConn.Query(`SELECT badge, created FROM user_badges WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awarded := map[string]time.Time{}
+	for rows.Next() {
+		var code string
+		var created time.Time
+		if err := rows.Scan(&code, &created); err != nil {
+			return nil, err
+		}
+		awarded[code] = created
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var badges []*models.Badge
+	for _, rule := range BadgeRules {
+		created, ok := awarded[rule.Code]
+		if !ok {
+			continue
+		}
+		badge := rule.model()
+		badge.Awarded = created
+		badges = append(badges, badge)
+	}
+
+	return badges, nil
+}
+
+// ManualBadges возвращает значки, которые выдают администраторы
+func (bs *BadgeService) ManualBadges() []*models.Badge {
+	var badges []*models.Badge
+	for _, rule := range BadgeRules {
+		if rule.Manual() {
+			badges = append(badges, rule.model())
+		}
+	}
+	return badges
+}
+
+// AwardBadge выдаёт пользователю ручной значок от имени администратора adminID.
+// Повторная выдача ничего не меняет
+func (bs *BadgeService) AwardBadge(userID, adminID int, code string) error {
+	rule := findBadge(code)
+	if rule == nil {
+		return ErrUnknownBadge
+	}
+	if !rule.Manual() {
+		return ErrBadgeNotManual
+	}
+
+	query := `INSERT OR IGNORE INTO user_badges (user_id, badge, awarded_by, created) VALUES (?, ?, ?, ?)`
+	result, err := bs.db.DBConn.Exec(query, userID, code, adminID, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка выдачи значка: %v", err)
+	}
+
+	if inserted, _ := result.RowsAffected(); inserted > 0 {
+		bs.db.deliver([]*models.Notification{{
+			UserID:  userID,
+			ActorID: adminID,
+			Type:    models.NotificationBadge,
+			Badge:   code,
+		}})
+	}
+
+	return nil
+}
+
+// RevokeBadge отзывает у пользователя ручной значок
+func (bs *BadgeService) RevokeBadge(userID int, code string) error {
+	rule := findBadge(code)
+	if rule == nil {
+		return ErrUnknownBadge
+	}
+	if !rule.Manual() {
+		return ErrBadgeNotManual
+	}
+
+	if _, err := bs.db.DBConn.Exec(`DELETE FROM user_badges WHERE user_id = ? AND badge = ?`, userID, code); err != nil {
+		return fmt.Errorf("ошибка отзыва значка: %v", err)
+	}
+	return nil
+}
+
+// AwardBadges проверяет правила автоматических значков для всех пользователей
+// и возвращает количество выданных значков
+func (bs *BadgeService) AwardBadges() (int, error) {
+	return bs.db.awardBadges(0)
+}
+
+// checkBadges проверяет автоматические значки пользователя после его действия.
+// Ошибка не отменяет действие, поэтому только пишется в журнал
+func (d *Database) checkBadges(userID int) {
+	if userID == 0 {
+		return
+	}
+	if _, err := d.awardBadges(userID); err != nil {
+		log.Printf("Ошибка проверки значков пользователя %d: %v", userID, err)
+	}
+}
+
+// awardBadges выдаёт автоматические значки, условия которых выполнены,
+// пользователю userID или всем пользователям, если userID = 0.
+// Выданный значок не отзывается, даже если показатель потом снизится
+func (d *Database) awardBadges(userID int) (int, error) {
+	tx, err := d.DBConn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var notifications []*models.Notification
+
+	for _, rule := range BadgeRules {
+		if rule.Manual() {
+			continue
+		}
+
+		query := `SELECT u.id FROM users u
+				  WHERE (? = 0 OR u.id = ?)
+					AND NOT EXISTS (SELECT 1 FROM user_badges b WHERE b.user_id = u.id AND b.badge = ?)
+					AND ` + rule.Metric + ` >= ?`
+		userIDs, err := queryIDs(tx, query, userID, userID, rule.Code, rule.Threshold)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка проверки значка %s: %v", rule.Code, err)
+		}
+
+		for _, id := range userIDs {
+			_, err := tx.Exec(`INSERT INTO user_badges (user_id, badge, created) VALUES (?, ?, ?)`, id, rule.Code, now)
+			if err != nil {
+				return 0, fmt.Errorf("ошибка выдачи значка: %v", err)
+			}
+			notifications = append(notifications, &models.Notification{
+				UserID:  id,
+				ActorID: id,
+				Type:    models.NotificationBadge,
+				Badge:   rule.Code,
+			})
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	d.deliver(notifications)
+
+	return len(notifications), nil
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrBookmarkNotFound   = errors.New("закладка не найдена")
+	ErrFolderNotFound     = errors.New("папка не найдена")
+	ErrFolderExists       = errors.New("папка с таким названием уже существует")
+	ErrEmptyFolderName    = errors.New("название папки не может быть пустым")
+	ErrLongFolderName     = errors.New("название папки не должно превышать 50 символов")
+	ErrLongBookmarkNote   = errors.New("заметка не должна превышать 1000 символов")
+	ErrBookmarkSaveFailed = errors.New("ошибка сохранения закладки")
+)
+
+// Порядок сортировки закладок
+const (
+	BookmarkSortSaved = "saved" // по дате сохранения
+	BookmarkSortPost  = "post"  // по дате публикации поста
+)
+
+type BookmarkService struct {
+	db *Database
+}
+
+func NewBookmarkService(db *Database) *BookmarkService {
+	return &BookmarkService{db: db}
+}
+
+// ToggleBookmark сохраняет пост в закладки или убирает его оттуда.
+// Возвращает true, если пост теперь в закладках
+func (bs *BookmarkService) ToggleBookmark(userID, postID int) (bool, error) {
+	result, err := bs.db.DBConn.Exec(`DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?`, userID, postID)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrBookmarkSaveFailed, err)
+	}
+
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		return false, nil
+	}
+
+	_, err = bs.db.DBConn.Exec(`INSERT INTO bookmarks (user_id, post_id, created) VALUES (?, ?, ?)`,
+		userID, postID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrBookmarkSaveFailed, err)
+	}
+
+	return true, nil
+}
+
+// GetBookmark получает закладку пользователя на пост
+func (bs *BookmarkService) GetBookmark(userID, postID int) (*models.Bookmark, error) {
+	var bookmark models.Bookmark
+	var folderID sql.NullInt64
+
+	query := `SELECT id, user_id, post_id, folder_id, note, created FROM bookmarks WHERE user_id = ? AND post_id = ?`
+	err := bs.db.DBConn.QueryRow(query, userID, postID).Scan(&bookmark.ID, &bookmark.UserID,
+		&bookmark.PostID, &folderID, &bookmark.Note, &bookmark.Created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrBookmarkNotFound
+		}
+		return nil, err
+	}
+
+	if folderID.Valid {
+		id := int(folderID.Int64)
+		bookmark.FolderID = &id
+	}
+
+	return &bookmark, nil
+}
+
+// UpdateBookmark переносит закладку в папку (nil - вне папок) и меняет заметку
+func (bs *BookmarkService) UpdateBookmark(userID, postID int, folderID *int, note string) error {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > 1000 {
+		return ErrLongBookmarkNote
+	}
+
+	if folderID != nil {
+		if _, err := bs.GetFolder(userID, *folderID); err != nil {
+			return err
+		}
+	}
+
+	result, err := bs.db.DBConn.Exec(`UPDATE bookmarks SET folder_id = ?, note = ? WHERE user_id = ? AND post_id = ?`,
+		folderID, note, userID, postID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBookmarkSaveFailed, err)
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrBookmarkNotFound
+	}
+
+	return nil
+}
+
+// GetBookmarks получает закладки пользователя с постами. folderID = 0 - все закладки.
+// sort - BookmarkSortSaved или BookmarkSortPost, новые сначала. Посты из ставших
+// недоступными категорий не показываются
+func (bs *BookmarkService) GetBookmarks(userID, folderID int, sort string, limit, offset int) ([]*models.Bookmark, error) {
+	hidden, err := bs.db.hiddenPostsFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := "b.created DESC"
+	if sort == BookmarkSortPost {
+		order = "p.created DESC"
+	}
+
+	query := `SELECT b.id, b.user_id, b.post_id, b.folder_id, b.note, b.created,
+					 p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
+			  FROM bookmarks b
+			  JOIN posts p ON b.post_id = p.id
+			  JOIN users u ON p.user_id = u.id
+			  WHERE b.user_id = ? AND (? = 0 OR b.folder_id = ?) AND p.published = 1 AND ` + hidden + `
+			  ORDER BY ` + order + `, b.id DESC
+			  LIMIT ? OFFSET ?`
+
+	rows, err := bs.db.DBConn.Query(query, userID, folderID, folderID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookmarks []*models.Bookmark
+	for rows.Next() {
+		var bookmark models.Bookmark
+		var post models.Post
+		var bookmarkFolderID sql.NullInt64
+
+		err := rows.Scan(&bookmark.ID, &bookmark.UserID, &bookmark.PostID, &bookmarkFolderID,
+			&bookmark.Note, &bookmark.Created,
+			&post.ID, &post.Title, &post.Content, &post.UserID, &post.Created, &post.Updated, &post.Username)
+		if err != nil {
+			return nil, err
+		}
+
+		if bookmarkFolderID.Valid {
+			id := int(bookmarkFolderID.Int64)
+			bookmark.FolderID = &id
+		}
+		bookmark.Post = &post
+		bookmarks = append(bookmarks, &bookmark)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+// CountPostBookmarks возвращает, сколько пользователей сохранили пост
+func (bs *BookmarkService) CountPostBookmarks(postID int) (int, error) {
+	var count int
+	err := bs.db.DBConn.QueryRow(`SELECT COUNT(*) FROM bookmarks WHERE post_id = ?`, postID).Scan(&count)
+	return count, err
+}
+
+// CreateFolder создаёт папку закладок
+func (bs *BookmarkService) CreateFolder(userID int, name string) (*models.BookmarkFolder, error) {
+	name, err := bs.validateFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := models.BookmarkFolder{UserID: userID, Name: name}
+	query := `INSERT INTO bookmark_folders (user_id, name, created) VALUES (?, ?, ?) RETURNING id, created`
+	err = bs.db.DBConn.QueryRow(query, userID, name, time.Now()).Scan(&folder.ID, &folder.Created)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrFolderExists
+		}
+		return nil, fmt.Errorf("ошибка создания папки: %v", err)
+	}
+
+	return &folder, nil
+}
+
+// RenameFolder переименовывает папку пользователя
+func (bs *BookmarkService) RenameFolder(userID, folderID int, name string) error {
+	name, err := bs.validateFolderName(name)
+	if err != nil {
+		return err
+	}
+
+	result, err := bs.db.DBConn.Exec(`UPDATE bookmark_folders SET name = ? WHERE id = ? AND user_id = ?`,
+		name, folderID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrFolderExists
+		}
+		return fmt.Errorf("ошибка переименования папки: %v", err)
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrFolderNotFound
+	}
+
+	return nil
+}
+
+// DeleteFolder удаляет папку; её закладки остаются вне папок
+func (bs *BookmarkService) DeleteFolder(userID, folderID int) error {
+	tx, err := bs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM bookmark_folders WHERE id = ? AND user_id = ?`, folderID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления папки: %v", err)
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrFolderNotFound
+	}
+
+	// Внешние ключи в SQLite выключены, поэтому ON DELETE SET NULL не сработает сам
+	if _, err = tx.Exec(`UPDATE bookmarks SET folder_id = NULL WHERE folder_id = ?`, folderID); err != nil {
+		return fmt.Errorf("ошибка удаления папки: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// GetFolder получает папку пользователя с количеством закладок
+func (bs *BookmarkService) GetFolder(userID, folderID int) (*models.BookmarkFolder, error) {
+	var folder models.BookmarkFolder
+	query := `SELECT f.id, f.user_id, f.name, f.created,
+					 (SELECT COUNT(*) FROM bookmarks b JOIN posts p ON b.post_id = p.id WHERE b.folder_id = f.id)
+			  FROM bookmark_folders f
+			  WHERE f.id = ? AND f.user_id = ?`
+
+	err := bs.db.DBConn.QueryRow(query, folderID, userID).Scan(&folder.ID, &folder.UserID,
+		&folder.Name, &folder.Created, &folder.Count)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrFolderNotFound
+		}
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// GetFolders получает папки пользователя по алфавиту с количеством закладок
+func (bs *BookmarkService) GetFolders(userID int) ([]*models.BookmarkFolder, error) {
+	query := `SELECT f.id, f.user_id, f.name, f.created,
+					 (SELECT COUNT(*) FROM bookmarks b JOIN posts p ON b.post_id = p.id WHERE b.folder_id = f.id)
+			  FROM bookmark_folders f
+			  WHERE f.user_id = ?
+			  ORDER BY f.name`
+
+	rows, err := bs.db.DBConn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []*models.BookmarkFolder
+	for rows.Next() {
+		var folder models.BookmarkFolder
+		if err := rows.Scan(&folder.ID, &folder.UserID, &folder.Name, &folder.Created, &folder.Count); err != nil {
+			return nil, err
+		}
+		folders = append(folders, &folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// validateFolderName проверяет название папки и возвращает его без лишних пробелов
+func (bs *BookmarkService) validateFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrEmptyFolderName
+	}
+	if utf8.RuneCountInString(name) > 50 {
+		return "", ErrLongFolderName
+	}
+	return name, nil
+}
@@ -23,8 +23,13 @@ var (
 	ErrCategoryCreateFailed = errors.New("ошибка создания категории")
 	ErrCategoryUpdateFailed = errors.New("ошибка обновления категории")
 	ErrCategoryDeleteFailed = errors.New("ошибка удаления категории")
+	ErrParentNotFound       = errors.New("родительская категория не найдена")
+	ErrCategoryCycle        = errors.New("категорию нельзя вложить в саму себя или в её подкатегорию")
 )
 
+// categoryColumns - столбцы категории в порядке scanCategory
+const categoryColumns = `c.id, c.name, c.slug, c.description, c.created, c.parent_id`
+
 type CategoryService struct {
 	db *Database
 }
@@ -33,8 +38,9 @@ func NewCategoryService(db *Database) *CategoryService {
 	return &CategoryService{db: db}
 }
 
-// CreateCategory создает новую категорию
-func (cs *CategoryService) CreateCategory(name, slug, description string) (*models.Category, error) {
+// CreateCategory создает новую категорию; parentID nil - корневую.
+// Slug уникален во всём дереве, а не только среди соседей
+func (cs *CategoryService) CreateCategory(name, slug, description string, parentID *int) (*models.Category, error) {
 	if err := cs.validateCategoryData(name, slug, description); err != nil {
 		return nil, err
 	}
@@ -43,13 +49,17 @@ func (cs *CategoryService) CreateCategory(name, slug, description string) (*mode
 		return nil, err
 	}
 
-	query := `INSERT INTO categories (name, slug, description, created) 
-			  VALUES (?, ?, ?, ?) RETURNING id, created`
+	if err := cs.checkParent(0, parentID); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO categories (name, slug, description, parent_id, created) 
+			  VALUES (?, ?, ?, ?, ?) RETURNING id, created`
 
 	var category models.Category
 	now := time.Now()
 
-	err := cs.db.DBConn.QueryRow(query, name, slug, description, now).Scan(
+	err := cs.db.DBConn.QueryRow(query, name, slug, description, parentID, now).Scan(
 		&category.ID, &category.Created)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrCategoryCreateFailed, err)
@@ -58,19 +68,16 @@ func (cs *CategoryService) CreateCategory(name, slug, description string) (*mode
 	category.Name = name
 	category.Slug = slug
 	category.Description = description
+	category.ParentID = parentID
 
 	return &category, nil
 }
 
 // GetCategory получает категорию по ID
 func (cs *CategoryService) GetCategory(id int) (*models.Category, error) {
-	var category models.Category
-	query := `SELECT id, name, slug, description, created FROM categories WHERE id = ?`
-
-	err := cs.db.DBConn.QueryRow(query, id).Scan(
-		&category.ID, &category.Name, &category.Slug,
-		&category.Description, &category.Created)
+	query := `SELECT ` + categoryColumns + ` FROM categories c WHERE c.id = ?`
 
+	category, err := scanCategory(cs.db.DBConn.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrCategoryNotFound
@@ -78,18 +85,14 @@ func (cs *CategoryService) GetCategory(id int) (*models.Category, error) {
 		return nil, err
 	}
 
-	return &category, nil
+	return category, nil
 }
 
 // GetCategoryBySlug получает категорию по slug
 func (cs *CategoryService) GetCategoryBySlug(slug string) (*models.Category, error) {
-	var category models.Category
-	query := `SELECT id, name, slug, description, created FROM categories WHERE slug = ?`
-
-	err := cs.db.DBConn.QueryRow(query, slug).Scan(
-		&category.ID, &category.Name, &category.Slug,
-		&category.Description, &category.Created)
+	query := `SELECT ` + categoryColumns + ` FROM categories c WHERE c.slug = ?`
 
+	category, err := scanCategory(cs.db.DBConn.QueryRow(query, slug))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrCategoryNotFound
@@ -97,39 +100,95 @@ func (cs *CategoryService) GetCategoryBySlug(slug string) (*models.Category, err
 		return nil, err
 	}
 
-	return &category, nil
+	return category, nil
 }
 
-// GetAllCategories получает все категории
+// GetAllCategories получает все категории списком, без учёта вложенности
 func (cs *CategoryService) GetAllCategories() ([]*models.Category, error) {
-	query := `SELECT id, name, slug, description, created FROM categories ORDER BY name`
+	return cs.queryCategories(`SELECT ` + categoryColumns + ` FROM categories c ORDER BY c.name`)
+}
 
-	rows, err := cs.db.DBConn.Query(query)
+// GetCategoryTree получает доступные пользователю viewerID (0 - гость) корневые
+// категории с заполненными Children. Соседние категории упорядочены по названию
+func (cs *CategoryService) GetCategoryTree(viewerID int) ([]*models.Category, error) {
+	categories, err := cs.GetAllCategories()
+	if err != nil {
+		return nil, err
+	}
+	categories, err = cs.FilterCategories(viewerID, categories, models.CategoryView)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var categories []*models.Category
-	for rows.Next() {
-		var category models.Category
-		err := rows.Scan(&category.ID, &category.Name, &category.Slug,
-			&category.Description, &category.Created)
-		if err != nil {
-			return nil, err
+	byID := map[int]*models.Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	var roots []*models.Category
+	for _, category := range categories {
+		// Категория со скрытым или потерянным родителем показывается среди корневых
+		var parent *models.Category
+		if category.ParentID != nil {
+			parent = byID[*category.ParentID]
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, category)
+		} else {
+			roots = append(roots, category)
 		}
-		categories = append(categories, &category)
 	}
 
-	if err = rows.Err(); err != nil {
+	return roots, nil
+}
+
+// GetSubcategories получает прямые подкатегории, доступные пользователю viewerID (0 - гость)
+func (cs *CategoryService) GetSubcategories(parentID, viewerID int) ([]*models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories c WHERE c.parent_id = ? ORDER BY c.name`
+	categories, err := cs.queryCategories(query, parentID)
+	if err != nil {
 		return nil, err
 	}
+	return cs.FilterCategories(viewerID, categories, models.CategoryView)
+}
 
-	return categories, nil
+// LoadAncestors заполняет Ancestors категорий - путь от корня дерева
+// до родителя - для хлебных крошек
+func (cs *CategoryService) LoadAncestors(categories []*models.Category) error {
+	if len(categories) == 0 {
+		return nil
+	}
+
+	all, err := cs.GetAllCategories()
+	if err != nil {
+		return err
+	}
+
+	byID := map[int]*models.Category{}
+	for _, category := range all {
+		byID[category.ID] = category
+	}
+
+	for _, category := range categories {
+		category.Ancestors = nil
+		seen := map[int]bool{category.ID: true}
+		for parentID := category.ParentID; parentID != nil && !seen[*parentID]; {
+			parent, ok := byID[*parentID]
+			if !ok {
+				break
+			}
+			seen[parent.ID] = true
+			category.Ancestors = append([]*models.Category{parent}, category.Ancestors...)
+			parentID = parent.ParentID
+		}
+	}
+
+	return nil
 }
 
-// UpdateCategory обновляет категорию
-func (cs *CategoryService) UpdateCategory(id int, name, slug, description string) error {
+// UpdateCategory обновляет категорию и переносит её к родителю parentID
+// (nil - в корень). Категорию нельзя вложить в её собственное поддерево
+func (cs *CategoryService) UpdateCategory(id int, name, slug, description string, parentID *int) error {
 	if err := cs.validateCategoryData(name, slug, description); err != nil {
 		return err
 	}
@@ -139,8 +198,12 @@ func (cs *CategoryService) UpdateCategory(id int, name, slug, description string
 		return err
 	}
 
-	query := `UPDATE categories SET name = ?, slug = ?, description = ? WHERE id = ?`
-	result, err := cs.db.DBConn.Exec(query, name, slug, description, id)
+	if err := cs.checkParent(id, parentID); err != nil {
+		return err
+	}
+
+	query := `UPDATE categories SET name = ?, slug = ?, description = ?, parent_id = ? WHERE id = ?`
+	result, err := cs.db.DBConn.Exec(query, name, slug, description, parentID, id)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrCategoryUpdateFailed, err)
 	}
@@ -157,10 +220,20 @@ func (cs *CategoryService) UpdateCategory(id int, name, slug, description string
 	return nil
 }
 
-// DeleteCategory удаляет категорию
+// DeleteCategory удаляет категорию; её подкатегории переходят к её родителю
 func (cs *CategoryService) DeleteCategory(id int) error {
-	query := `DELETE FROM categories WHERE id = ?`
-	result, err := cs.db.DBConn.Exec(query, id)
+	tx, err := cs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCategoryDeleteFailed, err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE categories SET parent_id = (SELECT parent_id FROM categories WHERE id = ?) WHERE parent_id = ?`
+	if _, err := tx.Exec(query, id, id); err != nil {
+		return fmt.Errorf("%w: %v", ErrCategoryDeleteFailed, err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM categories WHERE id = ?`, id)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrCategoryDeleteFailed, err)
 	}
@@ -174,6 +247,10 @@ func (cs *CategoryService) DeleteCategory(id int) error {
 		return ErrCategoryNotFound
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCategoryDeleteFailed, err)
+	}
+
 	return nil
 }
 
@@ -191,70 +268,142 @@ func (cs *CategoryService) RemovePostFromCategory(postID, categoryID int) error
 	return err
 }
 
-// GetPostCategories получает все категории поста
-func (cs *CategoryService) GetPostCategories(postID int) ([]*models.Category, error) {
-	query := `SELECT c.id, c.name, c.slug, c.description, c.created 
+// GetPostCategories получает категории поста, которые может просматривать
+// пользователь viewerID (0 - гость)
+func (cs *CategoryService) GetPostCategories(postID, viewerID int) ([]*models.Category, error) {
+	categories, err := cs.getPostCategories(postID)
+	if err != nil {
+		return nil, err
+	}
+	return cs.FilterCategories(viewerID, categories, models.CategoryView)
+}
+
+// getPostCategories получает все категории поста без проверки прав
+func (cs *CategoryService) getPostCategories(postID int) ([]*models.Category, error) {
+	query := `SELECT ` + categoryColumns + `
 			  FROM categories c
 			  JOIN post_categories pc ON c.id = pc.category_id
 			  WHERE pc.post_id = ?
 			  ORDER BY c.name`
 
-	rows, err := cs.db.DBConn.Query(query, postID)
+	return cs.queryCategories(query, postID)
+}
+
+// categoryDescendants - рекурсивный запрос, дающий ID категории и всех её
+// подкатегорий. UNION вместо UNION ALL не даёт зациклиться на испорченных данных
+const categoryDescendants = `WITH RECURSIVE descendants(id) AS (
+				SELECT ?
+				UNION
+				SELECT c.id FROM categories c JOIN descendants d ON c.parent_id = d.id
+			  )`
+
+// GetCategoryPosts получает страницу постов категории, доступных пользователю
+// viewerID (0 - гость), новые сначала; при withDescendants также посты всех её
+// подкатегорий, каждый пост один раз. before - курсор, как в GetAllPosts
+func (cs *CategoryService) GetCategoryPosts(categoryID, viewerID int, withDescendants bool, before *FeedCursor, limit int) ([]*models.Post, error) {
+	hidden, err := cs.db.hiddenPostsFilter(viewerID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var categories []*models.Category
-	for rows.Next() {
-		var category models.Category
-		err := rows.Scan(&category.ID, &category.Name, &category.Slug,
-			&category.Description, &category.Created)
-		if err != nil {
-			return nil, err
-		}
-		categories = append(categories, &category)
+	categoryFilter := `pc.category_id = ?`
+	if withDescendants {
+		categoryFilter = `pc.category_id IN (SELECT id FROM descendants)`
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	query := categoryDescendants + `
+			  SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
+			  FROM posts p
+			  JOIN users u ON p.user_id = u.id
+			  WHERE p.published = 1 AND ` + hidden + ` AND ` + feedCursorCondition + `
+				AND EXISTS (SELECT 1 FROM post_categories pc WHERE pc.post_id = p.id AND ` + categoryFilter + `)
+			  ORDER BY p.created DESC, p.id DESC
+			  LIMIT ?`
+
+	args := append([]interface{}{categoryID}, before.args()...)
+	if !withDescendants {
+		args = append(args, categoryID)
 	}
 
-	return categories, nil
+	return NewPostService(cs.db).queryFeed(query, args, limit)
 }
 
-// GetCategoryPosts получает все посты категории с пагинацией
-func (cs *CategoryService) GetCategoryPosts(categoryID int, limit, offset int) ([]*models.Post, error) {
-	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
-			  FROM posts p
-			  JOIN users u ON p.user_id = u.id
-			  JOIN post_categories pc ON p.id = pc.post_id
-			  WHERE pc.category_id = ?
-			  ORDER BY p.created DESC
-			  LIMIT ? OFFSET ?`
+// checkParent проверяет, что родитель существует и что категория id не
+// окажется внутри своего поддерева. Для новой категории id = 0
+func (cs *CategoryService) checkParent(id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID == id {
+		return ErrCategoryCycle
+	}
 
-	rows, err := cs.db.DBConn.Query(query, categoryID, limit, offset)
+	var exists bool
+	err := cs.db.DBConn.QueryRow(`SELECT EXISTS(SELECT 1 FROM categories WHERE id = ?)`, *parentID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrParentNotFound
+	}
+
+	if id == 0 {
+		return nil
+	}
+
+	var cycle bool
+	query := categoryDescendants + ` SELECT EXISTS(SELECT 1 FROM descendants WHERE id = ?)`
+	if err := cs.db.DBConn.QueryRow(query, id, *parentID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCategoryCycle
+	}
+
+	return nil
+}
+
+// queryCategories выполняет запрос, выбирающий categoryColumns
+func (cs *CategoryService) queryCategories(query string, args ...interface{}) ([]*models.Category, error) {
+	rows, err := cs.db.DBConn.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []*models.Post
+	var categories []*models.Category
 	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID,
-			&post.Created, &post.Updated, &post.Username)
+		category, err := scanCategory(rows)
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, &post)
+		categories = append(categories, category)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return posts, nil
+	return categories, nil
+}
+
+// scanCategory читает категорию из строки с categoryColumns
+func scanCategory(row rowScanner) (*models.Category, error) {
+	var category models.Category
+	var parentID sql.NullInt64
+
+	err := row.Scan(&category.ID, &category.Name, &category.Slug,
+		&category.Description, &category.Created, &parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		category.ParentID = &id
+	}
+
+	return &category, nil
 }
 
 // checkCategoryUniqueness проверяет уникальность name и slug
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"forum/internal/markdown"
 	"forum/internal/models"
 	"strings"
 	"time"
@@ -17,6 +18,7 @@ var (
 	ErrCommentUpdateFailed = errors.New("ошибка обновления комментария")
 	ErrCommentDeleteFailed = errors.New("ошибка удаления комментария")
 	ErrNotCommentAuthor    = errors.New("только автор может изменять комментарий")
+	ErrNotCommentEditor    = errors.New("только автор или модератор может изменять комментарий")
 )
 
 type CommentService struct {
@@ -29,41 +31,137 @@ func NewCommentService(db *Database) *CommentService {
 
 // CreateComment создает новый комментарий
 func (cs *CommentService) CreateComment(content string, postID, userID int) (*models.Comment, error) {
+	return cs.createComment(content, postID, nil, userID)
+}
+
+// CreateReply создает ответ на комментарий в том же посте
+func (cs *CommentService) CreateReply(content string, parentID, userID int) (*models.Comment, error) {
+	var postID int
+	err := cs.db.DBConn.QueryRow(`SELECT post_id FROM comments WHERE id = ?`, parentID).Scan(&postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	return cs.createComment(content, postID, &parentID, userID)
+}
+
+// createComment создает комментарий или ответ (parentID не nil) и уведомляет
+// автора поста и автора родительского комментария
+func (cs *CommentService) createComment(content string, postID int, parentID *int, userID int) (*models.Comment, error) {
 	if err := cs.validateCommentData(content); err != nil {
 		return nil, err
 	}
 
-	query := `INSERT INTO comments (content, post_id, user_id, created, updated) 
-			  VALUES (?, ?, ?, ?, ?) RETURNING id, created, updated`
+	// Комментировать можно только видимый пост в категориях, где это разрешено
+	for _, action := range []string{models.CategoryView, models.CategoryComment} {
+		allowed, err := cs.db.canAccessPost(userID, postID, action)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrCommentForbidden
+		}
+	}
+
+	// Фильтр может заменить слова, поэтому проверяем до рендеринга
+	checked := &Content{Kind: models.CheckedComment, UserID: userID, PostID: postID, Text: content}
+	verdict, err := cs.db.checkContent(checked)
+	if err != nil {
+		return nil, err
+	}
+	content = checked.Text
+
+	var review sql.NullString
+	if verdict.Held() {
+		review = sql.NullString{String: models.ReviewNew, Valid: true}
+	}
+
+	contentHTML, mentioned, err := renderWithMentions(cs.db, content)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := cs.db.DBConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO comments (content, content_html, post_id, parent_id, user_id, review, created, updated) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created, updated`
 
 	var comment models.Comment
 	now := time.Now()
 
-	err := cs.db.DBConn.QueryRow(query, content, postID, userID, now, now).Scan(
+	err = tx.QueryRow(query, content, contentHTML, postID, parentID, userID, review, now, now).Scan(
 		&comment.ID, &comment.Created, &comment.Updated)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrCommentCreateFailed, err)
 	}
 
+	// Сохраняем первую версию комментария
+	if err = insertCommentRevision(tx, comment.ID, userID, content); err != nil {
+		return nil, err
+	}
+
+	if err = logContentCheck(tx, checked, verdict, &comment.ID); err != nil {
+		return nil, err
+	}
+
+	notifications, err := recordMentions(tx, userID, postID, &comment.ID, mentioned)
+	if err != nil {
+		return nil, err
+	}
+
+	// Уведомления собираем до автоподписки, чтобы комментатор
+	// не получил уведомление о собственном комментарии
+	replyNotifications, err := commentNotifications(tx, postID, parentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	notifications = append(notifications, replyNotifications...)
+
+	// О комментарии на проверке уведомят после одобрения
+	if review.Valid {
+		notifications = nil
+	}
+
+	// Комментатор следит за обсуждением, пока не отпишется
+	if err = autoSubscribePost(tx, userID, postID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	cs.db.deliver(notifications)
+	if !review.Valid {
+		cs.db.checkBadges(userID)
+	}
+
 	comment.Content = content
+	comment.ContentHTML = contentHTML
 	comment.PostID = postID
+	comment.ParentID = parentID
 	comment.UserID = userID
+	comment.Review = review.String
 
 	return &comment, nil
 }
 
 // GetComment получает комментарий по ID с информацией об авторе
 func (cs *CommentService) GetComment(id int) (*models.Comment, error) {
-	query := `SELECT c.id, c.content, c.post_id, c.user_id, c.created, c.updated, u.username
+	query := `SELECT c.id, c.content, c.content_html, c.post_id, c.parent_id, c.user_id, COALESCE(c.review, ''),
+					 c.created, c.updated, u.username
 			  FROM comments c
 			  JOIN users u ON c.user_id = u.id
 			  WHERE c.id = ?`
 
-	var comment models.Comment
-	err := cs.db.DBConn.QueryRow(query, id).Scan(
-		&comment.ID, &comment.Content, &comment.PostID, &comment.UserID,
-		&comment.Created, &comment.Updated, &comment.Username)
-
+	comment, err := scanComment(cs.db.DBConn.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrCommentNotFound
@@ -71,12 +169,17 @@ func (cs *CommentService) GetComment(id int) (*models.Comment, error) {
 		return nil, err
 	}
 
-	return &comment, nil
+	if err := renderLegacyComment(comment); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
 }
 
 // GetPostComments получает все комментарии поста
 func (cs *CommentService) GetPostComments(postID int) ([]*models.Comment, error) {
-	query := `SELECT c.id, c.content, c.post_id, c.user_id, c.created, c.updated, u.username
+	query := `SELECT c.id, c.content, c.content_html, c.post_id, c.parent_id, c.user_id, COALESCE(c.review, ''),
+					 c.created, c.updated, u.username
 			  FROM comments c
 			  JOIN users u ON c.user_id = u.id
 			  WHERE c.post_id = ?
@@ -90,13 +193,14 @@ func (cs *CommentService) GetPostComments(postID int) ([]*models.Comment, error)
 
 	var comments []*models.Comment
 	for rows.Next() {
-		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.Content, &comment.PostID, &comment.UserID,
-			&comment.Created, &comment.Updated, &comment.Username)
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, err
 		}
-		comments = append(comments, &comment)
+		if err := renderLegacyComment(comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -106,15 +210,24 @@ func (cs *CommentService) GetPostComments(postID int) ([]*models.Comment, error)
 	return comments, nil
 }
 
-// GetUserComments получает комментарии конкретного пользователя
-func (cs *CommentService) GetUserComments(userID int) ([]*models.Comment, error) {
-	query := `SELECT c.id, c.content, c.post_id, c.user_id, c.created, c.updated, u.username
+// GetUserComments получает не больше limit последних комментариев конкретного
+// пользователя к опубликованным постам, доступным пользователю viewerID (0 - гость)
+func (cs *CommentService) GetUserComments(userID, viewerID, limit int) ([]*models.Comment, error) {
+	hidden, err := cs.db.hiddenPostsFilter(viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT c.id, c.content, c.content_html, c.post_id, c.parent_id, c.user_id, COALESCE(c.review, ''),
+					 c.created, c.updated, u.username
 			  FROM comments c
 			  JOIN users u ON c.user_id = u.id
-			  WHERE c.user_id = ?
-			  ORDER BY c.created DESC`
+			  JOIN posts p ON c.post_id = p.id
+			  WHERE c.user_id = ? AND c.review IS NULL AND p.published = 1 AND ` + hidden + `
+			  ORDER BY c.created DESC
+			  LIMIT ?`
 
-	rows, err := cs.db.DBConn.Query(query, userID)
+	rows, err := cs.db.DBConn.Query(query, userID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -122,13 +235,14 @@ func (cs *CommentService) GetUserComments(userID int) ([]*models.Comment, error)
 
 	var comments []*models.Comment
 	for rows.Next() {
-		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.Content, &comment.PostID, &comment.UserID,
-			&comment.Created, &comment.Updated, &comment.Username)
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, err
 		}
-		comments = append(comments, &comment)
+		if err := renderLegacyComment(comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -138,19 +252,44 @@ func (cs *CommentService) GetUserComments(userID int) ([]*models.Comment, error)
 	return comments, nil
 }
 
-// UpdateComment обновляет комментарий (только автор может изменять)
+// CountUserComments получает количество прошедших проверку комментариев пользователя к опубликованным постам
+func (cs *CommentService) CountUserComments(userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM comments c JOIN posts p ON c.post_id = p.id
+			  WHERE c.user_id = ? AND c.review IS NULL AND p.published = 1`
+	err := cs.db.DBConn.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
+// UpdateComment обновляет комментарий (автор или модератор) и сохраняет новую версию в истории
 func (cs *CommentService) UpdateComment(commentID int, content string, userID int) error {
 	if err := cs.validateCommentData(content); err != nil {
 		return err
 	}
 
-	// Проверяем, что пользователь является автором комментария
-	if !cs.isCommentAuthor(commentID, userID) {
-		return ErrNotCommentAuthor
+	// Проверяем, что пользователь может редактировать комментарий
+	if !cs.canEditComment(commentID, userID) {
+		return ErrNotCommentEditor
+	}
+
+	contentHTML, mentioned, err := renderWithMentions(cs.db, content)
+	if err != nil {
+		return err
 	}
 
-	query := `UPDATE comments SET content = ?, updated = ? WHERE id = ?`
-	result, err := cs.db.DBConn.Exec(query, content, time.Now(), commentID)
+	tx, err := cs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Комментарии, созданные до появления истории, получают исходную версию
+	if err = ensureInitialCommentRevision(tx, commentID); err != nil {
+		return err
+	}
+
+	query := `UPDATE comments SET content = ?, content_html = ?, updated = ? WHERE id = ?`
+	result, err := tx.Exec(query, content, contentHTML, time.Now(), commentID)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrCommentUpdateFailed, err)
 	}
@@ -164,9 +303,40 @@ func (cs *CommentService) UpdateComment(commentID int, content string, userID in
 		return ErrCommentNotFound
 	}
 
+	if err = insertCommentRevision(tx, commentID, userID, content); err != nil {
+		return err
+	}
+
+	var postID int
+	if err = tx.QueryRow(`SELECT post_id FROM comments WHERE id = ?`, commentID).Scan(&postID); err != nil {
+		return err
+	}
+
+	// Уведомляются только новые упоминания
+	notifications, err := recordMentions(tx, userID, postID, &commentID, mentioned)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	cs.db.deliver(notifications)
+
 	return nil
 }
 
+// RollbackComment восстанавливает комментарий из выбранной версии
+func (cs *CommentService) RollbackComment(commentID, revisionID, userID int) error {
+	revision, err := NewRevisionService(cs.db).GetCommentRevision(commentID, revisionID)
+	if err != nil {
+		return err
+	}
+
+	return cs.UpdateComment(commentID, revision.Content, userID)
+}
+
 // DeleteComment удаляет комментарий (только автор может удалять)
 func (cs *CommentService) DeleteComment(id int, userID int) error {
 	// Проверяем, что пользователь является автором комментария
@@ -192,10 +362,10 @@ func (cs *CommentService) DeleteComment(id int, userID int) error {
 	return nil
 }
 
-// GetCommentsCount получает общее количество комментариев поста
+// GetCommentsCount получает количество прошедших проверку комментариев поста
 func (cs *CommentService) GetCommentsCount(postID int) (int, error) {
 	var count int
-	query := `SELECT COUNT(*) FROM comments WHERE post_id = ?`
+	query := `SELECT COUNT(*) FROM comments WHERE post_id = ? AND review IS NULL`
 	err := cs.db.DBConn.QueryRow(query, postID).Scan(&count)
 	return count, err
 }
@@ -211,6 +381,46 @@ func (cs *CommentService) isCommentAuthor(commentID, userID int) bool {
 	return authorID == userID
 }
 
+// canEditComment проверяет, может ли пользователь редактировать комментарий (автор или модератор)
+func (cs *CommentService) canEditComment(commentID, userID int) bool {
+	if cs.isCommentAuthor(commentID, userID) {
+		return true
+	}
+	return NewUserService(cs.db).IsModerator(userID)
+}
+
+// scanComment читает строку запроса комментария с автором
+func scanComment(row rowScanner) (*models.Comment, error) {
+	var comment models.Comment
+	var parentID sql.NullInt64
+
+	err := row.Scan(&comment.ID, &comment.Content, &comment.ContentHTML, &comment.PostID, &parentID,
+		&comment.UserID, &comment.Review, &comment.Created, &comment.Updated, &comment.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		comment.ParentID = &id
+	}
+
+	return &comment, nil
+}
+
+// renderLegacyComment рендерит комментарии, сохранённые до появления Markdown
+func renderLegacyComment(comment *models.Comment) error {
+	if comment.ContentHTML != "" {
+		return nil
+	}
+	contentHTML, err := markdown.Render(comment.Content)
+	if err != nil {
+		return fmt.Errorf("ошибка рендеринга комментария %d: %v", comment.ID, err)
+	}
+	comment.ContentHTML = contentHTML
+	return nil
+}
+
 // validateCommentData валидирует данные комментария
 func (cs *CommentService) validateCommentData(content string) error {
 	content = strings.TrimSpace(content)
@@ -0,0 +1,422 @@
+package database
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrContentRejected = errors.New("текст отклонён фильтром: уберите запрещённые слова")
+
+// Действия со словами из чёрного списка
+const (
+	BlockReplace = "replace" // скрыть слово звёздочками и опубликовать
+	BlockHold    = "hold"    // отправить текст на проверку модератору
+	BlockReject  = "reject"  // отклонить текст
+)
+
+// repeatMinLength - повторы текста короче этого не считаются спамом:
+// короткие реплики вроде "Спасибо!" честно пишут много раз
+const repeatMinLength = 20
+
+// linkPattern находит начало ссылки; www после схемы не считается второй ссылкой
+var linkPattern = regexp.MustCompile(`(?i)https?://(?:www\.)?|www\.`)
+
+// Content - текст, который проверяет фильтр. Проверки могут изменить Title, Text и Tags
+type Content struct {
+	Kind   string // models.CheckedPost, CheckedEdit или CheckedComment
+	UserID int    // кто отправил текст
+	PostID int    // пост: редактируемый для CheckedEdit, обсуждаемый для CheckedComment
+	Title  string // у комментариев пусто
+	Text   string
+	Tags   []string // теги поста; у комментариев пусто
+}
+
+// CheckResult - вывод одной проверки. Пустой Reason - проверка ничего не нашла
+type CheckResult struct {
+	Score  int    // баллы подозрительности
+	Hold   bool   // отправить на проверку независимо от баллов
+	Reject bool   // отклонить текст
+	Reason string // что нашла проверка, для журнала
+}
+
+// ContentCheck - одна проверка фильтра. Чтобы добавить новую, достаточно
+// реализовать интерфейс и включить проверку в ContentPipeline.Checks
+type ContentCheck interface {
+	Check(db *Database, content *Content) (*CheckResult, error)
+}
+
+// SpamSettings - пороги проверок на спам
+type SpamSettings struct {
+	MaxLinks     int           // ссылок без штрафа; 0 - без лимита
+	LinkScore    int           // баллы за превышение лимита ссылок
+	RepeatWindow time.Duration // за какой срок искать повторы текста; 0 - не искать
+	RepeatScore  int           // баллы за каждый повтор
+	HoldScore    int           // сумма баллов, с которой текст уходит на проверку; 0 - баллы не учитываются
+}
+
+// DefaultSpamSettings - пороги по умолчанию: на проверку уходит текст
+// с лишними ссылками или повтором недавнего текста автора
+var DefaultSpamSettings = SpamSettings{
+	MaxLinks:     3,
+	LinkScore:    5,
+	RepeatWindow: 24 * time.Hour,
+	RepeatScore:  5,
+	HoldScore:    5,
+}
+
+// ContentPipeline - фильтр нового содержимого: набор проверок и порог баллов
+type ContentPipeline struct {
+	Checks    []ContentCheck
+	HoldScore int // 0 - на проверку отправляют только сами проверки
+}
+
+// NewContentPipeline собирает фильтр из чёрного списка и проверок на спам
+func NewContentPipeline(blocklist Blocklist, settings SpamSettings) *ContentPipeline {
+	return &ContentPipeline{
+		Checks: []ContentCheck{
+			blocklist,
+			LinkLimitCheck{Max: settings.MaxLinks, Score: settings.LinkScore},
+			RepeatCheck{Window: settings.RepeatWindow, Score: settings.RepeatScore},
+		},
+		HoldScore: settings.HoldScore,
+	}
+}
+
+// ContentVerdict - решение фильтра
+type ContentVerdict struct {
+	Decision string // models.DecisionPublish, DecisionHold или DecisionReject
+	Score    int
+	Reasons  []string
+}
+
+// Held сообщает, что текст нужно отправить на проверку. nil - фильтр выключен
+func (v *ContentVerdict) Held() bool {
+	return v != nil && v.Decision == models.DecisionHold
+}
+
+// Run прогоняет текст через все проверки. Отклонение не прерывает остальные
+// проверки, чтобы в журнал попали все причины
+func (p *ContentPipeline) Run(db *Database, content *Content) (*ContentVerdict, error) {
+	verdict := &ContentVerdict{Decision: models.DecisionPublish}
+	hold, reject := false, false
+
+	for _, check := range p.Checks {
+		result, err := check.Check(db, content)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil || result.Reason == "" {
+			continue
+		}
+		verdict.Score += result.Score
+		verdict.Reasons = append(verdict.Reasons, result.Reason)
+		hold = hold || result.Hold
+		reject = reject || result.Reject
+	}
+
+	switch {
+	case reject:
+		verdict.Decision = models.DecisionReject
+	case hold, p.HoldScore > 0 && verdict.Score >= p.HoldScore:
+		verdict.Decision = models.DecisionHold
+	}
+
+	return verdict, nil
+}
+
+// checkContent прогоняет текст через фильтр (nil, если фильтр выключен).
+// Отклонённый текст сразу записывается в журнал, остальные решения
+// записывает logContentCheck вместе с сохранённым текстом
+func (d *Database) checkContent(content *Content) (*ContentVerdict, error) {
+	if d.Pipeline == nil {
+		return nil, nil
+	}
+
+	verdict, err := d.Pipeline.Run(d, content)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки содержимого: %v", err)
+	}
+
+	if verdict.Decision == models.DecisionReject {
+		if err = logContentCheck(d.DBConn, content, verdict, nil); err != nil {
+			return nil, err
+		}
+		return nil, ErrContentRejected
+	}
+
+	return verdict, nil
+}
+
+// logContentCheck записывает решение фильтра в журнал. commentID - nil для постов
+func logContentCheck(db execer, content *Content, verdict *ContentVerdict, commentID *int) error {
+	if verdict == nil {
+		return nil
+	}
+
+	var postID *int
+	if content.PostID != 0 {
+		postID = &content.PostID
+	}
+
+	_, err := db.Exec(`INSERT INTO content_checks (kind, post_id, comment_id, user_id, decision, score, reasons, created)
+					   VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		content.Kind, postID, commentID, content.UserID, verdict.Decision, verdict.Score,
+		strings.Join(verdict.Reasons, "; "), time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка записи решения фильтра: %v", err)
+	}
+	return nil
+}
+
+// Blocklist - чёрный список: слово или фраза в нижнем регистре -> действие.
+// Слова фразы разделены одним пробелом
+type Blocklist map[string]string
+
+// LoadBlocklist читает чёрный список в формате "действие: слово, фраза из слов".
+// Знаки между словами фразы не важны: "buy-now" и "buy now" - одна запись.
+// Отсутствующий файл означает пустой список
+func LoadBlocklist(path string) (Blocklist, error) {
+	blocklist := Blocklist{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return blocklist, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		action, entries, ok := strings.Cut(text, ":")
+		action = strings.TrimSpace(action)
+		if !ok || (action != BlockReplace && action != BlockHold && action != BlockReject) {
+			return nil, fmt.Errorf("%s:%d: ожидается формат \"replace|hold|reject: слово, слово\"", path, line)
+		}
+
+		for _, entry := range strings.Split(entries, ",") {
+			if words := splitWords(strings.ToLower(entry)); len(words) > 0 {
+				blocklist[strings.Join(words, " ")] = action
+			}
+		}
+	}
+
+	return blocklist, scanner.Err()
+}
+
+// Check скрывает звёздочками слова и фразы с действием replace, а за остальные
+// записи отправляет текст на проверку или отклоняет его. Тег со скрытым словом
+// убирается: звёздочки в теге бессмысленны
+func (b Blocklist) Check(db *Database, content *Content) (*CheckResult, error) {
+	found := map[string][]string{}
+	seen := map[string]bool{}
+
+	replace := func(entry, match string) string {
+		action := b[entry]
+		if !seen[entry] {
+			seen[entry] = true
+			found[action] = append(found[action], entry)
+		}
+		if action == BlockReplace {
+			return replaceWords(match, maskWord)
+		}
+		return match
+	}
+	content.Title = b.replaceEntries(content.Title, replace)
+	content.Text = b.replaceEntries(content.Text, replace)
+
+	tags := content.Tags[:0:0]
+	for _, tag := range content.Tags {
+		if b.replaceEntries(tag, replace) == tag {
+			tags = append(tags, tag)
+		}
+	}
+	content.Tags = tags
+
+	result := &CheckResult{
+		Hold:   len(found[BlockHold]) > 0,
+		Reject: len(found[BlockReject]) > 0,
+	}
+
+	var reasons []string
+	for _, entry := range []struct{ action, label string }{
+		{BlockReject, "запрещённые слова"},
+		{BlockHold, "слова на проверку"},
+		{BlockReplace, "заменены слова"},
+	} {
+		if words := found[entry.action]; len(words) > 0 {
+			reasons = append(reasons, entry.label+": "+strings.Join(words, ", "))
+		}
+	}
+	result.Reason = strings.Join(reasons, "; ")
+
+	return result, nil
+}
+
+// replaceEntries ищет в тексте записи чёрного списка и подставляет вместо
+// найденного фрагмента результат replace(запись, фрагмент). Фраза совпадает с
+// идущими подряд словами текста, чем бы они ни были разделены; из нескольких
+// записей, начинающихся с одного слова, выбирается самая длинная
+func (b Blocklist) replaceEntries(text string, replace func(entry, match string) string) string {
+	maxWords := 0
+	for entry := range b {
+		maxWords = max(maxWords, strings.Count(entry, " ")+1)
+	}
+
+	spans := wordSpans(text)
+	var out strings.Builder
+	last := 0
+
+	for i := 0; i < len(spans); i++ {
+		for n := min(maxWords, len(spans)-i); n > 0; n-- {
+			words := make([]string, n)
+			for j := range words {
+				words[j] = strings.ToLower(text[spans[i+j][0]:spans[i+j][1]])
+			}
+			entry := strings.Join(words, " ")
+			if _, ok := b[entry]; !ok {
+				continue
+			}
+
+			start, end := spans[i][0], spans[i+n-1][1]
+			out.WriteString(text[last:start])
+			out.WriteString(replace(entry, text[start:end]))
+			last = end
+			i += n - 1
+			break
+		}
+	}
+	out.WriteString(text[last:])
+
+	return out.String()
+}
+
+// maskWord скрывает слово звёздочками. Первая буква остаётся: строка из одних
+// звёздочек в Markdown - разделитель
+func maskWord(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	return string(first) + strings.Repeat("*", utf8.RuneCountInString(word[size:]))
+}
+
+// isWordRune сообщает, является ли символ частью слова
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// splitWords разбивает текст на слова - непрерывные последовательности букв и цифр
+func splitWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) })
+}
+
+// wordSpans возвращает границы [начало, конец) каждого слова текста в байтах
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+
+	return spans
+}
+
+// replaceWords подставляет вместо каждого слова текста результат replace
+func replaceWords(text string, replace func(word string) string) string {
+	var b strings.Builder
+	last := 0
+
+	for _, span := range wordSpans(text) {
+		b.WriteString(text[last:span[0]])
+		b.WriteString(replace(text[span[0]:span[1]]))
+		last = span[1]
+	}
+	b.WriteString(text[last:])
+
+	return b.String()
+}
+
+// LinkLimitCheck начисляет баллы тексту, в котором больше Max ссылок
+type LinkLimitCheck struct {
+	Max   int // 0 - без лимита
+	Score int
+}
+
+// Check считает ссылки в заголовке и тексте
+func (c LinkLimitCheck) Check(db *Database, content *Content) (*CheckResult, error) {
+	if c.Max <= 0 {
+		return nil, nil
+	}
+
+	links := len(linkPattern.FindAllStringIndex(content.Title, -1)) +
+		len(linkPattern.FindAllStringIndex(content.Text, -1))
+	if links <= c.Max {
+		return nil, nil
+	}
+
+	return &CheckResult{
+		Score:  c.Score,
+		Reason: fmt.Sprintf("ссылок: %d при лимите %d", links, c.Max),
+	}, nil
+}
+
+// RepeatCheck начисляет баллы за каждый пост или комментарий с тем же
+// текстом, отправленный автором за последние Window
+type RepeatCheck struct {
+	Window time.Duration // 0 - не искать повторы
+	Score  int
+}
+
+// Check ищет такой же текст среди недавних постов и комментариев автора.
+// Редактируемый пост не считается повтором самого себя
+func (c RepeatCheck) Check(db *Database, content *Content) (*CheckResult, error) {
+	if c.Window <= 0 || utf8.RuneCountInString(strings.TrimSpace(content.Text)) < repeatMinLength {
+		return nil, nil
+	}
+
+	editedID := 0
+	if content.Kind == models.CheckedEdit {
+		editedID = content.PostID
+	}
+
+	since := time.Now().Add(-c.Window)
+	var repeats int
+	err := db.DBConn.QueryRow(`SELECT
+			(SELECT COUNT(*) FROM posts WHERE user_id = ? AND content = ? AND created >= ? AND id != ?) +
+			(SELECT COUNT(*) FROM comments WHERE user_id = ? AND content = ? AND created >= ?)`,
+		content.UserID, content.Text, since, editedID, content.UserID, content.Text, since).Scan(&repeats)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска повторов: %v", err)
+	}
+	if repeats == 0 {
+		return nil, nil
+	}
+
+	return &CheckResult{
+		Score:  c.Score * repeats,
+		Reason: fmt.Sprintf("повтор недавнего текста автора: %d", repeats),
+	}, nil
+}
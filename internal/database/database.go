@@ -4,17 +4,21 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Database struct {
 	DBConn *sql.DB
+	// Способы доставки уведомлений. Если пусто, уведомления
+	// показываются только в приложении
+	Channels []NotificationChannel
+	// Фильтр новых постов, правок и комментариев. Если nil,
+	// содержимое публикуется без проверок
+	Pipeline *ContentPipeline
 }
 
-func NewDatabase(dbPath string) (*Database, error) {
+func NewDatabase(dbPath, schemaPath string) (*Database, error) {
 	dbconn, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка открытия базы данных: %v", err)
@@ -26,28 +30,14 @@ func NewDatabase(dbPath string) (*Database, error) {
 
 	database := &Database{DBConn: dbconn}
 
-	if err := database.executeSchema(); err != nil {
-		return nil, fmt.Errorf("ошибка выполнения схемы: %v", err)
+	if _, err := database.Migrate(schemaPath); err != nil {
+		return nil, err
 	}
 
 	log.Println("База данных успешно инициализирована")
 	return database, nil
 }
 
-func (d *Database) executeSchema() error {
-	schemaPath := filepath.Join("database", "../../forum.sql")
-	sqlContent, err := os.ReadFile(schemaPath)
-	if err != nil {
-		return fmt.Errorf("ошибка чтения файла схемы %s: %v", schemaPath, err)
-	}
-
-	if _, err := d.DBConn.Exec(string(sqlContent)); err != nil {
-		return fmt.Errorf("ошибка выполнения схемы: %v", err)
-	}
-
-	return nil
-}
-
 func (d *Database) Close() error {
 	if d.DBConn != nil {
 		return d.DBConn.Close()
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+var (
+	ErrDraftNotFound   = errors.New("черновик не найден")
+	ErrDraftSaveFailed = errors.New("ошибка сохранения черновика")
+	ErrEmptyDraft      = errors.New("пустой черновик не сохраняется")
+)
+
+type DraftService struct {
+	db *Database
+}
+
+func NewDraftService(db *Database) *DraftService {
+	return &DraftService{db: db}
+}
+
+// SaveDraft сохраняет черновик. draftID = 0 создаёт новый черновик, но для правки
+// поста (postID != nil) переиспользуется уже существующий черновик этого поста.
+// Черновик может быть неполным, поэтому проверяются только предельные длины
+func (ds *DraftService) SaveDraft(userID, draftID int, postID *int, title, content, tags string,
+	categoryIDs []int) (*models.Draft, error) {
+
+	if title == "" && content == "" {
+		return nil, ErrEmptyDraft
+	}
+	if len(title) > 255 {
+		return nil, ErrLongTitle
+	}
+	if len(content) > 10000 {
+		return nil, ErrLongContent
+	}
+
+	tx, err := ds.db.DBConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if draftID == 0 && postID != nil {
+		err = tx.QueryRow(`SELECT id FROM drafts WHERE user_id = ? AND post_id = ?`, userID, *postID).Scan(&draftID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %v", ErrDraftSaveFailed, err)
+		}
+	}
+
+	now := time.Now()
+	if draftID == 0 {
+		query := `INSERT INTO drafts (user_id, post_id, title, content, tags, created, updated)
+				  VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+		err = tx.QueryRow(query, userID, postID, title, content, tags, now, now).Scan(&draftID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDraftSaveFailed, err)
+		}
+	} else {
+		query := `UPDATE drafts SET title = ?, content = ?, tags = ?, updated = ? WHERE id = ? AND user_id = ?`
+		result, err := tx.Exec(query, title, content, tags, now, draftID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDraftSaveFailed, err)
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			return nil, ErrDraftNotFound
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM draft_categories WHERE draft_id = ?`, draftID); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDraftSaveFailed, err)
+	}
+	for _, categoryID := range uniqueInts(categoryIDs) {
+		_, err = tx.Exec(`INSERT INTO draft_categories (draft_id, category_id) VALUES (?, ?)`, draftID, categoryID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDraftSaveFailed, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return ds.GetDraft(userID, draftID)
+}
+
+// GetDraft получает черновик пользователя с выбранными категориями
+func (ds *DraftService) GetDraft(userID, draftID int) (*models.Draft, error) {
+	query := `SELECT id, user_id, post_id, title, content, tags, created, updated
+			  FROM drafts WHERE id = ? AND user_id = ?`
+	return ds.getDraft(query, draftID, userID)
+}
+
+// GetPostDraft получает черновик правки поста, если пользователь его начинал
+func (ds *DraftService) GetPostDraft(userID, postID int) (*models.Draft, error) {
+	query := `SELECT id, user_id, post_id, title, content, tags, created, updated
+			  FROM drafts WHERE post_id = ? AND user_id = ?`
+	return ds.getDraft(query, postID, userID)
+}
+
+// GetUserDrafts получает черновики пользователя, последние изменённые сначала
+func (ds *DraftService) GetUserDrafts(userID int) ([]*models.Draft, error) {
+	query := `SELECT id, user_id, post_id, title, content, tags, created, updated
+			  FROM drafts WHERE user_id = ?
+			  ORDER BY updated DESC`
+
+	rows, err := ds.db.DBConn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []*models.Draft
+	for rows.Next() {
+		draft, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+// DeleteDraft удаляет черновик пользователя
+func (ds *DraftService) DeleteDraft(userID, draftID int) error {
+	tx, err := ds.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM drafts WHERE id = ? AND user_id = ?`, draftID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления черновика: %v", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrDraftNotFound
+	}
+
+	if _, err = tx.Exec(`DELETE FROM draft_categories WHERE draft_id = ?`, draftID); err != nil {
+		return fmt.Errorf("ошибка удаления черновика: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// getDraft выполняет запрос одного черновика и загружает его категории
+func (ds *DraftService) getDraft(query string, args ...interface{}) (*models.Draft, error) {
+	draft, err := scanDraft(ds.db.DBConn.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDraftNotFound
+		}
+		return nil, err
+	}
+
+	draft.CategoryIDs, err = queryIDs(ds.db.DBConn,
+		`SELECT category_id FROM draft_categories WHERE draft_id = ?`, draft.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return draft, nil
+}
+
+// scanDraft читает черновик из строки результата
+func scanDraft(row rowScanner) (*models.Draft, error) {
+	var draft models.Draft
+	var postID sql.NullInt64
+
+	err := row.Scan(&draft.ID, &draft.UserID, &postID, &draft.Title, &draft.Content, &draft.Tags,
+		&draft.Created, &draft.Updated)
+	if err != nil {
+		return nil, err
+	}
+
+	if postID.Valid {
+		id := int(postID.Int64)
+		draft.PostID = &id
+	}
+
+	return &draft, nil
+}
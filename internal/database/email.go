@@ -0,0 +1,110 @@
+package database
+
+import (
+	"fmt"
+	"forum/internal/models"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// EmailChannel отправляет уведомления письмом на адрес из профиля получателя
+type EmailChannel struct {
+	db      *Database
+	addr    string
+	from    string
+	auth    smtp.Auth
+	baseURL string
+}
+
+// NewEmailChannel создаёт канал с SMTP-сервером addr (host:port). Если username
+// пуст, письма отправляются без авторизации. baseURL используется для ссылок в письмах
+func NewEmailChannel(db *Database, addr, from, username, password, baseURL string) *EmailChannel {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &EmailChannel{
+		db:      db,
+		addr:    addr,
+		from:    from,
+		auth:    auth,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+func (c *EmailChannel) Name() string {
+	return "email"
+}
+
+// Deliver готовит письмо и отправляет его в фоне, чтобы медленный
+// SMTP-сервер не задерживал ответ пользователю
+func (c *EmailChannel) Deliver(n *models.Notification) error {
+	var email, actor string
+	query := `SELECT (SELECT email FROM users WHERE id = ?), (SELECT username FROM users WHERE id = ?)`
+	if err := c.db.DBConn.QueryRow(query, n.UserID, n.ActorID).Scan(&email, &actor); err != nil {
+		return fmt.Errorf("ошибка поиска получателя: %v", err)
+	}
+
+	var title string
+	if n.PostID != nil {
+		if err := c.db.DBConn.QueryRow(`SELECT title FROM posts WHERE id = ?`, *n.PostID).Scan(&title); err != nil {
+			return fmt.Errorf("ошибка поиска поста: %v", err)
+		}
+	}
+
+	message := c.message(email, actor, title, n)
+	go func() {
+		if err := smtp.SendMail(c.addr, c.auth, c.from, []string{email}, message); err != nil {
+			log.Printf("Ошибка отправки письма пользователю %d: %v", n.UserID, err)
+		}
+	}()
+
+	return nil
+}
+
+// message составляет письмо с текстом уведомления и ссылкой на пост
+func (c *EmailChannel) message(to, actor, title string, n *models.Notification) []byte {
+	var text string
+	switch n.Type {
+	case models.NotificationComment:
+		text = actor + " прокомментировал(а) ваш пост"
+	case models.NotificationReply:
+		text = actor + " ответил(а) на ваш комментарий к посту"
+	case models.NotificationReaction:
+		text = actor + " оценил(а) ваш пост"
+	case models.NotificationMention:
+		text = actor + " упомянул(а) вас в посте"
+	case models.NotificationWatchedPost:
+		text = actor + " оставил(а) комментарий в отслеживаемом посте"
+	case models.NotificationWatchedCategory:
+		text = actor + " опубликовал(а) пост в отслеживаемой категории"
+	case models.NotificationMoved:
+		text = actor + " перенёс(ла) вашу публикацию"
+	case models.NotificationBadge:
+		text = "Вы получили значок «" + BadgeName(n.Badge) + "»"
+	default:
+		text = "Новое уведомление от " + actor
+	}
+
+	var body strings.Builder
+	body.WriteString(text)
+	if n.PostID != nil {
+		body.WriteString(" «" + title + "»\r\n\r\n")
+		body.WriteString(c.baseURL + "/post/" + strconv.Itoa(*n.PostID) + "\r\n")
+	}
+	body.WriteString("\r\nОтключить уведомления: " + c.baseURL + "/notifications\r\n")
+
+	headers := "From: " + c.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", text) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n"
+
+	return []byte(headers + body.String())
+}
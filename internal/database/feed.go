@@ -0,0 +1,128 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("неверный курсор ленты")
+
+// FeedCursor указывает на последний показанный пост ленты. Лента упорядочена
+// по дате публикации, а при равных датах - по ID, поэтому курсор хранит оба
+// значения: следующая страница не пропустит и не повторит посты, даже если
+// между запросами опубликованы новые
+type FeedCursor struct {
+	Created time.Time
+	ID      int
+}
+
+// feedCursorCondition отбирает посты p до курсора; подходит для индекса по created
+const feedCursorCondition = `(? IS NULL OR p.created < ? OR (p.created = ? AND p.id < ?))`
+
+// NewFeedCursor возвращает курсор, указывающий на пост
+func NewFeedCursor(post *models.Post) *FeedCursor {
+	return &FeedCursor{Created: post.Created, ID: post.ID}
+}
+
+// ParseFeedCursor разбирает курсор из параметра запроса. Пустая строка - первая страница
+func ParseFeedCursor(s string) (*FeedCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	nanos, id, found := strings.Cut(s, "_")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	postID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &FeedCursor{Created: time.Unix(0, n), ID: postID}, nil
+}
+
+// String кодирует курсор для параметра запроса
+func (c *FeedCursor) String() string {
+	return fmt.Sprintf("%d_%d", c.Created.UnixNano(), c.ID)
+}
+
+// args возвращает параметры для feedCursorCondition
+func (c *FeedCursor) args() []interface{} {
+	if c == nil {
+		return []interface{}{nil, nil, nil, nil}
+	}
+	return []interface{}{c.ID, c.Created, c.Created, c.ID}
+}
+
+// GetFollowingPosts получает страницу ленты «Подписки»: посты пользователей,
+// на которых подписан userID, и посты из категорий, на которые он подписан.
+// Запрос идёт по индексу постов от новых к старым и проверяет подписки
+// поиском по первичному ключу, поэтому его стоимость не растёт с числом подписок.
+// Посты из закрытых для пользователя категорий пропускаются
+func (ps *PostService) GetFollowingPosts(userID int, before *FeedCursor, limit int) ([]*models.Post, error) {
+	hidden, err := ps.db.hiddenPostsFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
+			  FROM posts p
+			  JOIN users u ON p.user_id = u.id
+			  WHERE p.published = 1 AND ` + hidden + ` AND ` + feedCursorCondition + `
+				AND (EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = ? AND f.followee_id = p.user_id)
+					 OR EXISTS (SELECT 1 FROM post_categories pc
+								JOIN category_subscriptions cs ON cs.category_id = pc.category_id AND cs.user_id = ?
+								WHERE pc.post_id = p.id))
+			  ORDER BY p.created DESC, p.id DESC
+			  LIMIT ?`
+
+	return ps.queryFeed(query, append(before.args(), userID, userID), limit)
+}
+
+// queryFeed выполняет запрос страницы ленты и загружает категории постов.
+// Запрос уже отбросил посты из закрытых для пользователя категорий, поэтому
+// все категории оставшихся постов ему видны и права заново не проверяются
+func (ps *PostService) queryFeed(query string, args []interface{}, limit int) ([]*models.Post, error) {
+	rows, err := ps.db.DBConn.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID,
+			&post.Created, &post.Updated, &post.Username)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	categoryService := NewCategoryService(ps.db)
+	for _, post := range posts {
+		categories, err := categoryService.getPostCategories(post.ID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения категорий поста %d: %v", post.ID, err)
+		}
+		post.Categories = categories
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrFollowSelf = errors.New("нельзя подписаться на самого себя")
+
+type FollowService struct {
+	db *Database
+}
+
+func NewFollowService(db *Database) *FollowService {
+	return &FollowService{db: db}
+}
+
+// Follow подписывает пользователя followerID на посты пользователя followeeID
+func (fs *FollowService) Follow(followerID, followeeID int) error {
+	if followerID == followeeID {
+		return ErrFollowSelf
+	}
+
+	query := `INSERT OR IGNORE INTO follows (follower_id, followee_id, created) VALUES (?, ?, ?)`
+	if _, err := fs.db.DBConn.Exec(query, followerID, followeeID, time.Now()); err != nil {
+		return fmt.Errorf("ошибка подписки на пользователя: %v", err)
+	}
+	return nil
+}
+
+// Unfollow отписывает пользователя followerID от пользователя followeeID
+func (fs *FollowService) Unfollow(followerID, followeeID int) error {
+	query := `DELETE FROM follows WHERE follower_id = ? AND followee_id = ?`
+	if _, err := fs.db.DBConn.Exec(query, followerID, followeeID); err != nil {
+		return fmt.Errorf("ошибка отписки от пользователя: %v", err)
+	}
+	return nil
+}
+
+// IsFollowing проверяет, подписан ли followerID на followeeID
+func (fs *FollowService) IsFollowing(followerID, followeeID int) (bool, error) {
+	var following bool
+	query := `SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = ? AND followee_id = ?)`
+	err := fs.db.DBConn.QueryRow(query, followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+// CountFollows возвращает количество подписчиков пользователя и количество
+// пользователей, на которых он подписан
+func (fs *FollowService) CountFollows(userID int) (followers, following int, err error) {
+	query := `SELECT (SELECT COUNT(*) FROM follows WHERE followee_id = ?),
+					 (SELECT COUNT(*) FROM follows WHERE follower_id = ?)`
+	err = fs.db.DBConn.QueryRow(query, userID, userID).Scan(&followers, &following)
+	return followers, following, err
+}
@@ -0,0 +1,480 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrGroupNotFound      = errors.New("группа не найдена")
+	ErrGroupExists        = errors.New("группа с таким названием или slug уже существует")
+	ErrEmptyGroupName     = errors.New("название группы не может быть пустым")
+	ErrLongGroupName      = errors.New("название группы не должно превышать 100 символов")
+	ErrInvalidGroupSlug   = errors.New("slug группы - от 3 до 50 строчных латинских букв, цифр и дефисов")
+	ErrGroupSlugIsUser    = errors.New("slug группы совпадает с именем пользователя")
+	ErrInvalidInviteCode  = errors.New("неверный код приглашения")
+	ErrAlreadyGroupMember = errors.New("пользователь уже состоит в группе")
+	ErrNotGroupMember     = errors.New("пользователь не состоит в группе")
+	ErrGroupOwnerLeaving  = errors.New("владельца нельзя исключить из группы, сначала передайте группу другому участнику")
+)
+
+// groupSlugPattern совпадает с упоминанием @slug
+var groupSlugPattern = regexp.MustCompile(`^[a-z0-9-]{3,50}$`)
+
+// inviteCodeLength - длина кода приглашения в байтах
+const inviteCodeLength = 8
+
+// groupColumns - столбцы группы в порядке scanGroup
+const groupColumns = `g.id, g.name, g.slug, g.description, COALESCE(g.owner_id, 0), COALESCE(o.username, ''),
+					  g.invite_code, (SELECT COUNT(*) FROM group_members m WHERE m.group_id = g.id), g.created`
+
+// groupFrom - источник строк для groupColumns
+const groupFrom = ` FROM user_groups g LEFT JOIN users o ON o.id = g.owner_id`
+
+type GroupService struct {
+	db *Database
+}
+
+func NewGroupService(db *Database) *GroupService {
+	return &GroupService{db: db}
+}
+
+func scanGroup(row rowScanner) (*models.Group, error) {
+	var group models.Group
+	err := row.Scan(&group.ID, &group.Name, &group.Slug, &group.Description, &group.OwnerID,
+		&group.OwnerName, &group.InviteCode, &group.MemberCount, &group.Created)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// queryGroups выполняет запрос, выбирающий groupColumns
+func (gs *GroupService) queryGroups(query string, args ...interface{}) ([]*models.Group, error) {
+	rows, err := gs.db.DBConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// generateInviteCode генерирует случайный код приглашения
+func generateInviteCode() (string, error) {
+	bytes := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// groupAudit записывает действие в журнал группы. userID = 0 - действие
+// не касается отдельного участника
+func groupAudit(db execer, group *models.Group, actorID int, action string, userID int) error {
+	var target *int
+	if userID != 0 {
+		target = &userID
+	}
+	query := `INSERT INTO group_audit (group_id, group_name, actor_id, action, user_id, created)
+			  VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := db.Exec(query, group.ID, group.Name, actorID, action, target, time.Now()); err != nil {
+		return fmt.Errorf("ошибка записи в журнал группы: %v", err)
+	}
+	return nil
+}
+
+// CreateGroup создаёт группу от имени администратора actorID.
+// Владелец ownerID (0 - без владельца) сразу становится участником
+func (gs *GroupService) CreateGroup(name, slug, description string, ownerID, actorID int) (*models.Group, error) {
+	name = strings.TrimSpace(name)
+	slug = strings.TrimSpace(slug)
+	description = strings.TrimSpace(description)
+
+	if name == "" {
+		return nil, ErrEmptyGroupName
+	}
+	if len(name) > 100 {
+		return nil, ErrLongGroupName
+	}
+	if !groupSlugPattern.MatchString(slug) {
+		return nil, ErrInvalidGroupSlug
+	}
+	if len(description) > 500 {
+		return nil, ErrLongDescription
+	}
+
+	// Упоминание @slug должно однозначно указывать на группу
+	var exists bool
+	err := gs.db.DBConn.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`, slug).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrGroupSlugIsUser
+	}
+
+	err = gs.db.DBConn.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_groups WHERE name = ? OR slug = ?)`,
+		name, slug).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrGroupExists
+	}
+
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания кода приглашения: %v", err)
+	}
+
+	tx, err := gs.db.DBConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var owner *int
+	if ownerID != 0 {
+		owner = &ownerID
+	}
+
+	group := &models.Group{
+		Name:        name,
+		Slug:        slug,
+		Description: description,
+		OwnerID:     ownerID,
+		InviteCode:  inviteCode,
+		Created:     time.Now(),
+	}
+
+	query := `INSERT INTO user_groups (name, slug, description, owner_id, invite_code, created)
+			  VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+	err = tx.QueryRow(query, name, slug, description, owner, inviteCode, group.Created).Scan(&group.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания группы: %v", err)
+	}
+
+	if err := groupAudit(tx, group, actorID, models.GroupAuditCreate, 0); err != nil {
+		return nil, err
+	}
+
+	if ownerID != 0 {
+		_, err = tx.Exec(`INSERT INTO group_members (group_id, user_id, created) VALUES (?, ?, ?)`,
+			group.ID, ownerID, group.Created)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка добавления владельца в группу: %v", err)
+		}
+		if err := groupAudit(tx, group, actorID, models.GroupAuditOwner, ownerID); err != nil {
+			return nil, err
+		}
+		group.MemberCount = 1
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return group, nil
+}
+
+// GetGroupBySlug получает группу по slug
+func (gs *GroupService) GetGroupBySlug(slug string) (*models.Group, error) {
+	group, err := scanGroup(gs.db.DBConn.QueryRow(`SELECT `+groupColumns+groupFrom+` WHERE g.slug = ?`, slug))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// GetAllGroups получает все группы по названию
+func (gs *GroupService) GetAllGroups() ([]*models.Group, error) {
+	return gs.queryGroups(`SELECT ` + groupColumns + groupFrom + ` ORDER BY g.name`)
+}
+
+// GetUserGroups получает группы, в которых состоит пользователь
+func (gs *GroupService) GetUserGroups(userID int) ([]*models.Group, error) {
+	query := `SELECT ` + groupColumns + groupFrom + `
+			  JOIN group_members gm ON gm.group_id = g.id
+			  WHERE gm.user_id = ?
+			  ORDER BY g.name`
+	return gs.queryGroups(query, userID)
+}
+
+// GetMembers получает участников группы в порядке вступления
+func (gs *GroupService) GetMembers(groupID int) ([]*models.User, error) {
+	query := `SELECT u.id, u.username, u.role, gm.created
+			  FROM group_members gm
+			  JOIN users u ON u.id = gm.user_id
+			  WHERE gm.group_id = ?
+			  ORDER BY gm.created, u.id`
+
+	rows, err := gs.db.DBConn.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.User
+	for rows.Next() {
+		var member models.User
+		// Created - дата вступления в группу
+		if err := rows.Scan(&member.ID, &member.Username, &member.Role, &member.Created); err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// IsMember проверяет, состоит ли пользователь в группе
+func (gs *GroupService) IsMember(groupID, userID int) (bool, error) {
+	var member bool
+	err := gs.db.DBConn.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?)`,
+		groupID, userID).Scan(&member)
+	return member, err
+}
+
+// AddMember добавляет пользователя в группу от имени actorID
+func (gs *GroupService) AddMember(group *models.Group, userID, actorID int) error {
+	return gs.addMember(group, userID, actorID, models.GroupAuditAdd)
+}
+
+// JoinByInvite вступает в группу по коду приглашения
+func (gs *GroupService) JoinByInvite(code string, userID int) (*models.Group, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, ErrInvalidInviteCode
+	}
+
+	group, err := scanGroup(gs.db.DBConn.QueryRow(`SELECT `+groupColumns+groupFrom+` WHERE g.invite_code = ?`, code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidInviteCode
+		}
+		return nil, err
+	}
+
+	if err := gs.addMember(group, userID, userID, models.GroupAuditJoin); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (gs *GroupService) addMember(group *models.Group, userID, actorID int, action string) error {
+	tx, err := gs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT OR IGNORE INTO group_members (group_id, user_id, created) VALUES (?, ?, ?)`,
+		group.ID, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка добавления в группу: %v", err)
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return ErrAlreadyGroupMember
+	}
+
+	if err := groupAudit(tx, group, actorID, action, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveMember исключает участника из группы от имени actorID; если actorID
+// совпадает с userID, участник выходит сам. Владельца исключить нельзя
+func (gs *GroupService) RemoveMember(group *models.Group, userID, actorID int) error {
+	if userID == group.OwnerID {
+		return ErrGroupOwnerLeaving
+	}
+
+	tx, err := gs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, group.ID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка исключения из группы: %v", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotGroupMember
+	}
+
+	action := models.GroupAuditRemove
+	if userID == actorID {
+		action = models.GroupAuditLeave
+	}
+	if err := groupAudit(tx, group, actorID, action, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// SetOwner передаёт группу участнику userID
+func (gs *GroupService) SetOwner(group *models.Group, userID, actorID int) error {
+	tx, err := gs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var member bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?)`,
+		group.ID, userID).Scan(&member)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrNotGroupMember
+	}
+
+	if _, err := tx.Exec(`UPDATE user_groups SET owner_id = ? WHERE id = ?`, userID, group.ID); err != nil {
+		return fmt.Errorf("ошибка смены владельца группы: %v", err)
+	}
+
+	if err := groupAudit(tx, group, actorID, models.GroupAuditOwner, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// ResetInviteCode заменяет код приглашения; старый код перестаёт действовать
+func (gs *GroupService) ResetInviteCode(group *models.Group, actorID int) error {
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		return fmt.Errorf("ошибка создания кода приглашения: %v", err)
+	}
+
+	tx, err := gs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE user_groups SET invite_code = ? WHERE id = ?`, inviteCode, group.ID); err != nil {
+		return fmt.Errorf("ошибка смены кода приглашения: %v", err)
+	}
+
+	if err := groupAudit(tx, group, actorID, models.GroupAuditInvite, 0); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteGroup удаляет группу вместе с участниками и её правами в категориях.
+// Журнал группы сохраняется
+func (gs *GroupService) DeleteGroup(group *models.Group, actorID int) error {
+	tx, err := gs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM category_group_permissions WHERE group_id = ?`,
+		`DELETE FROM group_members WHERE group_id = ?`,
+		`DELETE FROM user_groups WHERE id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, group.ID); err != nil {
+			return fmt.Errorf("ошибка удаления группы: %v", err)
+		}
+	}
+
+	if err := groupAudit(tx, group, actorID, models.GroupAuditDelete, 0); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// GetAudit получает журнал группы groupID (0 - всех групп) от новых записей к старым
+func (gs *GroupService) GetAudit(groupID, limit int) ([]*models.GroupAuditEntry, error) {
+	query := `SELECT a.id, a.group_id, a.group_name, COALESCE(actor.username, ''), a.action,
+					 COALESCE(target.username, ''), a.created
+			  FROM group_audit a
+			  LEFT JOIN users actor ON actor.id = a.actor_id
+			  LEFT JOIN users target ON target.id = a.user_id
+			  WHERE ? = 0 OR a.group_id = ?
+			  ORDER BY a.id DESC
+			  LIMIT ?`
+
+	rows, err := gs.db.DBConn.Query(query, groupID, groupID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.GroupAuditEntry
+	for rows.Next() {
+		var entry models.GroupAuditEntry
+		err := rows.Scan(&entry.ID, &entry.GroupID, &entry.GroupName, &entry.ActorName, &entry.Action,
+			&entry.UserName, &entry.Created)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
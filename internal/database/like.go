@@ -17,11 +17,12 @@ var (
 )
 
 type LikeService struct {
-	db *Database
+	db      *Database
+	weights ReputationWeights // Очки репутации за реакции
 }
 
-func NewLikeService(db *Database) *LikeService {
-	return &LikeService{db: db}
+func NewLikeService(db *Database, weights ReputationWeights) *LikeService {
+	return &LikeService{db: db, weights: weights}
 }
 
 // LikePost ставит лайк посту
@@ -74,16 +75,23 @@ func (ls *LikeService) GetUserCommentLike(commentID, userID int) (*models.Like,
 	return ls.getUserLike(userID, nil, &commentID)
 }
 
-// GetUserLikedPosts получает посты, которые лайкнул пользователь
-func (ls *LikeService) GetUserLikedPosts(userID int) ([]*models.Post, error) {
+// GetUserLikedPosts получает не больше limit последних опубликованных постов,
+// которые лайкнул пользователь, доступных пользователю viewerID (0 - гость)
+func (ls *LikeService) GetUserLikedPosts(userID, viewerID, limit int) ([]*models.Post, error) {
+	hidden, err := ls.db.hiddenPostsFilter(viewerID)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
 			  FROM posts p
 			  JOIN users u ON p.user_id = u.id
 			  JOIN likes l ON p.id = l.post_id
-			  WHERE l.user_id = ? AND l.is_dislike = false
-			  ORDER BY l.created DESC`
+			  WHERE l.user_id = ? AND l.is_dislike = false AND p.published = 1 AND ` + hidden + `
+			  ORDER BY l.created DESC
+			  LIMIT ?`
 
-	rows, err := ls.db.DBConn.Query(query, userID)
+	rows, err := ls.db.DBConn.Query(query, userID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -125,18 +133,88 @@ func (ls *LikeService) createLike(userID int, postID, commentID *int, isDislike
 			return ErrLikeAlreadyExists
 		}
 		// Если есть противоположный лайк/дизлайк, обновляем его
-		return ls.updateLike(existingLike.ID, isDislike)
+		if err := ls.updateLike(existingLike, isDislike); err != nil {
+			return err
+		}
+		if !isDislike {
+			receiverID, err := likeReceiver(ls.db.DBConn, postID, commentID)
+			if err != nil {
+				return err
+			}
+			ls.db.checkBadges(receiverID)
+		}
+		return ls.notifyReaction(userID, postID, commentID, isDislike)
+	}
+
+	// Создаем новый лайк/дизлайк вместе с начислением репутации автору
+	tx, err := ls.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeCreateFailed, err)
+	}
+	defer tx.Rollback()
+
+	receiverID, err := likeReceiver(tx, postID, commentID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeCreateFailed, err)
+	}
+
+	created := time.Now()
+	points, err := ls.weights.likePoints(tx, userID, receiverID, 0, created, commentID != nil, isDislike)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeCreateFailed, err)
 	}
 
-	// Создаем новый лайк/дизлайк
-	query := `INSERT INTO likes (user_id, post_id, comment_id, is_dislike, created) 
-			  VALUES (?, ?, ?, ?, ?)`
+	query := `INSERT INTO likes (user_id, post_id, comment_id, is_dislike, points, created) 
+			  VALUES (?, ?, ?, ?, ?, ?)`
 
-	_, err = ls.db.DBConn.Exec(query, userID, postID, commentID, isDislike, time.Now())
+	_, err = tx.Exec(query, userID, postID, commentID, isDislike, points, created)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrLikeCreateFailed, err)
 	}
 
+	if err := addReputation(tx, receiverID, points); err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeCreateFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeCreateFailed, err)
+	}
+
+	if !isDislike {
+		ls.db.checkBadges(receiverID)
+	}
+
+	return ls.notifyReaction(userID, postID, commentID, isDislike)
+}
+
+// notifyReaction уведомляет автора поста или комментария о лайке.
+// О дизлайках не уведомляем
+func (ls *LikeService) notifyReaction(userID int, postID, commentID *int, isDislike bool) error {
+	if isDislike {
+		return nil
+	}
+
+	var authorID, targetPostID int
+	var err error
+	if postID != nil {
+		targetPostID = *postID
+		err = ls.db.DBConn.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, *postID).Scan(&authorID)
+	} else {
+		err = ls.db.DBConn.QueryRow(`SELECT user_id, post_id FROM comments WHERE id = ?`, *commentID).Scan(
+			&authorID, &targetPostID)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка поиска автора: %v", err)
+	}
+
+	ls.db.deliver([]*models.Notification{{
+		UserID:    authorID,
+		ActorID:   userID,
+		Type:      models.NotificationReaction,
+		PostID:    &targetPostID,
+		CommentID: commentID,
+	}})
+
 	return nil
 }
 
@@ -146,42 +224,68 @@ func (ls *LikeService) removeLike(userID int, postID, commentID *int) error {
 		return ErrInvalidLikeTarget
 	}
 
-	var query string
-	var args []interface{}
-
-	if postID != nil {
-		query = `DELETE FROM likes WHERE user_id = ? AND post_id = ?`
-		args = []interface{}{userID, *postID}
-	} else {
-		query = `DELETE FROM likes WHERE user_id = ? AND comment_id = ?`
-		args = []interface{}{userID, *commentID}
+	like, err := ls.getUserLike(userID, postID, commentID)
+	if err != nil {
+		return err
 	}
 
-	result, err := ls.db.DBConn.Exec(query, args...)
+	// Удаляем лайк и списываем начисленные за него очки
+	tx, err := ls.db.DBConn.Begin()
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrLikeDeleteFailed, err)
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	receiverID, err := likeReceiver(tx, postID, commentID)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrLikeDeleteFailed, err)
 	}
 
-	if rowsAffected == 0 {
-		return ErrLikeNotFound
+	if _, err := tx.Exec(`DELETE FROM likes WHERE id = ?`, like.ID); err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeDeleteFailed, err)
+	}
+
+	if err := addReputation(tx, receiverID, -like.Points); err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeDeleteFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrLikeDeleteFailed, err)
 	}
 
 	return nil
 }
 
-// updateLike обновляет существующий лайк
-func (ls *LikeService) updateLike(likeID int, isDislike bool) error {
-	query := `UPDATE likes SET is_dislike = ? WHERE id = ?`
-	_, err := ls.db.DBConn.Exec(query, isDislike, likeID)
+// updateLike меняет лайк на дизлайк или обратно и пересчитывает очки автора.
+// Реакция остаётся в сутках, когда была поставлена, и расходует их лимит
+func (ls *LikeService) updateLike(like *models.Like, isDislike bool) error {
+	tx, err := ls.db.DBConn.Begin()
 	if err != nil {
 		return fmt.Errorf("ошибка обновления лайка: %v", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	receiverID, err := likeReceiver(tx, like.PostID, like.CommentID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления лайка: %v", err)
+	}
+
+	points, err := ls.weights.likePoints(tx, like.UserID, receiverID, like.ID, like.Created,
+		like.CommentID != nil, isDislike)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления лайка: %v", err)
+	}
+
+	query := `UPDATE likes SET is_dislike = ?, points = ? WHERE id = ?`
+	if _, err := tx.Exec(query, isDislike, points, like.ID); err != nil {
+		return fmt.Errorf("ошибка обновления лайка: %v", err)
+	}
+
+	if err := addReputation(tx, receiverID, points-like.Points); err != nil {
+		return fmt.Errorf("ошибка обновления лайка: %v", err)
+	}
+
+	return tx.Commit()
 }
 
 // getLikeStats получает статистику лайков/дизлайков
@@ -226,11 +330,11 @@ func (ls *LikeService) getUserLike(userID int, postID, commentID *int) (*models.
 	var args []interface{}
 
 	if postID != nil {
-		query = `SELECT id, user_id, post_id, comment_id, is_dislike, created 
+		query = `SELECT id, user_id, post_id, comment_id, is_dislike, points, created 
 				 FROM likes WHERE user_id = ? AND post_id = ?`
 		args = []interface{}{userID, *postID}
 	} else {
-		query = `SELECT id, user_id, post_id, comment_id, is_dislike, created 
+		query = `SELECT id, user_id, post_id, comment_id, is_dislike, points, created 
 				 FROM likes WHERE user_id = ? AND comment_id = ?`
 		args = []interface{}{userID, *commentID}
 	}
@@ -240,7 +344,7 @@ func (ls *LikeService) getUserLike(userID int, postID, commentID *int) (*models.
 
 	err := ls.db.DBConn.QueryRow(query, args...).Scan(
 		&like.ID, &like.UserID, &nullablePostID, &nullableCommentID,
-		&like.IsDislike, &like.Created)
+		&like.IsDislike, &like.Points, &like.Created)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/markdown"
+	"forum/internal/models"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// renderWithMentions рендерит Markdown, превращая упоминания существующих
+// пользователей и групп в ссылки, и возвращает ID упомянутых пользователей.
+// Упоминание @группы упоминает всех её участников
+func renderWithMentions(db *Database, content string) (string, []int, error) {
+	names := markdown.Mentions(content)
+	links := map[string]string{}
+	var userIDs []int
+
+	if len(names) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+		args := make([]interface{}, len(names))
+		for i, name := range names {
+			args[i] = name
+		}
+
+		query := `SELECT id, username FROM users WHERE username IN (` + placeholders + `)`
+		rows, err := db.DBConn.Query(query, args...)
+		if err != nil {
+			return "", nil, fmt.Errorf("ошибка поиска упомянутых пользователей: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int
+			var username string
+			if err := rows.Scan(&id, &username); err != nil {
+				return "", nil, err
+			}
+			links[username] = "/user/" + url.PathEscape(username)
+			userIDs = append(userIDs, id)
+		}
+		if err := rows.Err(); err != nil {
+			return "", nil, err
+		}
+
+		query = `SELECT g.slug, gm.user_id FROM user_groups g
+				 LEFT JOIN group_members gm ON gm.group_id = g.id
+				 WHERE g.slug IN (` + placeholders + `)`
+		groupRows, err := db.DBConn.Query(query, args...)
+		if err != nil {
+			return "", nil, fmt.Errorf("ошибка поиска упомянутых групп: %v", err)
+		}
+		defer groupRows.Close()
+
+		for groupRows.Next() {
+			var slug string
+			var memberID sql.NullInt64
+			if err := groupRows.Scan(&slug, &memberID); err != nil {
+				return "", nil, err
+			}
+			links[slug] = "/group/" + slug
+			if memberID.Valid && !containsInt(userIDs, int(memberID.Int64)) {
+				userIDs = append(userIDs, int(memberID.Int64))
+			}
+		}
+		if err := groupRows.Err(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	contentHTML, err := markdown.RenderWithMentions(content, links)
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка рендеринга содержимого: %v", err)
+	}
+
+	return contentHTML, userIDs, nil
+}
+
+// recordMentions сохраняет упоминания и возвращает уведомления для тех, кого
+// упомянули здесь впервые. commentID равен nil для упоминаний в самом посте
+func recordMentions(tx *sql.Tx, authorID, postID int, commentID *int, userIDs []int) ([]*models.Notification, error) {
+	var notifications []*models.Notification
+	query := `INSERT OR IGNORE INTO mentions (user_id, author_id, post_id, comment_id, created)
+			  VALUES (?, ?, ?, ?, ?)`
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		// Себя не уведомляем
+		if userID == authorID {
+			continue
+		}
+
+		result, err := tx.Exec(query, userID, authorID, postID, commentID, now)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сохранения упоминания: %v", err)
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		// Упоминание уже было в прошлой версии - повторно не уведомляем
+		if inserted == 0 {
+			continue
+		}
+
+		notifications = append(notifications, &models.Notification{
+			UserID:    userID,
+			ActorID:   authorID,
+			Type:      models.NotificationMention,
+			PostID:    &postID,
+			CommentID: commentID,
+		})
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,580 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrConversationNotFound  = errors.New("переписка не найдена")
+	ErrNoRecipients          = errors.New("укажите хотя бы одного получателя")
+	ErrRecipientNotFound     = errors.New("получатель не найден")
+	ErrTooManyRecipients     = errors.New("в переписке может быть не больше 10 участников")
+	ErrMessageToSelf         = errors.New("нельзя написать самому себе")
+	ErrEmptyMessage          = errors.New("сообщение не может быть пустым")
+	ErrLongMessage           = errors.New("сообщение не должно превышать 5000 символов")
+	ErrLongSubject           = errors.New("тема не должна превышать 100 символов")
+	ErrSenderBlocked         = errors.New("пользователь запретил вам писать ему")
+	ErrConversationRateLimit = errors.New("слишком много новых переписок, попробуйте через час")
+	ErrBlockSelf             = errors.New("нельзя заблокировать самого себя")
+	ErrMessageSendFailed     = errors.New("ошибка отправки сообщения")
+)
+
+const (
+	// MaxConversationMembers - предельное число участников переписки вместе с автором
+	MaxConversationMembers = 10
+	// MaxNewConversationsPerHour - сколько переписок пользователь может начать за час
+	MaxNewConversationsPerHour = 10
+)
+
+// visibleMessage - условие видимости сообщения m участнику cm: сообщение не
+// удалено им из своей копии переписки и отправлено не заблокированным им пользователем
+const visibleMessage = `m.id > cm.hidden_before
+	AND m.sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE user_id = cm.user_id)`
+
+type MessageService struct {
+	db *Database
+}
+
+func NewMessageService(db *Database) *MessageService {
+	return &MessageService{db: db}
+}
+
+// StartConversation начинает переписку отправителя с пользователями usernames
+// и отправляет в неё первое сообщение. Возвращает ID переписки
+func (ms *MessageService) StartConversation(senderID int, usernames []string, subject, content string) (int, error) {
+	subject = strings.TrimSpace(subject)
+	if utf8.RuneCountInString(subject) > 100 {
+		return 0, ErrLongSubject
+	}
+	content, err := validateMessage(content)
+	if err != nil {
+		return 0, err
+	}
+
+	var recipientIDs []int
+	for _, username := range usernames {
+		username = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+		if username == "" {
+			continue
+		}
+
+		var recipientID int
+		err := ms.db.DBConn.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&recipientID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return 0, fmt.Errorf("%w: %s", ErrRecipientNotFound, username)
+			}
+			return 0, err
+		}
+		if recipientID == senderID {
+			return 0, ErrMessageToSelf
+		}
+
+		blocked, err := ms.IsBlocked(recipientID, senderID)
+		if err != nil {
+			return 0, err
+		}
+		if blocked {
+			return 0, fmt.Errorf("%w: %s", ErrSenderBlocked, username)
+		}
+
+		recipientIDs = append(recipientIDs, recipientID)
+	}
+
+	recipientIDs = uniqueInts(recipientIDs)
+	if len(recipientIDs) == 0 {
+		return 0, ErrNoRecipients
+	}
+	if len(recipientIDs)+1 > MaxConversationMembers {
+		return 0, ErrTooManyRecipients
+	}
+
+	var started int
+	err = ms.db.DBConn.QueryRow(`SELECT COUNT(*) FROM conversations WHERE created_by = ? AND created > ?`,
+		senderID, time.Now().Add(-time.Hour)).Scan(&started)
+	if err != nil {
+		return 0, err
+	}
+	if started >= MaxNewConversationsPerHour {
+		return 0, ErrConversationRateLimit
+	}
+
+	tx, err := ms.db.DBConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var conversationID int
+	err = tx.QueryRow(`INSERT INTO conversations (subject, created_by, created, updated) VALUES (?, ?, ?, ?) RETURNING id`,
+		subject, senderID, now, now).Scan(&conversationID)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrMessageSendFailed, err)
+	}
+
+	for _, memberID := range append([]int{senderID}, recipientIDs...) {
+		_, err = tx.Exec(`INSERT INTO conversation_members (conversation_id, user_id) VALUES (?, ?)`,
+			conversationID, memberID)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrMessageSendFailed, err)
+		}
+	}
+
+	if _, err = insertMessage(tx, conversationID, senderID, content, now); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return conversationID, nil
+}
+
+// SendMessage отправляет сообщение в переписку. В диалоге один на один
+// заблокированный собеседником пользователь писать не может; в групповой
+// переписке его сообщения просто не видны заблокировавшему
+func (ms *MessageService) SendMessage(conversationID, senderID int, content string) (*models.Message, error) {
+	content, err := validateMessage(content)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs, err := queryIDs(ms.db.DBConn,
+		`SELECT user_id FROM conversation_members WHERE conversation_id = ?`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	isMember := false
+	for _, memberID := range memberIDs {
+		if memberID == senderID {
+			isMember = true
+		}
+	}
+	if !isMember {
+		return nil, ErrConversationNotFound
+	}
+
+	if len(memberIDs) == 2 {
+		for _, memberID := range memberIDs {
+			if memberID == senderID {
+				continue
+			}
+			blocked, err := ms.IsBlocked(memberID, senderID)
+			if err != nil {
+				return nil, err
+			}
+			if blocked {
+				return nil, ErrSenderBlocked
+			}
+		}
+	}
+
+	tx, err := ms.db.DBConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	message, err := insertMessage(tx, conversationID, senderID, content, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return message, nil
+}
+
+// insertMessage добавляет сообщение, поднимает переписку вверх списка и
+// возвращает её из архива тем участникам, которые увидят сообщение
+func insertMessage(tx *sql.Tx, conversationID, senderID int, content string, now time.Time) (*models.Message, error) {
+	message := models.Message{ConversationID: conversationID, SenderID: senderID, Content: content, Created: now}
+
+	err := tx.QueryRow(`INSERT INTO messages (conversation_id, sender_id, content, created) VALUES (?, ?, ?, ?) RETURNING id`,
+		conversationID, senderID, content, now).Scan(&message.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMessageSendFailed, err)
+	}
+
+	if _, err = tx.Exec(`UPDATE conversations SET updated = ? WHERE id = ?`, now, conversationID); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMessageSendFailed, err)
+	}
+
+	_, err = tx.Exec(`UPDATE conversation_members SET archived = 0
+					  WHERE conversation_id = ?
+						AND user_id NOT IN (SELECT user_id FROM user_blocks WHERE blocked_id = ?)`,
+		conversationID, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMessageSendFailed, err)
+	}
+
+	// Своё сообщение отправитель уже прочитал
+	_, err = tx.Exec(`UPDATE conversation_members SET last_read_id = ? WHERE conversation_id = ? AND user_id = ?`,
+		message.ID, conversationID, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMessageSendFailed, err)
+	}
+
+	return &message, nil
+}
+
+// GetConversations получает переписки пользователя - входящие или архив,
+// последние активные сначала. Удалённые пользователем переписки возвращаются,
+// только если в них появились новые сообщения
+func (ms *MessageService) GetConversations(userID int, archived bool) ([]*models.Conversation, error) {
+	query := `SELECT c.id, c.subject, c.created_by, c.created, c.updated, cm.archived,
+					 (SELECT COUNT(*) FROM messages m
+					  WHERE m.conversation_id = c.id AND m.id > cm.last_read_id
+						AND m.sender_id != cm.user_id AND ` + visibleMessage + `)
+			  FROM conversations c
+			  JOIN conversation_members cm ON cm.conversation_id = c.id
+			  WHERE cm.user_id = ? AND cm.archived = ?
+				AND EXISTS (SELECT 1 FROM messages m WHERE m.conversation_id = c.id AND ` + visibleMessage + `)
+			  ORDER BY c.updated DESC, c.id DESC`
+
+	rows, err := ms.db.DBConn.Query(query, userID, archived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []*models.Conversation
+	for rows.Next() {
+		var conversation models.Conversation
+		err := rows.Scan(&conversation.ID, &conversation.Subject, &conversation.CreatedBy, &conversation.Created,
+			&conversation.Updated, &conversation.Archived, &conversation.Unread)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, &conversation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, conversation := range conversations {
+		if conversation.Members, err = ms.getMembers(conversation.ID); err != nil {
+			return nil, err
+		}
+		if conversation.LastMessage, err = ms.getLastMessage(conversation.ID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return conversations, nil
+}
+
+// GetConversation получает переписку, если пользователь в ней участвует
+func (ms *MessageService) GetConversation(conversationID, userID int) (*models.Conversation, error) {
+	var conversation models.Conversation
+	query := `SELECT c.id, c.subject, c.created_by, c.created, c.updated, cm.archived
+			  FROM conversations c
+			  JOIN conversation_members cm ON cm.conversation_id = c.id
+			  WHERE c.id = ? AND cm.user_id = ?`
+
+	err := ms.db.DBConn.QueryRow(query, conversationID, userID).Scan(&conversation.ID, &conversation.Subject,
+		&conversation.CreatedBy, &conversation.Created, &conversation.Updated, &conversation.Archived)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+
+	if conversation.Members, err = ms.getMembers(conversation.ID); err != nil {
+		return nil, err
+	}
+
+	return &conversation, nil
+}
+
+// GetMessages получает видимые пользователю сообщения переписки в порядке
+// отправки. У каждого сообщения отмечено, кто из участников его прочитал
+func (ms *MessageService) GetMessages(conversationID, userID int) ([]*models.Message, error) {
+	type reader struct {
+		id         int
+		username   string
+		lastReadID int
+	}
+
+	rows, err := ms.db.DBConn.Query(`SELECT cm.user_id, u.username, cm.last_read_id
+									FROM conversation_members cm
+									JOIN users u ON cm.user_id = u.id
+									WHERE cm.conversation_id = ?
+									ORDER BY u.username`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readers []reader
+	for rows.Next() {
+		var r reader
+		if err := rows.Scan(&r.id, &r.username, &r.lastReadID); err != nil {
+			return nil, err
+		}
+		readers = append(readers, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	query := `SELECT m.id, m.conversation_id, m.sender_id, u.username, m.content, m.created
+			  FROM messages m
+			  JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ?
+			  JOIN users u ON m.sender_id = u.id
+			  WHERE m.conversation_id = ? AND ` + visibleMessage + `
+			  ORDER BY m.id`
+
+	rows, err = ms.db.DBConn.Query(query, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range readers {
+			if r.id != message.SenderID && r.lastReadID >= message.ID {
+				message.ReadBy = append(message.ReadBy, r.username)
+			}
+		}
+		messages = append(messages, message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// MarkRead отмечает все сообщения переписки прочитанными пользователем
+func (ms *MessageService) MarkRead(conversationID, userID int) error {
+	_, err := ms.db.DBConn.Exec(`UPDATE conversation_members
+								 SET last_read_id = (SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ?)
+								 WHERE conversation_id = ? AND user_id = ?`, conversationID, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка отметки сообщений: %v", err)
+	}
+	return nil
+}
+
+// CountUnread возвращает количество непрочитанных пользователем сообщений
+func (ms *MessageService) CountUnread(userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*)
+			  FROM messages m
+			  JOIN conversation_members cm ON cm.conversation_id = m.conversation_id
+			  WHERE cm.user_id = ? AND m.id > cm.last_read_id AND m.sender_id != cm.user_id AND ` + visibleMessage
+	err := ms.db.DBConn.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
+// SetArchived переносит переписку в архив пользователя или возвращает из него
+func (ms *MessageService) SetArchived(conversationID, userID int, archived bool) error {
+	result, err := ms.db.DBConn.Exec(`UPDATE conversation_members SET archived = ? WHERE conversation_id = ? AND user_id = ?`,
+		archived, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка архивации переписки: %v", err)
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrConversationNotFound
+	}
+
+	return nil
+}
+
+// DeleteConversation удаляет переписку у пользователя: её история скрывается
+// только для него. Когда переписку удалили все участники, она удаляется из базы
+func (ms *MessageService) DeleteConversation(conversationID, userID int) error {
+	tx, err := ms.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var lastID int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ?`, conversationID).Scan(&lastID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления переписки: %v", err)
+	}
+
+	result, err := tx.Exec(`UPDATE conversation_members SET hidden_before = ?, last_read_id = ?, archived = 0
+							WHERE conversation_id = ? AND user_id = ?`, lastID, lastID, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления переписки: %v", err)
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrConversationNotFound
+	}
+
+	var remaining int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM conversation_members WHERE conversation_id = ? AND hidden_before < ?`,
+		conversationID, lastID).Scan(&remaining)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления переписки: %v", err)
+	}
+
+	// Внешние ключи в SQLite выключены, поэтому каскадное удаление делаем сами
+	if remaining == 0 {
+		for _, query := range []string{
+			`DELETE FROM messages WHERE conversation_id = ?`,
+			`DELETE FROM conversation_members WHERE conversation_id = ?`,
+			`DELETE FROM conversations WHERE id = ?`,
+		} {
+			if _, err = tx.Exec(query, conversationID); err != nil {
+				return fmt.Errorf("ошибка удаления переписки: %v", err)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// BlockUser запрещает пользователю blockedID писать пользователю userID
+func (ms *MessageService) BlockUser(userID, blockedID int) error {
+	if userID == blockedID {
+		return ErrBlockSelf
+	}
+
+	_, err := ms.db.DBConn.Exec(`INSERT OR IGNORE INTO user_blocks (user_id, blocked_id, created) VALUES (?, ?, ?)`,
+		userID, blockedID, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка блокировки пользователя: %v", err)
+	}
+	return nil
+}
+
+// UnblockUser снимает блокировку; скрытые сообщения снова становятся видны
+func (ms *MessageService) UnblockUser(userID, blockedID int) error {
+	_, err := ms.db.DBConn.Exec(`DELETE FROM user_blocks WHERE user_id = ? AND blocked_id = ?`, userID, blockedID)
+	if err != nil {
+		return fmt.Errorf("ошибка разблокировки пользователя: %v", err)
+	}
+	return nil
+}
+
+// IsBlocked сообщает, заблокировал ли пользователь userID пользователя blockedID
+func (ms *MessageService) IsBlocked(userID, blockedID int) (bool, error) {
+	var exists int
+	err := ms.db.DBConn.QueryRow(`SELECT 1 FROM user_blocks WHERE user_id = ? AND blocked_id = ?`,
+		userID, blockedID).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetBlockedUsers получает заблокированных пользователем отправителей
+func (ms *MessageService) GetBlockedUsers(userID int) ([]*models.User, error) {
+	query := `SELECT u.id, u.username, u.role, u.created
+			  FROM user_blocks b
+			  JOIN users u ON b.blocked_id = u.id
+			  WHERE b.user_id = ?
+			  ORDER BY u.username`
+	return ms.queryUsers(query, userID)
+}
+
+// getMembers получает участников переписки по алфавиту
+func (ms *MessageService) getMembers(conversationID int) ([]*models.User, error) {
+	query := `SELECT u.id, u.username, u.role, u.created
+			  FROM conversation_members cm
+			  JOIN users u ON cm.user_id = u.id
+			  WHERE cm.conversation_id = ?
+			  ORDER BY u.username`
+	return ms.queryUsers(query, conversationID)
+}
+
+// queryUsers выполняет запрос, возвращающий id, username, role и created пользователей
+func (ms *MessageService) queryUsers(query string, args ...interface{}) ([]*models.User, error) {
+	rows, err := ms.db.DBConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.Created); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// getLastMessage получает последнее видимое пользователю сообщение переписки
+func (ms *MessageService) getLastMessage(conversationID, userID int) (*models.Message, error) {
+	query := `SELECT m.id, m.conversation_id, m.sender_id, u.username, m.content, m.created
+			  FROM messages m
+			  JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ?
+			  JOIN users u ON m.sender_id = u.id
+			  WHERE m.conversation_id = ? AND ` + visibleMessage + `
+			  ORDER BY m.id DESC
+			  LIMIT 1`
+
+	message, err := scanMessage(ms.db.DBConn.QueryRow(query, userID, conversationID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+// scanMessage читает сообщение из строки результата
+func scanMessage(row rowScanner) (*models.Message, error) {
+	var message models.Message
+	err := row.Scan(&message.ID, &message.ConversationID, &message.SenderID, &message.SenderName,
+		&message.Content, &message.Created)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// validateMessage проверяет текст сообщения и возвращает его без лишних пробелов
+func validateMessage(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", ErrEmptyMessage
+	}
+	if utf8.RuneCountInString(content) > 5000 {
+		return "", ErrLongMessage
+	}
+	return content, nil
+}
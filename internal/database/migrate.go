@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// columnMigration - столбец, добавленный в forum.sql к уже существующей таблице.
+// CREATE TABLE IF NOT EXISTS не меняет таблицы старых баз, поэтому такие
+// столбцы добавляются отдельно через ALTER TABLE
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+// columnMigrations перечисляет столбцы в порядке их появления в схеме
+var columnMigrations = []columnMigration{
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin'))"},
+	{"posts", "version", "INTEGER NOT NULL DEFAULT 1"},
+	{"posts", "content_html", "TEXT NOT NULL DEFAULT ''"},
+	{"comments", "content_html", "TEXT NOT NULL DEFAULT ''"},
+	{"attachments", "width", "INTEGER NOT NULL DEFAULT 0"},
+	{"attachments", "height", "INTEGER NOT NULL DEFAULT 0"},
+	{"comments", "parent_id", "INTEGER REFERENCES comments(id) ON DELETE SET NULL"},
+	{"posts", "published", "BOOLEAN NOT NULL DEFAULT 1"},
+	{"posts", "publish_at", "DATETIME"},
+	{"users", "likes_public", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"users", "avatar_type", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "avatar_version", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "reputation", "INTEGER NOT NULL DEFAULT 0"},
+	{"likes", "points", "INTEGER NOT NULL DEFAULT 0"},
+	{"notifications", "badge", "TEXT NOT NULL DEFAULT ''"},
+	{"categories", "parent_id", "INTEGER REFERENCES categories(id) ON DELETE SET NULL"},
+	{"posts", "review", "TEXT"},
+	{"comments", "review", "TEXT"},
+}
+
+// Migrate приводит базу к схеме из schemaPath: добавляет недостающие столбцы
+// в старые таблицы, затем создаёт недостающие таблицы, индексы и записи.
+// Повторный запуск ничего не меняет. Возвращает число добавленных столбцов
+func (d *Database) Migrate(schemaPath string) (int, error) {
+	schema, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения файла схемы %s: %v", schemaPath, err)
+	}
+
+	// Схема переключает PRAGMA foreign_keys, а она действует на соединение:
+	// выполняем всё на отдельном соединении и возвращаем ему прежнее значение
+	ctx := context.Background()
+	conn, err := d.DBConn.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var foreignKeys bool
+	if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(ctx, fmt.Sprintf("PRAGMA foreign_keys = %t", foreignKeys))
+
+	added, err := addColumns(ctx, conn)
+	if err != nil {
+		return added, err
+	}
+
+	if _, err := conn.ExecContext(ctx, string(schema)); err != nil {
+		return added, fmt.Errorf("ошибка выполнения схемы: %v", err)
+	}
+
+	return added, nil
+}
+
+// addColumns добавляет столбцы из columnMigrations, которых нет в таблицах.
+// Таблицы, которых ещё нет, создаст сама схема
+func addColumns(ctx context.Context, conn *sql.Conn) (int, error) {
+	added := 0
+	for _, m := range columnMigrations {
+		columns, err := tableColumns(ctx, conn, m.table)
+		if err != nil {
+			return added, err
+		}
+		if len(columns) == 0 || columns[m.column] {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return added, fmt.Errorf("ошибка добавления столбца %s.%s: %v", m.table, m.column, err)
+		}
+		added++
+	}
+
+	return added, nil
+}
+
+// tableColumns возвращает имена столбцов таблицы (пусто, если таблицы нет)
+func tableColumns(ctx context.Context, conn *sql.Conn, table string) (map[string]bool, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+
+	return columns, rows.Err()
+}
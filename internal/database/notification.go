@@ -0,0 +1,418 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"log"
+	"strings"
+	"time"
+)
+
+var ErrUnknownNotificationType = errors.New("неизвестный тип уведомлений")
+
+// execer - общее у *sql.DB и *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type NotificationService struct {
+	db *Database
+}
+
+func NewNotificationService(db *Database) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// GetUserNotifications получает последние уведомления пользователя
+func (ns *NotificationService) GetUserNotifications(userID, limit int) ([]*models.Notification, error) {
+	query := `SELECT n.id, n.user_id, n.actor_id, n.type, n.post_id, n.comment_id, n.badge, n.created, n.read_at,
+					 u.username, COALESCE(p.title, '')
+			  FROM notifications n
+			  JOIN users u ON n.actor_id = u.id
+			  LEFT JOIN posts p ON n.post_id = p.id
+			  WHERE n.user_id = ?
+			  ORDER BY n.created DESC, n.id DESC
+			  LIMIT ?`
+
+	rows, err := ns.db.DBConn.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var postID, commentID sql.NullInt64
+		var readAt sql.NullTime
+
+		err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.Type, &postID, &commentID, &n.Badge,
+			&n.Created, &readAt, &n.ActorName, &n.PostTitle)
+		if err != nil {
+			return nil, err
+		}
+
+		if postID.Valid {
+			id := int(postID.Int64)
+			n.PostID = &id
+		}
+		if commentID.Valid {
+			id := int(commentID.Int64)
+			n.CommentID = &id
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+
+		notifications = append(notifications, &n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// GetUserNotificationGroups получает последние уведомления, объединённые по типу
+// и объекту. Прочитанные и непрочитанные события группируются отдельно
+func (ns *NotificationService) GetUserNotificationGroups(userID, limit int) ([]*models.NotificationGroup, error) {
+	notifications, err := ns.GetUserNotifications(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*models.NotificationGroup
+	index := map[string]*models.NotificationGroup{}
+
+	// Уведомления отсортированы от новых к старым, поэтому первое
+	// уведомление группы задаёт её время и порядок
+	for _, n := range notifications {
+		key := fmt.Sprintf("%s:%d:%d:%s:%t", n.Type, intValue(n.PostID), intValue(n.CommentID), n.Badge, n.ReadAt == nil)
+
+		group, ok := index[key]
+		if !ok {
+			group = &models.NotificationGroup{
+				Type:      n.Type,
+				PostID:    n.PostID,
+				CommentID: n.CommentID,
+				PostTitle: n.PostTitle,
+				Badge:     n.Badge,
+				Unread:    n.ReadAt == nil,
+				Latest:    n.Created,
+			}
+			index[key] = group
+			groups = append(groups, group)
+		}
+
+		group.IDs = append(group.IDs, n.ID)
+		if !containsString(group.Actors, n.ActorName) {
+			group.Actors = append(group.Actors, n.ActorName)
+		}
+	}
+
+	return groups, nil
+}
+
+// CountUnread возвращает количество непрочитанных уведомлений
+func (ns *NotificationService) CountUnread(userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`
+	err := ns.db.DBConn.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead отмечает прочитанными уведомления пользователя с указанными ID
+func (ns *NotificationService) MarkRead(userID int, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := []interface{}{time.Now(), userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	query := `UPDATE notifications SET read_at = ?
+			  WHERE user_id = ? AND read_at IS NULL AND id IN (` + placeholders + `)`
+	if _, err := ns.db.DBConn.Exec(query, args...); err != nil {
+		return fmt.Errorf("ошибка обновления уведомлений: %v", err)
+	}
+	return nil
+}
+
+// MarkAllRead отмечает прочитанными все уведомления пользователя
+func (ns *NotificationService) MarkAllRead(userID int) error {
+	query := `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	if _, err := ns.db.DBConn.Exec(query, time.Now(), userID); err != nil {
+		return fmt.Errorf("ошибка обновления уведомлений: %v", err)
+	}
+	return nil
+}
+
+// GetSettings возвращает для каждого типа уведомлений, включён ли он
+func (ns *NotificationService) GetSettings(userID int) ([]*models.NotificationSetting, error) {
+	rows, err := ns.db.DBConn.Query(`SELECT type FROM notification_opt_outs WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disabled := map[string]bool{}
+	for rows.Next() {
+		var notificationType string
+		if err := rows.Scan(&notificationType); err != nil {
+			return nil, err
+		}
+		disabled[notificationType] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	settings := make([]*models.NotificationSetting, 0, len(models.NotificationTypes))
+	for _, notificationType := range models.NotificationTypes {
+		settings = append(settings, &models.NotificationSetting{
+			Type:    notificationType,
+			Enabled: !disabled[notificationType],
+		})
+	}
+
+	return settings, nil
+}
+
+// SetEnabledTypes включает перечисленные типы уведомлений и отключает остальные
+func (ns *NotificationService) SetEnabledTypes(userID int, enabled []string) error {
+	for _, notificationType := range enabled {
+		if !containsString(models.NotificationTypes, notificationType) {
+			return ErrUnknownNotificationType
+		}
+	}
+
+	tx, err := ns.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM notification_opt_outs WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("ошибка сохранения настроек уведомлений: %v", err)
+	}
+
+	for _, notificationType := range models.NotificationTypes {
+		if containsString(enabled, notificationType) {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO notification_opt_outs (user_id, type) VALUES (?, ?)`, userID, notificationType)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения настроек уведомлений: %v", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// NotificationChannel - способ доставки уведомлений: в приложении, по почте и т.д.
+type NotificationChannel interface {
+	// Name возвращает имя канала для журналов
+	Name() string
+	// Deliver доставляет одно уведомление получателю
+	Deliver(n *models.Notification) error
+}
+
+// InAppChannel сохраняет уведомления в базе для страницы /notifications
+type InAppChannel struct {
+	db *Database
+}
+
+func NewInAppChannel(db *Database) *InAppChannel {
+	return &InAppChannel{db: db}
+}
+
+func (c *InAppChannel) Name() string {
+	return "in-app"
+}
+
+func (c *InAppChannel) Deliver(n *models.Notification) error {
+	return insertNotification(c.db.DBConn, n)
+}
+
+// deliver отправляет уведомления во все каналы, пропуская уведомления самому
+// себе (кроме автоматически выданных значков), отключённые получателем типы,
+// уведомления о постах, которые получатель не может просматривать, и повторы
+// ещё не прочитанных уведомлений. Ошибки доставки не отменяют действие,
+// вызвавшее уведомление, поэтому только пишутся в журнал
+func (d *Database) deliver(notifications []*models.Notification) {
+	channels := d.Channels
+	if len(channels) == 0 {
+		channels = []NotificationChannel{NewInAppChannel(d)}
+	}
+
+	for _, n := range notifications {
+		if n.UserID == n.ActorID && n.Type != models.NotificationBadge {
+			continue
+		}
+
+		var disabled bool
+		query := `SELECT EXISTS(SELECT 1 FROM notification_opt_outs WHERE user_id = ? AND type = ?)`
+		if err := d.DBConn.QueryRow(query, n.UserID, n.Type).Scan(&disabled); err != nil {
+			log.Printf("Ошибка проверки настроек уведомлений пользователя %d: %v", n.UserID, err)
+			continue
+		}
+		if disabled {
+			continue
+		}
+
+		// Повтор уже доставлен во все каналы, в том числе письмом
+		var duplicate bool
+		query = `SELECT EXISTS(SELECT 1 FROM notifications WHERE ` + sameUnreadNotification + `)`
+		err := d.DBConn.QueryRow(query, n.UserID, n.ActorID, n.Type, n.PostID, n.CommentID, n.Badge).Scan(&duplicate)
+		if err != nil {
+			log.Printf("Ошибка проверки повтора уведомления пользователю %d: %v", n.UserID, err)
+			continue
+		}
+		if duplicate {
+			continue
+		}
+
+		// О постах из закрытых для получателя категорий не уведомляем
+		if n.PostID != nil {
+			allowed, err := d.canAccessPost(n.UserID, *n.PostID, models.CategoryView)
+			if err != nil {
+				log.Printf("Ошибка проверки прав пользователя %d на пост %d: %v", n.UserID, *n.PostID, err)
+				continue
+			}
+			if !allowed {
+				continue
+			}
+		}
+
+		for _, channel := range channels {
+			if err := channel.Deliver(n); err != nil {
+				log.Printf("Ошибка доставки уведомления (%s) пользователю %d: %v", channel.Name(), n.UserID, err)
+			}
+		}
+	}
+}
+
+// sameUnreadNotification - условие SQL для непрочитанного уведомления с теми же
+// получателем, участником, типом, постом, комментарием и значком
+const sameUnreadNotification = `user_id = ? AND actor_id = ? AND type = ? AND read_at IS NULL
+								AND post_id IS ? AND comment_id IS ? AND badge = ?`
+
+// insertNotification создаёт уведомление в приложении, если у получателя ещё нет
+// такого же непрочитанного уведомления от того же участника
+func insertNotification(db execer, n *models.Notification) error {
+	query := `INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id, badge, created)
+			  SELECT ?, ?, ?, ?, ?, ?, ?
+			  WHERE NOT EXISTS (SELECT 1 FROM notifications WHERE ` + sameUnreadNotification + `)`
+
+	_, err := db.Exec(query,
+		n.UserID, n.ActorID, n.Type, n.PostID, n.CommentID, n.Badge, time.Now(),
+		n.UserID, n.ActorID, n.Type, n.PostID, n.CommentID, n.Badge)
+	if err != nil {
+		return fmt.Errorf("ошибка создания уведомления: %v", err)
+	}
+	return nil
+}
+
+// commentNotifications собирает уведомления о новом комментарии: автору
+// родительского комментария - об ответе, автору поста - о комментарии,
+// остальным подписчикам поста - о новом комментарии в отслеживаемом посте.
+// Каждый получатель получает не больше одного уведомления
+func commentNotifications(db execer, postID int, parentID *int, authorID int) ([]*models.Notification, error) {
+	var notifications []*models.Notification
+	notified := map[int]bool{authorID: true}
+
+	if parentID != nil {
+		var parentAuthorID int
+		err := db.QueryRow(`SELECT user_id FROM comments WHERE id = ?`, *parentID).Scan(&parentAuthorID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка поиска автора комментария: %v", err)
+		}
+
+		if !notified[parentAuthorID] {
+			notified[parentAuthorID] = true
+			notifications = append(notifications, &models.Notification{
+				UserID:    parentAuthorID,
+				ActorID:   authorID,
+				Type:      models.NotificationReply,
+				PostID:    &postID,
+				CommentID: parentID,
+			})
+		}
+	}
+
+	var postAuthorID int
+	if err := db.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&postAuthorID); err != nil {
+		return nil, fmt.Errorf("ошибка поиска автора поста: %v", err)
+	}
+
+	if !notified[postAuthorID] {
+		notified[postAuthorID] = true
+		notifications = append(notifications, &models.Notification{
+			UserID:  postAuthorID,
+			ActorID: authorID,
+			Type:    models.NotificationComment,
+			PostID:  &postID,
+		})
+	}
+
+	subscriberIDs, err := postSubscriberIDs(db, postID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска подписчиков поста: %v", err)
+	}
+
+	for _, subscriberID := range subscriberIDs {
+		if notified[subscriberID] {
+			continue
+		}
+		notified[subscriberID] = true
+		notifications = append(notifications, &models.Notification{
+			UserID:  subscriberID,
+			ActorID: authorID,
+			Type:    models.NotificationWatchedPost,
+			PostID:  &postID,
+		})
+	}
+
+	return notifications, nil
+}
+
+// intValue возвращает значение указателя или 0
+func intValue(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// containsString проверяет наличие строки в списке
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt проверяет наличие числа в списке
+func containsInt(list []int, value int) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
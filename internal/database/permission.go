@@ -0,0 +1,365 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCategoryAction = errors.New("неизвестное действие с категорией")
+	ErrUnknownRole           = errors.New("неизвестная роль")
+	ErrCategoryPostForbidden = errors.New("нет прав публиковать в выбранной категории")
+	ErrCommentForbidden      = errors.New("нет прав комментировать пост в этой категории")
+)
+
+// categoryAccess - категории, в которых пользователю запрещены действия
+type categoryAccess struct {
+	denied map[string]map[int]bool // действие -> ID категорий
+}
+
+// allowed сообщает, разрешено ли действие во всех перечисленных категориях.
+// Пост без категорий ничем не ограничен
+func (a *categoryAccess) allowed(action string, categoryIDs []int) bool {
+	for _, id := range categoryIDs {
+		if a.denied[action][id] {
+			return false
+		}
+	}
+	return true
+}
+
+// hiddenPostsFilter возвращает условие SQL для поста p: у поста нет ни одной
+// категории, которую пользователь не может просматривать. ID категорий взяты
+// из базы и вставляются как числа, поэтому параметры не нужны
+func (a *categoryAccess) hiddenPostsFilter() string {
+	if len(a.denied[models.CategoryView]) == 0 {
+		return "1"
+	}
+
+	ids := make([]string, 0, len(a.denied[models.CategoryView]))
+	for id := range a.denied[models.CategoryView] {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	sort.Strings(ids)
+
+	return `NOT EXISTS (SELECT 1 FROM post_categories hc
+						WHERE hc.post_id = p.id AND hc.category_id IN (` + strings.Join(ids, ",") + `))`
+}
+
+// categoryRule - кому разрешено действие в категории
+type categoryRule struct {
+	roles  map[string]bool
+	groups map[int]bool
+}
+
+// ruleFor возвращает правило действия в категории, создавая его при необходимости
+func ruleFor(rules map[string]map[int]*categoryRule, action string, categoryID int) *categoryRule {
+	if rules[action] == nil {
+		rules[action] = map[int]*categoryRule{}
+	}
+	if rules[action][categoryID] == nil {
+		rules[action][categoryID] = &categoryRule{roles: map[string]bool{}, groups: map[int]bool{}}
+	}
+	return rules[action][categoryID]
+}
+
+// categoryAccess вычисляет права пользователя userID (0 - гость) во всех категориях.
+// Правила действия берутся у категории, а если их нет - у ближайшего предка с правилами.
+// Действие разрешено, если правило допускает роль пользователя или одну из его групп
+func (d *Database) categoryAccess(userID int) (*categoryAccess, error) {
+	access := &categoryAccess{denied: map[string]map[int]bool{}}
+
+	role := models.RoleGuest
+	if userID != 0 {
+		err := d.DBConn.QueryRow(`SELECT role FROM users WHERE id = ?`, userID).Scan(&role)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+	if role == models.RoleAdmin {
+		return access, nil
+	}
+
+	groupIDs, err := queryIDs(d.DBConn, `SELECT group_id FROM group_members WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := map[int]int{}
+	rows, err := d.DBConn.Query(`SELECT id, COALESCE(parent_id, 0) FROM categories`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, parentID int
+		if err := rows.Scan(&id, &parentID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		parents[id] = parentID
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	rules := map[string]map[int]*categoryRule{}
+	rows, err = d.DBConn.Query(`SELECT category_id, action, role FROM category_permissions`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var categoryID int
+		var action, ruleRole string
+		if err := rows.Scan(&categoryID, &action, &ruleRole); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ruleFor(rules, action, categoryID).roles[ruleRole] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = d.DBConn.Query(`SELECT category_id, action, group_id FROM category_group_permissions`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var categoryID, groupID int
+		var action string
+		if err := rows.Scan(&categoryID, &action, &groupID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ruleFor(rules, action, categoryID).groups[groupID] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	for _, action := range models.CategoryActions {
+		access.denied[action] = map[int]bool{}
+		for id := range parents {
+			// seen защищает от зацикленных данных
+			seen := map[int]bool{}
+			for current := id; current != 0 && !seen[current]; current = parents[current] {
+				seen[current] = true
+				if rule, ok := rules[action][current]; ok {
+					if !rule.allows(role, groupIDs) {
+						access.denied[action][id] = true
+					}
+					break
+				}
+			}
+		}
+	}
+
+	return access, nil
+}
+
+// allows сообщает, разрешает ли правило действие роли role или участнику групп groupIDs
+func (r *categoryRule) allows(role string, groupIDs []int) bool {
+	if r.roles[role] {
+		return true
+	}
+	for _, id := range groupIDs {
+		if r.groups[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenPostsFilter возвращает условие SQL, скрывающее посты p из категорий,
+// которые пользователь userID (0 - гость) не может просматривать
+func (d *Database) hiddenPostsFilter(userID int) (string, error) {
+	access, err := d.categoryAccess(userID)
+	if err != nil {
+		return "", err
+	}
+	return access.hiddenPostsFilter(), nil
+}
+
+// canAccessPost проверяет, разрешено ли пользователю действие во всех категориях поста
+func (d *Database) canAccessPost(userID, postID int, action string) (bool, error) {
+	categoryIDs, err := queryIDs(d.DBConn, `SELECT category_id FROM post_categories WHERE post_id = ?`, postID)
+	if err != nil {
+		return false, err
+	}
+	return d.canAccessCategories(userID, categoryIDs, action)
+}
+
+// canAccessCategories проверяет, разрешено ли пользователю действие во всех категориях
+func (d *Database) canAccessCategories(userID int, categoryIDs []int, action string) (bool, error) {
+	if len(categoryIDs) == 0 {
+		return true, nil
+	}
+	access, err := d.categoryAccess(userID)
+	if err != nil {
+		return false, err
+	}
+	return access.allowed(action, categoryIDs), nil
+}
+
+// CanAccess проверяет, разрешено ли пользователю userID (0 - гость) действие в категории
+func (cs *CategoryService) CanAccess(userID, categoryID int, action string) (bool, error) {
+	return cs.db.canAccessCategories(userID, []int{categoryID}, action)
+}
+
+// FilterCategories оставляет категории, в которых пользователю разрешено действие
+func (cs *CategoryService) FilterCategories(userID int, categories []*models.Category, action string) ([]*models.Category, error) {
+	access, err := cs.db.categoryAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []*models.Category
+	for _, category := range categories {
+		if access.allowed(action, []int{category.ID}) {
+			allowed = append(allowed, category)
+		}
+	}
+	return allowed, nil
+}
+
+// GetPermissions получает собственные правила категории по всем действиям
+// в порядке CategoryActions
+func (cs *CategoryService) GetPermissions(categoryID int) ([]*models.CategoryPermission, error) {
+	rules := map[string]map[int]*categoryRule{}
+
+	rows, err := cs.db.DBConn.Query(`SELECT action, role FROM category_permissions WHERE category_id = ?`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var action, role string
+		if err := rows.Scan(&action, &role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ruleFor(rules, action, categoryID).roles[role] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = cs.db.DBConn.Query(`SELECT action, group_id FROM category_group_permissions WHERE category_id = ?`,
+		categoryID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var action string
+		var groupID int
+		if err := rows.Scan(&action, &groupID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ruleFor(rules, action, categoryID).groups[groupID] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	var permissions []*models.CategoryPermission
+	for _, action := range models.CategoryActions {
+		permission := &models.CategoryPermission{Action: action, Inherit: true}
+		if rule, ok := rules[action][categoryID]; ok {
+			permission.Inherit = false
+			permission.Roles = rule.roles
+			permission.Groups = rule.groups
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, nil
+}
+
+// SetPermissions заменяет правила категории для действия: роли roles и группы
+// groupIDs. roles = nil снимает ограничения: действие снова наследуется от предков,
+// а группы не сохраняются. Пустой, но не nil список ролей без групп запрещает
+// действие всем, кроме администраторов
+func (cs *CategoryService) SetPermissions(categoryID int, action string, roles []string, groupIDs []int) error {
+	if !containsString(models.CategoryActions, action) {
+		return ErrUnknownCategoryAction
+	}
+	for _, role := range roles {
+		if !containsString(models.Roles, role) {
+			return ErrUnknownRole
+		}
+	}
+
+	tx, err := cs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM category_permissions WHERE category_id = ? AND action = ?`,
+		`DELETE FROM category_group_permissions WHERE category_id = ? AND action = ?`,
+	} {
+		if _, err = tx.Exec(query, categoryID, action); err != nil {
+			return fmt.Errorf("ошибка сохранения прав категории: %v", err)
+		}
+	}
+
+	if roles == nil {
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+		}
+		return nil
+	}
+
+	// Администраторам доступно всё, а их строка отличает "запрещено всем"
+	// от "правил нет"
+	if !containsString(roles, models.RoleAdmin) {
+		roles = append(roles, models.RoleAdmin)
+	}
+
+	for _, role := range roles {
+		_, err = tx.Exec(`INSERT INTO category_permissions (category_id, action, role) VALUES (?, ?, ?)`,
+			categoryID, action, role)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения прав категории: %v", err)
+		}
+	}
+
+	seen := map[int]bool{}
+	for _, groupID := range groupIDs {
+		if seen[groupID] {
+			continue
+		}
+		seen[groupID] = true
+
+		result, err := tx.Exec(`INSERT INTO category_group_permissions (category_id, action, group_id)
+								SELECT ?, ?, id FROM user_groups WHERE id = ?`, categoryID, action, groupID)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения прав категории: %v", err)
+		}
+		if inserted, _ := result.RowsAffected(); inserted == 0 {
+			return ErrGroupNotFound
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrPollNotFound      = errors.New("опрос не найден")
+	ErrPollExists        = errors.New("к посту уже прикреплён опрос")
+	ErrPollCreateFailed  = errors.New("ошибка создания опроса")
+	ErrEmptyPollQuestion = errors.New("вопрос опроса не может быть пустым")
+	ErrLongPollQuestion  = errors.New("вопрос опроса не должен превышать 255 символов")
+	ErrPollOptionsCount  = errors.New("в опросе должно быть от 2 до 10 вариантов")
+	ErrLongPollOption    = errors.New("вариант ответа не должен превышать 100 символов")
+	ErrDuplicatePollOpt  = errors.New("варианты ответа не должны повторяться")
+	ErrPollClosingInPast = errors.New("время закрытия опроса должно быть в будущем")
+	ErrPollClosed        = errors.New("опрос закрыт")
+	ErrEmptyPollVote     = errors.New("выберите хотя бы один вариант")
+	ErrSingleChoicePoll  = errors.New("в этом опросе можно выбрать только один вариант")
+	ErrInvalidPollOption = errors.New("вариант не относится к опросу")
+	ErrPollVoteFailed    = errors.New("ошибка сохранения голоса")
+	ErrNotPollPostAuthor = errors.New("прикрепить опрос может только автор поста")
+)
+
+const (
+	MinPollOptions = 2
+	MaxPollOptions = 10
+)
+
+type PollService struct {
+	db *Database
+}
+
+func NewPollService(db *Database) *PollService {
+	return &PollService{db: db}
+}
+
+// CreatePoll прикрепляет опрос к посту. Пустые варианты отбрасываются
+func (ps *PollService) CreatePoll(postID, userID int, question string, options []string,
+	multiple, resultsAfterVote bool, closesAt *time.Time) (*models.Poll, error) {
+
+	if !NewPostService(ps.db).isPostAuthor(postID, userID) {
+		return nil, ErrNotPollPostAuthor
+	}
+
+	question = strings.TrimSpace(question)
+	options, err := ps.validatePoll(question, options, closesAt)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ps.db.DBConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	query := `INSERT INTO polls (post_id, question, multiple, results_after_vote, closes_at, created)
+			  VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.Exec(query, postID, question, multiple, resultsAfterVote, closesAt, now)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrPollExists
+		}
+		return nil, fmt.Errorf("%w: %v", ErrPollCreateFailed, err)
+	}
+
+	pollID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPollCreateFailed, err)
+	}
+
+	for i, text := range options {
+		_, err = tx.Exec(`INSERT INTO poll_options (poll_id, text, position) VALUES (?, ?, ?)`,
+			pollID, text, i)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPollCreateFailed, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return ps.GetPostPoll(postID, userID)
+}
+
+// GetPostPoll получает опрос поста с результатами и выбором пользователя
+// userID (0 для гостя)
+func (ps *PollService) GetPostPoll(postID, userID int) (*models.Poll, error) {
+	var poll models.Poll
+	var closesAt sql.NullTime
+
+	query := `SELECT id, post_id, question, multiple, results_after_vote, closes_at, created
+			  FROM polls WHERE post_id = ?`
+
+	err := ps.db.DBConn.QueryRow(query, postID).Scan(&poll.ID, &poll.PostID, &poll.Question,
+		&poll.Multiple, &poll.ResultsAfterVote, &closesAt, &poll.Created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPollNotFound
+		}
+		return nil, err
+	}
+
+	if closesAt.Valid {
+		poll.ClosesAt = &closesAt.Time
+	}
+
+	if err := ps.loadResults(&poll, userID); err != nil {
+		return nil, err
+	}
+
+	return &poll, nil
+}
+
+// Vote сохраняет голос пользователя. Повторный вызов заменяет прежний выбор,
+// пока опрос не закрыт
+func (ps *PollService) Vote(pollID, userID int, optionIDs []int) error {
+	if len(optionIDs) == 0 {
+		return ErrEmptyPollVote
+	}
+
+	tx, err := ps.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var multiple bool
+	var closesAt sql.NullTime
+	err = tx.QueryRow(`SELECT multiple, closes_at FROM polls WHERE id = ?`, pollID).Scan(&multiple, &closesAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPollNotFound
+		}
+		return err
+	}
+
+	now := time.Now()
+	if closesAt.Valid && !now.Before(closesAt.Time) {
+		return ErrPollClosed
+	}
+
+	optionIDs = uniqueInts(optionIDs)
+	if !multiple && len(optionIDs) > 1 {
+		return ErrSingleChoicePoll
+	}
+
+	for _, optionID := range optionIDs {
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM poll_options WHERE id = ? AND poll_id = ?)`,
+			optionID, pollID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrPollVoteFailed, err)
+		}
+		if !exists {
+			return ErrInvalidPollOption
+		}
+	}
+
+	// Один голос на пользователя обеспечивает UNIQUE (poll_id, user_id)
+	_, err = tx.Exec(`INSERT INTO poll_votes (poll_id, user_id, created, updated) VALUES (?, ?, ?, ?)
+					  ON CONFLICT (poll_id, user_id) DO UPDATE SET updated = excluded.updated`,
+		pollID, userID, now, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPollVoteFailed, err)
+	}
+
+	var voteID int
+	err = tx.QueryRow(`SELECT id FROM poll_votes WHERE poll_id = ? AND user_id = ?`, pollID, userID).Scan(&voteID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPollVoteFailed, err)
+	}
+
+	if _, err = tx.Exec(`DELETE FROM poll_vote_options WHERE vote_id = ?`, voteID); err != nil {
+		return fmt.Errorf("%w: %v", ErrPollVoteFailed, err)
+	}
+
+	for _, optionID := range optionIDs {
+		_, err = tx.Exec(`INSERT INTO poll_vote_options (vote_id, option_id) VALUES (?, ?)`, voteID, optionID)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrPollVoteFailed, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// loadResults загружает варианты с количеством голосов и выбор пользователя
+func (ps *PollService) loadResults(poll *models.Poll, userID int) error {
+	query := `SELECT o.id, o.text, o.position,
+					 (SELECT COUNT(*) FROM poll_vote_options vo WHERE vo.option_id = o.id) AS votes,
+					 EXISTS(SELECT 1 FROM poll_vote_options vo
+							JOIN poll_votes v ON vo.vote_id = v.id
+							WHERE vo.option_id = o.id AND v.user_id = ?) AS chosen
+			  FROM poll_options o
+			  WHERE o.poll_id = ?
+			  ORDER BY o.position`
+
+	rows, err := ps.db.DBConn.Query(query, userID, poll.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	poll.Options = nil
+	poll.UserChoice = nil
+	for rows.Next() {
+		var option models.PollOption
+		if err := rows.Scan(&option.ID, &option.Text, &option.Position, &option.Votes, &option.Chosen); err != nil {
+			return err
+		}
+		if option.Chosen {
+			poll.UserChoice = append(poll.UserChoice, option.ID)
+		}
+		poll.Options = append(poll.Options, &option)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	err = ps.db.DBConn.QueryRow(`SELECT COUNT(*) FROM poll_votes WHERE poll_id = ?`, poll.ID).Scan(&poll.Voters)
+	if err != nil {
+		return err
+	}
+
+	// Процент считается от числа проголосовавших, поэтому в опросе
+	// с несколькими вариантами сумма может превышать 100
+	for _, option := range poll.Options {
+		if poll.Voters > 0 {
+			option.Percent = option.Votes * 100 / poll.Voters
+		}
+	}
+
+	return nil
+}
+
+// validatePoll проверяет вопрос, варианты и время закрытия; возвращает
+// очищенный список вариантов
+func (ps *PollService) validatePoll(question string, options []string, closesAt *time.Time) ([]string, error) {
+	if question == "" {
+		return nil, ErrEmptyPollQuestion
+	}
+	if utf8.RuneCountInString(question) > 255 {
+		return nil, ErrLongPollQuestion
+	}
+
+	var cleaned []string
+	seen := map[string]bool{}
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		if utf8.RuneCountInString(option) > 100 {
+			return nil, ErrLongPollOption
+		}
+		key := strings.ToLower(option)
+		if seen[key] {
+			return nil, ErrDuplicatePollOpt
+		}
+		seen[key] = true
+		cleaned = append(cleaned, option)
+	}
+
+	if len(cleaned) < MinPollOptions || len(cleaned) > MaxPollOptions {
+		return nil, ErrPollOptionsCount
+	}
+
+	if closesAt != nil && !closesAt.After(time.Now()) {
+		return nil, ErrPollClosingInPast
+	}
+
+	return cleaned, nil
+}
+
+// uniqueInts убирает повторы, сохраняя порядок
+func uniqueInts(values []int) []int {
+	seen := map[int]bool{}
+	var result []int
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"forum/internal/markdown"
 	"forum/internal/models"
 	"strings"
 	"time"
@@ -19,8 +20,29 @@ var (
 	ErrPostUpdateFailed = errors.New("ошибка обновления поста")
 	ErrPostDeleteFailed = errors.New("ошибка удаления поста")
 	ErrNotPostAuthor    = errors.New("только автор может изменять пост")
+	ErrNotPostEditor    = errors.New("только автор или модератор может изменять пост")
+	ErrPublishInPast    = errors.New("время публикации должно быть в будущем")
+	ErrPostPublished    = errors.New("пост уже опубликован")
+	ErrPostInReview     = errors.New("пост ждёт проверки модератором и будет опубликован после одобрения")
 )
 
+// PostConflictError возвращается, когда пост был изменён после того,
+// как пользователь открыл форму редактирования
+type PostConflictError struct {
+	Current *models.Post // Актуальная версия поста
+}
+
+func (e *PostConflictError) Error() string {
+	return fmt.Sprintf("пост был изменён другим пользователем (текущая версия %d)", e.Current.Version)
+}
+
+// PostMedia - теги и изменения вложений, которые сохраняются вместе с постом
+type PostMedia struct {
+	Tags                 []string // все теги поста, уже нормализованные
+	AttachmentIDs        []int    // загрузки, которые нужно привязать к посту
+	RemovedAttachmentIDs []int    // вложения, которые нужно отвязать от поста
+}
+
 type PostService struct {
 	db *Database
 }
@@ -29,11 +51,56 @@ func NewPostService(db *Database) *PostService {
 	return &PostService{db: db}
 }
 
-// CreatePost создает новый пост
-func (ps *PostService) CreatePost(title, content string, userID int, categoryIDs []int) (*models.Post, error) {
+// CreatePost создает новый пост с тегами и загрузками из media (может быть nil).
+// Если publishAt задан, пост скрыт до этого времени, а уведомления о нём уйдут
+// при публикации
+func (ps *PostService) CreatePost(title, content string, userID int, categoryIDs []int,
+	media *PostMedia, publishAt *time.Time) (*models.Post, error) {
+
 	if err := ps.validatePostData(title, content); err != nil {
 		return nil, err
 	}
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		return nil, ErrPublishInPast
+	}
+
+	allowed, err := ps.db.canAccessCategories(userID, categoryIDs, models.CategoryPost)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrCategoryPostForbidden
+	}
+
+	// Фильтр может заменить слова, поэтому проверяем до рендеринга
+	if media == nil {
+		media = &PostMedia{}
+	}
+	checked := &Content{Kind: models.CheckedPost, UserID: userID, Title: title, Text: content, Tags: media.Tags}
+	verdict, err := ps.db.checkContent(checked)
+	if err != nil {
+		return nil, err
+	}
+	title, content = checked.Title, checked.Text
+
+	// Пост на проверке публикуется после одобрения модератором: сразу
+	// или в назначенное время, поэтому время публикации заполняется всегда
+	held := verdict.Held()
+	var review sql.NullString
+	if held {
+		review = sql.NullString{String: models.ReviewNew, Valid: true}
+		if publishAt == nil {
+			now := time.Now()
+			publishAt = &now
+		}
+	}
+	published := publishAt == nil
+
+	// Рендерим Markdown один раз при сохранении, заодно находим упоминания
+	contentHTML, mentioned, err := renderWithMentions(ps.db, content)
+	if err != nil {
+		return nil, err
+	}
 
 	// Начинаем транзакцию
 	tx, err := ps.db.DBConn.Begin()
@@ -43,13 +110,13 @@ func (ps *PostService) CreatePost(title, content string, userID int, categoryIDs
 	defer tx.Rollback()
 
 	// Создаем пост
-	query := `INSERT INTO posts (title, content, user_id, created, updated) 
-			  VALUES (?, ?, ?, ?, ?) RETURNING id, created, updated`
+	query := `INSERT INTO posts (title, content, content_html, user_id, published, publish_at, review, created, updated) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created, updated`
 
 	var post models.Post
 	now := time.Now()
 
-	err = tx.QueryRow(query, title, content, userID, now, now).Scan(
+	err = tx.QueryRow(query, title, content, contentHTML, userID, published, publishAt, review, now, now).Scan(
 		&post.ID, &post.Created, &post.Updated)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrPostCreateFailed, err)
@@ -66,29 +133,103 @@ func (ps *PostService) CreatePost(title, content string, userID int, categoryIDs
 		}
 	}
 
+	if err = setPostTags(tx, post.ID, checked.Tags); err != nil {
+		return nil, err
+	}
+	if err = attachUploads(tx, post.ID, userID, media.AttachmentIDs); err != nil {
+		return nil, err
+	}
+
+	// Сохраняем первую версию поста
+	if err = insertPostRevision(tx, post.ID, userID, title, content, categoryIDs); err != nil {
+		return nil, err
+	}
+
+	if _, err = recordMentions(tx, userID, post.ID, nil, mentioned); err != nil {
+		return nil, err
+	}
+
+	checked.PostID = post.ID
+	if err = logContentCheck(tx, checked, verdict, nil); err != nil {
+		return nil, err
+	}
+
+	// Отложенный пост уведомит о себе при публикации
+	var notifications []*models.Notification
+	if published {
+		notifications, err = publishNotifications(tx, post.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Подтверждаем транзакцию
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
 	}
 
+	ps.db.deliver(notifications)
+	if published {
+		ps.db.checkBadges(userID)
+	}
+
 	post.Title = title
 	post.Content = content
+	post.ContentHTML = contentHTML
 	post.UserID = userID
+	post.Version = 1
+	post.Published = published
+	post.PublishAt = publishAt
+	post.Review = review.String
 
 	return &post, nil
 }
 
-// GetPost получает пост по ID с информацией об авторе
-func (ps *PostService) GetPost(id int) (*models.Post, error) {
-	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
+// GetPost получает пост по ID с информацией об авторе. Неопубликованный пост
+// для всех, кроме автора и модераторов (viewer - nil для гостя), не существует
+func (ps *PostService) GetPost(id int, viewer *models.User) (*models.Post, error) {
+	post, err := ps.getPost(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !post.VisibleTo(viewer) {
+		return nil, ErrPostNotFound
+	}
+
+	// Пост из закрытой для пользователя категории тоже не существует
+	viewerID := 0
+	if viewer != nil {
+		viewerID = viewer.ID
+	}
+	var categoryIDs []int
+	for _, category := range post.Categories {
+		categoryIDs = append(categoryIDs, category.ID)
+	}
+	allowed, err := ps.db.canAccessCategories(viewerID, categoryIDs, models.CategoryView)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrPostNotFound
+	}
+
+	return post, nil
+}
+
+// getPost получает пост по ID независимо от публикации
+func (ps *PostService) getPost(id int) (*models.Post, error) {
+	query := `SELECT p.id, p.title, p.content, p.content_html, p.user_id, p.version, p.published, p.publish_at,
+					 COALESCE(p.review, ''), p.created, p.updated, u.username
 			  FROM posts p
 			  JOIN users u ON p.user_id = u.id
 			  WHERE p.id = ?`
 
 	var post models.Post
+	var publishAt sql.NullTime
 	err := ps.db.DBConn.QueryRow(query, id).Scan(
-		&post.ID, &post.Title, &post.Content, &post.UserID,
-		&post.Created, &post.Updated, &post.Username)
+		&post.ID, &post.Title, &post.Content, &post.ContentHTML, &post.UserID, &post.Version,
+		&post.Published, &publishAt, &post.Review, &post.Created, &post.Updated, &post.Username)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -97,9 +238,20 @@ func (ps *PostService) GetPost(id int) (*models.Post, error) {
 		return nil, err
 	}
 
+	if publishAt.Valid {
+		post.PublishAt = &publishAt.Time
+	}
+
+	// Посты, сохранённые до появления Markdown, рендерим при чтении
+	if post.ContentHTML == "" {
+		post.ContentHTML, err = markdown.Render(post.Content)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка рендеринга поста %d: %v", post.ID, err)
+		}
+	}
+
 	// Получаем категории
-	categoryService := NewCategoryService(ps.db)
-	categories, err := categoryService.GetPostCategories(post.ID)
+	categories, err := NewCategoryService(ps.db).getPostCategories(post.ID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения категорий поста %d: %v", post.ID, err)
 	}
@@ -108,57 +260,41 @@ func (ps *PostService) GetPost(id int) (*models.Post, error) {
 	return &post, nil
 }
 
-// GetAllPosts получает все посты с пагинацией
-func (ps *PostService) GetAllPosts(limit, offset int) ([]*models.Post, error) {
-	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
-			  FROM posts p
-			  JOIN users u ON p.user_id = u.id
-			  ORDER BY p.created DESC
-			  LIMIT ? OFFSET ?`
-
-	rows, err := ps.db.DBConn.Query(query, limit, offset)
+// GetAllPosts получает страницу опубликованных постов, доступных пользователю
+// viewerID (0 - гость), новые сначала. before = nil - первая страница,
+// иначе посты, опубликованные раньше курсора
+func (ps *PostService) GetAllPosts(viewerID int, before *FeedCursor, limit int) ([]*models.Post, error) {
+	hidden, err := ps.db.hiddenPostsFilter(viewerID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var posts []*models.Post
-	categoryService := NewCategoryService(ps.db)
 
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID,
-			&post.Created, &post.Updated, &post.Username)
-		if err != nil {
-			return nil, err
-		}
-
-		// Получаем категории
-		categories, err := categoryService.GetPostCategories(post.ID)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка получения категорий поста %d: %v", post.ID, err)
-		}
-		post.Categories = categories
+	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
+			  FROM posts p
+			  JOIN users u ON p.user_id = u.id
+			  WHERE p.published = 1 AND ` + hidden + ` AND ` + feedCursorCondition + `
+			  ORDER BY p.created DESC, p.id DESC
+			  LIMIT ?`
 
-		posts = append(posts, &post)
-	}
+	return ps.queryFeed(query, before.args(), limit)
+}
 
-	if err = rows.Err(); err != nil {
+// GetUserPosts получает не больше limit последних опубликованных постов
+// конкретного пользователя, доступных пользователю viewerID (0 - гость)
+func (ps *PostService) GetUserPosts(userID, viewerID, limit int) ([]*models.Post, error) {
+	hidden, err := ps.db.hiddenPostsFilter(viewerID)
+	if err != nil {
 		return nil, err
 	}
 
-	return posts, nil
-}
-
-// GetUserPosts получает посты конкретного пользователя
-func (ps *PostService) GetUserPosts(userID int) ([]*models.Post, error) {
 	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
 			  FROM posts p
 			  JOIN users u ON p.user_id = u.id
-			  WHERE p.user_id = ?
-			  ORDER BY p.created DESC`
+			  WHERE p.user_id = ? AND p.published = 1 AND ` + hidden + `
+			  ORDER BY p.created DESC
+			  LIMIT ?`
 
-	rows, err := ps.db.DBConn.Query(query, userID)
+	rows, err := ps.db.DBConn.Query(query, userID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -182,15 +318,56 @@ func (ps *PostService) GetUserPosts(userID int) ([]*models.Post, error) {
 	return posts, nil
 }
 
-// UpdatePost обновляет пост (только автор может изменять)
-func (ps *PostService) UpdatePost(postID int, title, content string, categoryIDs []int, userID int) error {
+// UpdatePost обновляет пост (автор или модератор) и сохраняет новую версию в истории.
+// version - номер версии, которую видел редактор; если пост с тех пор изменился,
+// возвращается *PostConflictError. media == nil оставляет теги и вложения как есть
+func (ps *PostService) UpdatePost(postID int, title, content string, categoryIDs []int, media *PostMedia,
+	userID, version int) error {
 	if err := ps.validatePostData(title, content); err != nil {
 		return err
 	}
 
-	// Проверяем, что пользователь является автором поста
-	if !ps.isPostAuthor(postID, userID) {
-		return ErrNotPostAuthor
+	// Проверяем, что пользователь может редактировать пост
+	if !ps.canEditPost(postID, userID) {
+		return ErrNotPostEditor
+	}
+
+	// Изменять посты закрытых для публикации категорий (например, архива) и
+	// переносить посты в такие категории может только тот, кому там разрешено публиковать
+	allowed, err := ps.db.canAccessPost(userID, postID, models.CategoryPost)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		allowed, err = ps.db.canAccessCategories(userID, categoryIDs, models.CategoryPost)
+		if err != nil {
+			return err
+		}
+	}
+	if !allowed {
+		return ErrCategoryPostForbidden
+	}
+
+	checked := &Content{Kind: models.CheckedEdit, UserID: userID, PostID: postID, Title: title, Text: content}
+	if media != nil {
+		checked.Tags = media.Tags
+	}
+	verdict, err := ps.db.checkContent(checked)
+	if err != nil {
+		return err
+	}
+	title, content = checked.Title, checked.Text
+	if media != nil {
+		media = &PostMedia{
+			Tags:                 checked.Tags,
+			AttachmentIDs:        media.AttachmentIDs,
+			RemovedAttachmentIDs: media.RemovedAttachmentIDs,
+		}
+	}
+
+	contentHTML, mentioned, err := renderWithMentions(ps.db, content)
+	if err != nil {
+		return err
 	}
 
 	// Начинаем транзакцию
@@ -200,39 +377,175 @@ func (ps *PostService) UpdatePost(postID int, title, content string, categoryIDs
 	}
 	defer tx.Rollback()
 
-	// Обновляем пост
-	updatePostQuery := `UPDATE posts SET title = ?, content = ?, updated = ? WHERE id = ?`
-	_, err = tx.Exec(updatePostQuery, title, content, time.Now(), postID)
+	var published bool
+	if err = tx.QueryRow(`SELECT published FROM posts WHERE id = ?`, postID).Scan(&published); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPostNotFound
+		}
+		return fmt.Errorf("ошибка обновления поста: %v", err)
+	}
+
+	// Правка опубликованного поста на проверке не меняет пост, его теги и
+	// изображения: читатели видят прежнюю версию, пока модератор не одобрит правку
+	if verdict.Held() && published {
+		result, err := tx.Exec(`UPDATE posts SET review = ? WHERE id = ? AND version = ?`,
+			models.ReviewEdit, postID, version)
+		if err != nil {
+			return fmt.Errorf("ошибка обновления поста: %v", err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return ps.conflict(tx, postID)
+		}
+
+		// Правка без своих тегов и изображений сохраняет нынешние теги
+		if media == nil {
+			tags, err := postTagNames(tx, postID)
+			if err != nil {
+				return err
+			}
+			media = &PostMedia{Tags: tags}
+		}
+		if err = savePendingEdit(tx, postID, userID, title, content, categoryIDs, media); err != nil {
+			return err
+		}
+		if err = logContentCheck(tx, checked, verdict, nil); err != nil {
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+		}
+		return nil
+	}
+
+	// Посты, созданные до появления истории, получают исходную версию
+	if err = ensureInitialPostRevision(tx, postID); err != nil {
+		return err
+	}
+
+	// Обновляем пост, только если его версия не изменилась
+	updatePostQuery := `UPDATE posts SET title = ?, content = ?, content_html = ?, updated = ?, version = version + 1`
+	args := []interface{}{title, content, contentHTML, time.Now()}
+	switch {
+	case verdict.Held():
+		// Неопубликованный пост уходит на проверку целиком, а уже ждущий её остаётся на проверке
+		updatePostQuery += `, review = ?`
+		args = append(args, models.ReviewNew)
+	case published:
+		// Новая правка заменяет правку, ждущую проверки
+		updatePostQuery += `, review = NULL`
+	}
+	updatePostQuery += ` WHERE id = ? AND version = ?`
+	result, err := tx.Exec(updatePostQuery, append(args, postID, version)...)
 	if err != nil {
 		return fmt.Errorf("ошибка обновления поста: %v", err)
 	}
 
-	// Удаляем все существующие связи с категориями
-	deleteQuery := `DELETE FROM post_categories WHERE post_id = ?`
-	_, err = tx.Exec(deleteQuery, postID)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("ошибка удаления старых категорий: %v", err)
+		return err
 	}
 
-	// Добавляем новые связи
-	if len(categoryIDs) > 0 {
-		insertQuery := `INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)`
-		for _, categoryID := range categoryIDs {
-			_, err = tx.Exec(insertQuery, postID, categoryID)
-			if err != nil {
-				return fmt.Errorf("ошибка добавления категории: %v", err)
-			}
+	if rowsAffected == 0 {
+		return ps.conflict(tx, postID)
+	}
+
+	// Загрузки заменённой правки ещё можно привязать, поэтому она удаляется после
+	if media != nil {
+		if err = detachAttachments(tx, postID, media.RemovedAttachmentIDs); err != nil {
+			return err
+		}
+		if err = attachUploads(tx, postID, userID, media.AttachmentIDs); err != nil {
+			return err
+		}
+		if err = setPostTags(tx, postID, media.Tags); err != nil {
+			return err
 		}
 	}
 
+	if published {
+		if err = deletePendingEdit(tx, postID); err != nil {
+			return err
+		}
+	}
+
+	if err = setPostCategories(tx, postID, categoryIDs); err != nil {
+		return err
+	}
+
+	// Сохраняем новую версию
+	if err = insertPostRevision(tx, postID, userID, title, content, categoryIDs); err != nil {
+		return err
+	}
+
+	if err = logContentCheck(tx, checked, verdict, nil); err != nil {
+		return err
+	}
+
+	// Уведомляются только новые упоминания; упомянутые в отложенном посте
+	// узнают о нём при публикации
+	notifications, err := recordMentions(tx, userID, postID, nil, mentioned)
+	if err != nil {
+		return err
+	}
+	if !published {
+		notifications = nil
+	}
+
 	// Подтверждаем транзакцию
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
 	}
 
+	ps.db.deliver(notifications)
+
+	return nil
+}
+
+// conflict откатывает транзакцию правки и возвращает *PostConflictError
+// с текущей версией поста
+func (ps *PostService) conflict(tx *sql.Tx, postID int) error {
+	tx.Rollback()
+	current, err := ps.getPost(postID)
+	if err != nil {
+		return err
+	}
+	return &PostConflictError{Current: current}
+}
+
+// setPostCategories заменяет категории поста
+func setPostCategories(tx *sql.Tx, postID int, categoryIDs []int) error {
+	// Удаляем все существующие связи с категориями
+	if _, err := tx.Exec(`DELETE FROM post_categories WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("ошибка удаления старых категорий: %v", err)
+	}
+
+	// Добавляем новые связи
+	insertQuery := `INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)`
+	for _, categoryID := range categoryIDs {
+		if _, err := tx.Exec(insertQuery, postID, categoryID); err != nil {
+			return fmt.Errorf("ошибка добавления категории: %v", err)
+		}
+	}
+
 	return nil
 }
 
+// RollbackPost восстанавливает пост из выбранной версии; откат сам становится новой версией
+func (ps *PostService) RollbackPost(postID, revisionID, userID, version int) error {
+	revision, err := NewRevisionService(ps.db).GetPostRevision(postID, revisionID)
+	if err != nil {
+		return err
+	}
+
+	categoryIDs := make([]int, 0, len(revision.Categories))
+	for _, category := range revision.Categories {
+		categoryIDs = append(categoryIDs, category.ID)
+	}
+
+	return ps.UpdatePost(postID, revision.Title, revision.Content, categoryIDs, nil, userID, version)
+}
+
 // DeletePost удаляет пост (только автор может удалять)
 func (ps *PostService) DeletePost(id int, userID int) error {
 	// Проверяем, что пользователь является автором поста
@@ -240,17 +553,100 @@ func (ps *PostService) DeletePost(id int, userID int) error {
 		return ErrNotPostAuthor
 	}
 
-	query := `DELETE FROM posts WHERE id = ?`
-	result, err := ps.db.DBConn.Exec(query, id)
+	tx, err := ps.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err = deletePostRows(tx, id); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// deletePostRows удаляет пост вместе со всем, что от него зависит: комментариями,
+// реакциями, опросом, историей правок, закладками, черновиками и правкой на
+// проверке. Внешние ключи в соединениях выключены, поэтому каскады из схемы
+// не срабатывают и строки удаляются явно. Очки за реакции снимаются с авторов,
+// изображения отвязываются и позже удаляются как сироты
+func deletePostRows(tx *sql.Tx, postID int) error {
+	rows, err := tx.Query(`SELECT COALESCE(c.user_id, p.user_id), SUM(l.points)
+						   FROM likes l
+						   LEFT JOIN posts p ON l.post_id = p.id
+						   LEFT JOIN comments c ON l.comment_id = c.id
+						   WHERE l.post_id = ? OR c.post_id = ?
+						   GROUP BY 1`, postID, postID)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrPostDeleteFailed, err)
 	}
+	points := make(map[int]int)
+	for rows.Next() {
+		var userID, sum int
+		if err := rows.Scan(&userID, &sum); err != nil {
+			rows.Close()
+			return fmt.Errorf("%w: %v", ErrPostDeleteFailed, err)
+		}
+		points[userID] = sum
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrPostDeleteFailed, err)
+	}
+	for userID, sum := range points {
+		if err = addReputation(tx, userID, -sum); err != nil {
+			return fmt.Errorf("ошибка обновления репутации: %v", err)
+		}
+	}
+
+	comments := `(SELECT id FROM comments WHERE post_id = ?)`
+	for _, query := range []string{
+		`DELETE FROM likes WHERE comment_id IN ` + comments,
+		`DELETE FROM likes WHERE post_id = ?`,
+		`DELETE FROM comment_revisions WHERE comment_id IN ` + comments,
+		`UPDATE content_checks SET comment_id = NULL WHERE comment_id IN ` + comments,
+		`UPDATE content_checks SET post_id = NULL WHERE post_id = ?`,
+		`DELETE FROM comments WHERE post_id = ?`,
+		`DELETE FROM mentions WHERE post_id = ?`,
+		`DELETE FROM notifications WHERE post_id = ?`,
+		`DELETE FROM post_subscriptions WHERE post_id = ?`,
+		`DELETE FROM bookmarks WHERE post_id = ?`,
+		`DELETE FROM draft_categories WHERE draft_id IN (SELECT id FROM drafts WHERE post_id = ?)`,
+		`DELETE FROM drafts WHERE post_id = ?`,
+		`DELETE FROM poll_vote_options WHERE vote_id IN
+			(SELECT v.id FROM poll_votes v JOIN polls p ON v.poll_id = p.id WHERE p.post_id = ?)`,
+		`DELETE FROM poll_votes WHERE poll_id IN (SELECT id FROM polls WHERE post_id = ?)`,
+		`DELETE FROM poll_options WHERE poll_id IN (SELECT id FROM polls WHERE post_id = ?)`,
+		`DELETE FROM polls WHERE post_id = ?`,
+		`DELETE FROM post_revision_categories WHERE revision_id IN (SELECT id FROM post_revisions WHERE post_id = ?)`,
+		`DELETE FROM post_revisions WHERE post_id = ?`,
+		`DELETE FROM post_categories WHERE post_id = ?`,
+		`DELETE FROM post_tags WHERE post_id = ?`,
+		`DELETE FROM post_redirects WHERE target_id = ?`,
+		`UPDATE attachments SET post_id = NULL WHERE post_id = ?`,
+	} {
+		if _, err = tx.Exec(query, postID); err != nil {
+			return fmt.Errorf("%w: %v", ErrPostDeleteFailed, err)
+		}
+	}
+
+	if err = deletePendingEdit(tx, postID); err != nil {
+		return err
+	}
 
+	result, err := tx.Exec(`DELETE FROM posts WHERE id = ?`, postID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPostDeleteFailed, err)
+	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-
 	if rowsAffected == 0 {
 		return ErrPostNotFound
 	}
@@ -258,14 +654,28 @@ func (ps *PostService) DeletePost(id int, userID int) error {
 	return nil
 }
 
-// GetPostsCount получает общее количество постов
+// GetPostsCount получает количество опубликованных постов
 func (ps *PostService) GetPostsCount() (int, error) {
 	var count int
-	query := `SELECT COUNT(*) FROM posts`
+	query := `SELECT COUNT(*) FROM posts WHERE published = 1`
 	err := ps.db.DBConn.QueryRow(query).Scan(&count)
 	return count, err
 }
 
+// CountUserPosts получает количество опубликованных постов пользователя,
+// доступных пользователю viewerID (0 - гость)
+func (ps *PostService) CountUserPosts(userID, viewerID int) (int, error) {
+	hidden, err := ps.db.hiddenPostsFilter(viewerID)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	query := `SELECT COUNT(*) FROM posts p WHERE p.user_id = ? AND p.published = 1 AND ` + hidden
+	err = ps.db.DBConn.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
 // isPostAuthor проверяет, является ли пользователь автором поста
 func (ps *PostService) isPostAuthor(postID, userID int) bool {
 	var authorID int
@@ -277,6 +687,14 @@ func (ps *PostService) isPostAuthor(postID, userID int) bool {
 	return authorID == userID
 }
 
+// canEditPost проверяет, может ли пользователь редактировать пост (автор или модератор)
+func (ps *PostService) canEditPost(postID, userID int) bool {
+	if ps.isPostAuthor(postID, userID) {
+		return true
+	}
+	return NewUserService(ps.db).IsModerator(userID)
+}
+
 // validatePostData валидирует данные поста
 func (ps *PostService) validatePostData(title, content string) error {
 	title = strings.TrimSpace(title)
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ReputationWeights - очки, которые автор получает за реакцию на свой пост
+// или комментарий, и дневной лимит очков от одного пользователя одному автору
+type ReputationWeights struct {
+	PostLike       int
+	PostDislike    int
+	CommentLike    int
+	CommentDislike int
+	DailyCap       int // 0 - без лимита
+}
+
+// DefaultReputationWeights - веса по умолчанию
+var DefaultReputationWeights = ReputationWeights{
+	PostLike:       5,
+	PostDislike:    -2,
+	CommentLike:    2,
+	CommentDislike: -1,
+	DailyCap:       10,
+}
+
+// weight возвращает вес реакции без учёта лимита
+func (w ReputationWeights) weight(isComment, isDislike bool) int {
+	switch {
+	case isComment && isDislike:
+		return w.CommentDislike
+	case isComment:
+		return w.CommentLike
+	case isDislike:
+		return w.PostDislike
+	default:
+		return w.PostLike
+	}
+}
+
+// capped урезает вес до остатка дневного лимита, если used очков
+// уже начислено. Лимит считается по модулю: дизлайки тоже его расходуют
+func (w ReputationWeights) capped(weight, used int) int {
+	if w.DailyCap <= 0 {
+		return weight
+	}
+
+	remaining := w.DailyCap - used
+	if remaining <= 0 {
+		return 0
+	}
+	if weight > remaining {
+		return remaining
+	}
+	if weight < -remaining {
+		return -remaining
+	}
+	return weight
+}
+
+// reputationDay возвращает границы суток, в которые попадает реакция
+func reputationDay(t time.Time) (time.Time, time.Time) {
+	t = t.Local()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// likeReceiver возвращает автора поста или комментария, получающего репутацию.
+// Для удалённой цели возвращается 0
+func likeReceiver(db execer, postID, commentID *int) (int, error) {
+	var authorID int
+	var err error
+	if postID != nil {
+		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, *postID).Scan(&authorID)
+	} else {
+		err = db.QueryRow(`SELECT user_id FROM comments WHERE id = ?`, *commentID).Scan(&authorID)
+	}
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return authorID, err
+}
+
+// likePoints считает очки реакции giverID на пост или комментарий receiverID,
+// созданной в момент created. Реакция excludeLikeID не входит в расход лимита:
+// так пересчитываются очки изменённой реакции
+func (w ReputationWeights) likePoints(db execer, giverID, receiverID, excludeLikeID int, created time.Time,
+	isComment, isDislike bool) (int, error) {
+	if receiverID == 0 || receiverID == giverID {
+		return 0, nil
+	}
+
+	weight := w.weight(isComment, isDislike)
+	if w.DailyCap <= 0 {
+		return weight, nil
+	}
+
+	dayStart, dayEnd := reputationDay(created)
+
+	var used int
+	query := `SELECT COALESCE(SUM(ABS(l.points)), 0)
+			  FROM likes l
+			  LEFT JOIN posts p ON l.post_id = p.id
+			  LEFT JOIN comments c ON l.comment_id = c.id
+			  WHERE l.user_id = ? AND COALESCE(p.user_id, c.user_id) = ?
+				AND l.created >= ? AND l.created < ? AND l.id != ?`
+	err := db.QueryRow(query, giverID, receiverID, dayStart, dayEnd, excludeLikeID).Scan(&used)
+	if err != nil {
+		return 0, err
+	}
+
+	return w.capped(weight, used), nil
+}
+
+// addReputation изменяет репутацию пользователя на delta
+func addReputation(db execer, userID, delta int) error {
+	if userID == 0 || delta == 0 {
+		return nil
+	}
+	_, err := db.Exec(`UPDATE users SET reputation = reputation + ? WHERE id = ?`, delta, userID)
+	return err
+}
+
+// RecomputeReputation заново начисляет очки за все реакции по текущим весам
+// и лимитам и исправляет репутацию пользователей, если она разошлась с ними.
+// Возвращает количество пользователей, чья репутация изменилась
+func (ls *LikeService) RecomputeReputation() (int, error) {
+	tx, err := ls.db.DBConn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT l.id, l.user_id, COALESCE(p.user_id, c.user_id, 0), l.comment_id IS NOT NULL,
+					 l.is_dislike, l.points, l.created
+			  FROM likes l
+			  LEFT JOIN posts p ON l.post_id = p.id
+			  LEFT JOIN comments c ON l.comment_id = c.id
+			  ORDER BY l.created, l.id`
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	// Расход дневного лимита по паре (кто реагировал, кому) и дню
+	type capKey struct {
+		giverID, receiverID int
+		day                 string
+	}
+	used := map[capKey]int{}
+	totals := map[int]int{}
+	changedPoints := map[int]int{}
+
+	for rows.Next() {
+		var likeID, giverID, receiverID, points int
+		var isComment, isDislike bool
+		var created time.Time
+		if err := rows.Scan(&likeID, &giverID, &receiverID, &isComment, &isDislike, &points, &created); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		newPoints := 0
+		if receiverID != 0 && receiverID != giverID {
+			key := capKey{giverID, receiverID, created.Local().Format("2006-01-02")}
+			newPoints = ls.weights.capped(ls.weights.weight(isComment, isDislike), used[key])
+			used[key] += abs(newPoints)
+			totals[receiverID] += newPoints
+		}
+
+		if newPoints != points {
+			changedPoints[likeID] = newPoints
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	rows.Close()
+
+	for likeID, points := range changedPoints {
+		if _, err := tx.Exec(`UPDATE likes SET points = ? WHERE id = ?`, points, likeID); err != nil {
+			return 0, fmt.Errorf("ошибка пересчёта очков реакции: %v", err)
+		}
+	}
+
+	rows, err = tx.Query(`SELECT id, reputation FROM users`)
+	if err != nil {
+		return 0, err
+	}
+	changedUsers := map[int]int{}
+	for rows.Next() {
+		var userID, reputation int
+		if err := rows.Scan(&userID, &reputation); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if totals[userID] != reputation {
+			changedUsers[userID] = totals[userID]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	rows.Close()
+
+	for userID, reputation := range changedUsers {
+		if _, err := tx.Exec(`UPDATE users SET reputation = ? WHERE id = ?`, reputation, userID); err != nil {
+			return 0, fmt.Errorf("ошибка пересчёта репутации: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(changedUsers), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
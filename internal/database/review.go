@@ -0,0 +1,524 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNotReviewer = errors.New("проверять содержимое могут только модераторы")
+	ErrNotInReview = errors.New("содержимое не ждёт проверки")
+)
+
+type ReviewService struct {
+	db *Database
+}
+
+func NewReviewService(db *Database) *ReviewService {
+	return &ReviewService{db: db}
+}
+
+// GetQueue получает посты и комментарии, ждущие проверки, старые сначала
+func (rs *ReviewService) GetQueue() ([]*models.ReviewItem, error) {
+	// Причина - последнее решение фильтра об отправке на проверку
+	postQuery := `SELECT p.id, 0, p.review, p.title, p.content, u.username, p.updated,
+					  COALESCE((SELECT reasons FROM content_checks
+								WHERE post_id = p.id AND comment_id IS NULL AND decision = ?
+								ORDER BY id DESC LIMIT 1), '')
+				  FROM posts p
+				  JOIN users u ON p.user_id = u.id
+				  WHERE p.review = '` + models.ReviewNew + `'`
+	// У правки показываются её текст и автор, а не опубликованная версия
+	editQuery := `SELECT p.id, 0, p.review, e.title, e.content, u.username, e.created,
+					  COALESCE((SELECT reasons FROM content_checks
+								WHERE post_id = p.id AND comment_id IS NULL AND decision = ?
+								ORDER BY id DESC LIMIT 1), '')
+				  FROM posts p
+				  JOIN pending_edits e ON e.post_id = p.id
+				  JOIN users u ON e.editor_id = u.id
+				  WHERE p.review = '` + models.ReviewEdit + `'`
+	commentQuery := `SELECT c.post_id, c.id, c.review, p.title, c.content, u.username, c.created,
+						 COALESCE((SELECT reasons FROM content_checks
+								   WHERE comment_id = c.id AND decision = ?
+								   ORDER BY id DESC LIMIT 1), '')
+					 FROM comments c
+					 JOIN users u ON c.user_id = u.id
+					 JOIN posts p ON c.post_id = p.id
+					 WHERE c.review IS NOT NULL`
+
+	var items []*models.ReviewItem
+	for _, query := range []string{postQuery, editQuery, commentQuery} {
+		rows, err := rs.db.DBConn.Query(query, models.DecisionHold)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var item models.ReviewItem
+			err := rows.Scan(&item.PostID, &item.CommentID, &item.Review, &item.Title, &item.Content,
+				&item.Username, &item.Updated, &item.Reasons)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			items = append(items, &item)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Updated.Before(items[j].Updated)
+	})
+
+	return items, nil
+}
+
+// CountQueue получает количество постов и комментариев, ждущих проверки
+func (rs *ReviewService) CountQueue() (int, error) {
+	var count int
+	err := rs.db.DBConn.QueryRow(`SELECT (SELECT COUNT(*) FROM posts WHERE review IS NOT NULL)
+									   + (SELECT COUNT(*) FROM comments WHERE review IS NOT NULL)`).Scan(&count)
+	return count, err
+}
+
+// GetChecks получает последние limit решений фильтра
+func (rs *ReviewService) GetChecks(limit int) ([]*models.ContentCheckEntry, error) {
+	query := `SELECT cc.id, cc.kind, COALESCE(cc.post_id, 0), COALESCE(cc.comment_id, 0), u.username,
+					 cc.decision, cc.score, cc.reasons, cc.created
+			  FROM content_checks cc
+			  JOIN users u ON cc.user_id = u.id
+			  ORDER BY cc.id DESC
+			  LIMIT ?`
+
+	rows, err := rs.db.DBConn.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.ContentCheckEntry
+	for rows.Next() {
+		var entry models.ContentCheckEntry
+		err := rows.Scan(&entry.ID, &entry.Kind, &entry.PostID, &entry.CommentID, &entry.Username,
+			&entry.Decision, &entry.Score, &entry.Reasons, &entry.Created)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ApprovePost одобряет пост. Одобренная правка заменяет опубликованную версию
+// поста; новый пост выходит сразу или в назначенное автором время
+func (rs *ReviewService) ApprovePost(postID, moderatorID int) error {
+	if !NewUserService(rs.db).IsModerator(moderatorID) {
+		return ErrNotReviewer
+	}
+
+	review, publishAt, err := rs.postReview(postID)
+	if err != nil {
+		return err
+	}
+
+	if review == models.ReviewEdit {
+		return rs.approveEdit(postID)
+	}
+
+	if _, err = rs.db.DBConn.Exec(`UPDATE posts SET review = NULL WHERE id = ?`, postID); err != nil {
+		return err
+	}
+
+	// Без времени публикации пост остаётся скрытым: автор отменил публикацию
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		_, err = NewPostService(rs.db).publishPost(postID)
+	}
+	return err
+}
+
+// approveEdit применяет правку, ждущую проверки: пост получает её текст,
+// категории, теги и изображения, правка попадает в историю, а упомянутые в ней
+// получают уведомления
+func (rs *ReviewService) approveEdit(postID int) error {
+	edit, err := NewPostService(rs.db).GetPendingEdit(postID)
+	if err != nil {
+		return err
+	}
+
+	contentHTML, mentioned, err := renderWithMentions(rs.db, edit.Content)
+	if err != nil {
+		return err
+	}
+
+	tx, err := rs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err = ensureInitialPostRevision(tx, postID); err != nil {
+		return err
+	}
+
+	// Версия увеличивается, чтобы открытая форма правки не затёрла одобренный текст
+	_, err = tx.Exec(`UPDATE posts SET title = ?, content = ?, content_html = ?, updated = ?,
+					  version = version + 1, review = NULL
+					  WHERE id = ?`, edit.Title, edit.Content, contentHTML, time.Now(), postID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления поста: %v", err)
+	}
+
+	if err = setPostCategories(tx, postID, edit.CategoryIDs); err != nil {
+		return err
+	}
+	if err = setPostTags(tx, postID, edit.Tags); err != nil {
+		return err
+	}
+	if err = detachAttachments(tx, postID, edit.RemovedAttachmentIDs); err != nil {
+		return err
+	}
+	if err = attachUploads(tx, postID, edit.EditorID, edit.AttachmentIDs); err != nil {
+		return err
+	}
+	if err = insertPostRevision(tx, postID, edit.EditorID, edit.Title, edit.Content, edit.CategoryIDs); err != nil {
+		return err
+	}
+	if err = deletePendingEdit(tx, postID); err != nil {
+		return err
+	}
+
+	notifications, err := recordMentions(tx, edit.EditorID, postID, nil, mentioned)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	rs.db.deliver(notifications)
+
+	return nil
+}
+
+// RejectPost удаляет новый пост, не прошедший проверку, или отбрасывает
+// правку: опубликованная версия поста остаётся как есть
+func (rs *ReviewService) RejectPost(postID, moderatorID int) error {
+	if !NewUserService(rs.db).IsModerator(moderatorID) {
+		return ErrNotReviewer
+	}
+
+	review, _, err := rs.postReview(postID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := rs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if review == models.ReviewEdit {
+		if _, err = tx.Exec(`UPDATE posts SET review = NULL WHERE id = ?`, postID); err != nil {
+			return fmt.Errorf("ошибка обновления поста: %v", err)
+		}
+		if err = deletePendingEdit(tx, postID); err != nil {
+			return err
+		}
+	} else if err = deletePostRows(tx, postID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// ApproveComment одобряет комментарий и рассылает отложенные уведомления о нём
+func (rs *ReviewService) ApproveComment(commentID, moderatorID int) error {
+	if !NewUserService(rs.db).IsModerator(moderatorID) {
+		return ErrNotReviewer
+	}
+
+	tx, err := rs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var postID, authorID int
+	var parent sql.NullInt64
+	err = tx.QueryRow(`UPDATE comments SET review = NULL WHERE id = ? AND review IS NOT NULL
+					   RETURNING post_id, parent_id, user_id`, commentID).Scan(&postID, &parent, &authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return commentMissing(tx, commentID)
+		}
+		return fmt.Errorf("%w: %v", ErrCommentUpdateFailed, err)
+	}
+
+	var notifications []*models.Notification
+	mentionedIDs, err := queryIDs(tx, `SELECT user_id FROM mentions WHERE comment_id = ?`, commentID)
+	if err != nil {
+		return fmt.Errorf("ошибка поиска упоминаний: %v", err)
+	}
+	for _, userID := range mentionedIDs {
+		notifications = append(notifications, &models.Notification{
+			UserID:    userID,
+			ActorID:   authorID,
+			Type:      models.NotificationMention,
+			PostID:    &postID,
+			CommentID: &commentID,
+		})
+	}
+
+	var parentID *int
+	if parent.Valid {
+		id := int(parent.Int64)
+		parentID = &id
+	}
+	replyNotifications, err := commentNotifications(tx, postID, parentID, authorID)
+	if err != nil {
+		return err
+	}
+	notifications = append(notifications, replyNotifications...)
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	rs.db.deliver(notifications)
+	rs.db.checkBadges(authorID)
+
+	return nil
+}
+
+// RejectComment удаляет комментарий, не прошедший проверку. Ответы на него
+// становятся ответами на пост
+func (rs *ReviewService) RejectComment(commentID, moderatorID int) error {
+	if !NewUserService(rs.db).IsModerator(moderatorID) {
+		return ErrNotReviewer
+	}
+
+	tx, err := rs.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM comments WHERE id = ? AND review IS NOT NULL`, commentID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCommentDeleteFailed, err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return commentMissing(tx, commentID)
+	}
+
+	for _, query := range []string{
+		`UPDATE comments SET parent_id = NULL WHERE parent_id = ?`,
+		`DELETE FROM mentions WHERE comment_id = ?`,
+		`DELETE FROM notifications WHERE comment_id = ?`,
+		`DELETE FROM likes WHERE comment_id = ?`,
+		`DELETE FROM comment_revisions WHERE comment_id = ?`,
+	} {
+		if _, err = tx.Exec(query, commentID); err != nil {
+			return fmt.Errorf("%w: %v", ErrCommentDeleteFailed, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	return nil
+}
+
+// postReview получает состояние проверки поста и время его публикации
+func (rs *ReviewService) postReview(postID int) (string, *time.Time, error) {
+	var review sql.NullString
+	var publishAt sql.NullTime
+	err := rs.db.DBConn.QueryRow(`SELECT review, publish_at FROM posts WHERE id = ?`, postID).Scan(&review, &publishAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, ErrPostNotFound
+		}
+		return "", nil, err
+	}
+	if !review.Valid {
+		return "", nil, ErrNotInReview
+	}
+	if publishAt.Valid {
+		return review.String, &publishAt.Time, nil
+	}
+	return review.String, nil, nil
+}
+
+// GetPendingEdit получает правку поста, ждущую проверки
+func (ps *PostService) GetPendingEdit(postID int) (*models.PendingEdit, error) {
+	edit := models.PendingEdit{PostID: postID}
+	err := ps.db.DBConn.QueryRow(`SELECT editor_id, title, content, created FROM pending_edits WHERE post_id = ?`,
+		postID).Scan(&edit.EditorID, &edit.Title, &edit.Content, &edit.Created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotInReview
+		}
+		return nil, err
+	}
+
+	edit.CategoryIDs, err = queryIDs(ps.db.DBConn, `SELECT category_id FROM pending_edit_categories WHERE post_id = ?`, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	edit.AttachmentIDs, err = queryIDs(ps.db.DBConn, `SELECT attachment_id FROM pending_edit_attachments
+													  WHERE post_id = ? AND NOT removed ORDER BY attachment_id`, postID)
+	if err != nil {
+		return nil, err
+	}
+	edit.RemovedAttachmentIDs, err = queryIDs(ps.db.DBConn, `SELECT attachment_id FROM pending_edit_attachments
+															 WHERE post_id = ? AND removed ORDER BY attachment_id`, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := ps.db.DBConn.Query(`SELECT name FROM pending_edit_tags WHERE post_id = ? ORDER BY rowid`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		edit.Tags = append(edit.Tags, name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &edit, nil
+}
+
+// savePendingEdit сохраняет правку поста для проверки, заменяя прежнюю. Из
+// загрузок сохраняются те, которые правка может привязать к посту, из удаляемых
+// вложений - принадлежащие посту
+func savePendingEdit(tx *sql.Tx, postID, editorID int, title, content string, categoryIDs []int,
+	media *PostMedia) error {
+
+	// Загрузки прежней правки проверяются до её удаления: их можно сохранить снова
+	var uploads, removed []int
+	for _, attachmentID := range media.AttachmentIDs {
+		ok, err := canAttachUpload(tx, postID, editorID, attachmentID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			uploads = append(uploads, attachmentID)
+		}
+	}
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM attachments WHERE post_id = ?`, postID).Scan(&count); err != nil {
+		return err
+	}
+	for _, attachmentID := range media.RemovedAttachmentIDs {
+		var ok bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM attachments WHERE id = ? AND post_id = ?)`,
+			attachmentID, postID).Scan(&ok)
+		if err != nil {
+			return err
+		}
+		if ok {
+			removed = append(removed, attachmentID)
+		}
+	}
+	if count-len(removed)+len(uploads) > MaxPostAttachments {
+		return ErrTooManyAttachments
+	}
+
+	if err := deletePendingEdit(tx, postID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`INSERT INTO pending_edits (post_id, editor_id, title, content, created) VALUES (?, ?, ?, ?, ?)`,
+		postID, editorID, title, content, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения правки: %v", err)
+	}
+
+	for _, categoryID := range categoryIDs {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO pending_edit_categories (post_id, category_id) VALUES (?, ?)`,
+			postID, categoryID)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения правки: %v", err)
+		}
+	}
+
+	for _, name := range media.Tags {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO pending_edit_tags (post_id, name) VALUES (?, ?)`, postID, name)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения правки: %v", err)
+		}
+	}
+
+	for _, attachments := range []struct {
+		ids     []int
+		removed bool
+	}{{uploads, false}, {removed, true}} {
+		for _, attachmentID := range attachments.ids {
+			_, err = tx.Exec(`INSERT OR IGNORE INTO pending_edit_attachments (post_id, attachment_id, removed)
+							  VALUES (?, ?, ?)`, postID, attachmentID, attachments.removed)
+			if err != nil {
+				return fmt.Errorf("ошибка сохранения правки: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// deletePendingEdit удаляет правку поста, ждущую проверки, если она есть
+func deletePendingEdit(db execer, postID int) error {
+	for _, query := range []string{
+		`DELETE FROM pending_edit_categories WHERE post_id = ?`,
+		`DELETE FROM pending_edit_tags WHERE post_id = ?`,
+		`DELETE FROM pending_edit_attachments WHERE post_id = ?`,
+		`DELETE FROM pending_edits WHERE post_id = ?`,
+	} {
+		if _, err := db.Exec(query, postID); err != nil {
+			return fmt.Errorf("ошибка удаления правки: %v", err)
+		}
+	}
+	return nil
+}
+
+// commentMissing объясняет, почему комментарий не удалось найти на проверке
+func commentMissing(db execer, commentID int) error {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM comments WHERE id = ?)`, commentID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCommentNotFound
+	}
+	return ErrNotInReview
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("версия не найдена")
+)
+
+type RevisionService struct {
+	db *Database
+}
+
+func NewRevisionService(db *Database) *RevisionService {
+	return &RevisionService{db: db}
+}
+
+// GetPostRevisions получает все версии поста, начиная с самой новой
+func (rs *RevisionService) GetPostRevisions(postID int) ([]*models.Revision, error) {
+	query := `SELECT r.id, r.post_id, r.editor_id, r.title, r.content, r.created, u.username
+			  FROM post_revisions r
+			  JOIN users u ON r.editor_id = u.id
+			  WHERE r.post_id = ?
+			  ORDER BY r.id DESC`
+
+	rows, err := rs.db.DBConn.Query(query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.Revision
+	for rows.Next() {
+		var revision models.Revision
+		err := rows.Scan(&revision.ID, &revision.TargetID, &revision.EditorID,
+			&revision.Title, &revision.Content, &revision.Created, &revision.EditorName)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, revision := range revisions {
+		categories, err := rs.getRevisionCategories(revision.ID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения категорий версии %d: %v", revision.ID, err)
+		}
+		revision.Categories = categories
+	}
+
+	return revisions, nil
+}
+
+// GetPostRevision получает версию поста по ID
+func (rs *RevisionService) GetPostRevision(postID, revisionID int) (*models.Revision, error) {
+	query := `SELECT r.id, r.post_id, r.editor_id, r.title, r.content, r.created, u.username
+			  FROM post_revisions r
+			  JOIN users u ON r.editor_id = u.id
+			  WHERE r.id = ? AND r.post_id = ?`
+
+	var revision models.Revision
+	err := rs.db.DBConn.QueryRow(query, revisionID, postID).Scan(
+		&revision.ID, &revision.TargetID, &revision.EditorID,
+		&revision.Title, &revision.Content, &revision.Created, &revision.EditorName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+
+	categories, err := rs.getRevisionCategories(revision.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения категорий версии %d: %v", revision.ID, err)
+	}
+	revision.Categories = categories
+
+	return &revision, nil
+}
+
+// GetCommentRevisions получает все версии комментария, начиная с самой новой
+func (rs *RevisionService) GetCommentRevisions(commentID int) ([]*models.Revision, error) {
+	query := `SELECT r.id, r.comment_id, r.editor_id, r.content, r.created, u.username
+			  FROM comment_revisions r
+			  JOIN users u ON r.editor_id = u.id
+			  WHERE r.comment_id = ?
+			  ORDER BY r.id DESC`
+
+	rows, err := rs.db.DBConn.Query(query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.Revision
+	for rows.Next() {
+		var revision models.Revision
+		err := rows.Scan(&revision.ID, &revision.TargetID, &revision.EditorID,
+			&revision.Content, &revision.Created, &revision.EditorName)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetCommentRevision получает версию комментария по ID
+func (rs *RevisionService) GetCommentRevision(commentID, revisionID int) (*models.Revision, error) {
+	query := `SELECT r.id, r.comment_id, r.editor_id, r.content, r.created, u.username
+			  FROM comment_revisions r
+			  JOIN users u ON r.editor_id = u.id
+			  WHERE r.id = ? AND r.comment_id = ?`
+
+	var revision models.Revision
+	err := rs.db.DBConn.QueryRow(query, revisionID, commentID).Scan(
+		&revision.ID, &revision.TargetID, &revision.EditorID,
+		&revision.Content, &revision.Created, &revision.EditorName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// getRevisionCategories получает категории, сохранённые в версии поста
+func (rs *RevisionService) getRevisionCategories(revisionID int) ([]*models.Category, error) {
+	query := `SELECT c.id, c.name, c.slug, c.description, c.created
+			  FROM categories c
+			  JOIN post_revision_categories rc ON c.id = rc.category_id
+			  WHERE rc.revision_id = ?
+			  ORDER BY c.name`
+
+	rows, err := rs.db.DBConn.Query(query, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.Category
+	for rows.Next() {
+		var category models.Category
+		err := rows.Scan(&category.ID, &category.Name, &category.Slug,
+			&category.Description, &category.Created)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	return categories, rows.Err()
+}
+
+// insertPostRevision сохраняет версию поста в рамках транзакции
+func insertPostRevision(tx *sql.Tx, postID, editorID int, title, content string, categoryIDs []int) error {
+	var revisionID int
+	query := `INSERT INTO post_revisions (post_id, editor_id, title, content, created)
+			  VALUES (?, ?, ?, ?, ?) RETURNING id`
+	if err := tx.QueryRow(query, postID, editorID, title, content, time.Now()).Scan(&revisionID); err != nil {
+		return fmt.Errorf("ошибка сохранения версии поста: %v", err)
+	}
+
+	categoryQuery := `INSERT OR IGNORE INTO post_revision_categories (revision_id, category_id) VALUES (?, ?)`
+	for _, categoryID := range categoryIDs {
+		if _, err := tx.Exec(categoryQuery, revisionID, categoryID); err != nil {
+			return fmt.Errorf("ошибка сохранения категорий версии: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// ensureInitialPostRevision сохраняет текущее состояние поста как первую версию,
+// если пост был создан до появления истории правок
+func ensureInitialPostRevision(tx *sql.Tx, postID int) error {
+	var exists int
+	err := tx.QueryRow(`SELECT 1 FROM post_revisions WHERE post_id = ? LIMIT 1`, postID).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var title, content string
+	var authorID int
+	err = tx.QueryRow(`SELECT title, content, user_id FROM posts WHERE id = ?`, postID).Scan(&title, &content, &authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPostNotFound
+		}
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT category_id FROM post_categories WHERE post_id = ?`, postID)
+	if err != nil {
+		return err
+	}
+	var categoryIDs []int
+	for rows.Next() {
+		var categoryID int
+		if err := rows.Scan(&categoryID); err != nil {
+			rows.Close()
+			return err
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	rows.Close()
+
+	return insertPostRevision(tx, postID, authorID, title, content, categoryIDs)
+}
+
+// insertCommentRevision сохраняет версию комментария
+func insertCommentRevision(tx *sql.Tx, commentID, editorID int, content string) error {
+	query := `INSERT INTO comment_revisions (comment_id, editor_id, content, created)
+			  VALUES (?, ?, ?, ?)`
+	if _, err := tx.Exec(query, commentID, editorID, content, time.Now()); err != nil {
+		return fmt.Errorf("ошибка сохранения версии комментария: %v", err)
+	}
+	return nil
+}
+
+// ensureInitialCommentRevision сохраняет текущее состояние комментария как первую версию
+func ensureInitialCommentRevision(tx *sql.Tx, commentID int) error {
+	var exists int
+	err := tx.QueryRow(`SELECT 1 FROM comment_revisions WHERE comment_id = ? LIMIT 1`, commentID).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var content string
+	var authorID int
+	err = tx.QueryRow(`SELECT content, user_id FROM comments WHERE id = ?`, commentID).Scan(&content, &authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrCommentNotFound
+		}
+		return err
+	}
+
+	return insertCommentRevision(tx, commentID, authorID, content)
+}
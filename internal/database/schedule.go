@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+// GetScheduledPosts получает неопубликованные посты автора: сначала те,
+// что выйдут раньше, затем посты с отменённым расписанием
+func (ps *PostService) GetScheduledPosts(userID int) ([]*models.Post, error) {
+	query := `SELECT p.id, p.title, p.content, p.user_id, p.publish_at, p.created, p.updated, u.username
+			  FROM posts p
+			  JOIN users u ON p.user_id = u.id
+			  WHERE p.user_id = ? AND p.published = 0
+			  ORDER BY p.publish_at IS NULL, p.publish_at, p.id`
+
+	rows, err := ps.db.DBConn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		var post models.Post
+		var publishAt sql.NullTime
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &publishAt,
+			&post.Created, &post.Updated, &post.Username)
+		if err != nil {
+			return nil, err
+		}
+		if publishAt.Valid {
+			post.PublishAt = &publishAt.Time
+		}
+		posts = append(posts, &post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// SchedulePost переносит публикацию неопубликованного поста на publishAt.
+// publishAt = nil отменяет расписание: пост остаётся скрытым, пока его
+// не запланируют снова или не опубликуют вручную
+func (ps *PostService) SchedulePost(postID, userID int, publishAt *time.Time) error {
+	if !ps.canEditPost(postID, userID) {
+		return ErrNotPostEditor
+	}
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		return ErrPublishInPast
+	}
+
+	result, err := ps.db.DBConn.Exec(`UPDATE posts SET publish_at = ? WHERE id = ? AND published = 0`,
+		publishAt, postID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPostUpdateFailed, err)
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrPostPublished
+	}
+
+	return nil
+}
+
+// PublishPost публикует отложенный пост немедленно
+func (ps *PostService) PublishPost(postID, userID int) error {
+	if !ps.canEditPost(postID, userID) {
+		return ErrNotPostEditor
+	}
+
+	var review sql.NullString
+	if err := ps.db.DBConn.QueryRow(`SELECT review FROM posts WHERE id = ?`, postID).Scan(&review); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPostNotFound
+		}
+		return err
+	}
+	if review.Valid {
+		return ErrPostInReview
+	}
+
+	published, err := ps.publishPost(postID)
+	if err != nil {
+		return err
+	}
+	if !published {
+		return ErrPostPublished
+	}
+
+	return nil
+}
+
+// PublishDuePosts публикует посты, время публикации которых наступило.
+// Возвращает количество опубликованных постов
+func (ps *PostService) PublishDuePosts() (int, error) {
+	ids, err := queryIDs(ps.db.DBConn,
+		`SELECT id FROM posts WHERE published = 0 AND review IS NULL AND publish_at <= ? ORDER BY publish_at`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range ids {
+		published, err := ps.publishPost(id)
+		if err != nil {
+			return count, err
+		}
+		if published {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// publishPost делает пост видимым и рассылает уведомления о новом посте.
+// Датой создания становится время публикации, чтобы пост оказался вверху ленты.
+// Возвращает false, если пост уже опубликован или ждёт проверки модератором
+func (ps *PostService) publishPost(postID int) (bool, error) {
+	tx, err := ps.db.DBConn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`UPDATE posts SET published = 1, publish_at = NULL, created = ?, updated = ?
+							WHERE id = ? AND published = 0 AND review IS NULL`, now, now, postID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка публикации поста: %v", err)
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return false, nil
+	}
+
+	var authorID int
+	if err = tx.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&authorID); err != nil {
+		return false, fmt.Errorf("ошибка публикации поста: %v", err)
+	}
+
+	notifications, err := publishNotifications(tx, postID, authorID)
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	ps.db.deliver(notifications)
+	ps.db.checkBadges(authorID)
+
+	return true, nil
+}
+
+// publishNotifications собирает уведомления о вышедшем посте: упомянутым
+// в нём пользователям и подписчикам его категорий
+func publishNotifications(db execer, postID, authorID int) ([]*models.Notification, error) {
+	var notifications []*models.Notification
+
+	mentionedIDs, err := queryIDs(db,
+		`SELECT user_id FROM mentions WHERE post_id = ? AND comment_id IS NULL`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска упоминаний: %v", err)
+	}
+	for _, userID := range mentionedIDs {
+		notifications = append(notifications, &models.Notification{
+			UserID:  userID,
+			ActorID: authorID,
+			Type:    models.NotificationMention,
+			PostID:  &postID,
+		})
+	}
+
+	categoryIDs, err := queryIDs(db, `SELECT category_id FROM post_categories WHERE post_id = ?`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения категорий поста: %v", err)
+	}
+
+	subscriberIDs, err := categorySubscriberIDs(db, categoryIDs)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска подписчиков категорий: %v", err)
+	}
+	for _, subscriberID := range subscriberIDs {
+		notifications = append(notifications, &models.Notification{
+			UserID:  subscriberID,
+			ActorID: authorID,
+			Type:    models.NotificationWatchedCategory,
+			PostID:  &postID,
+		})
+	}
+
+	return notifications, nil
+}
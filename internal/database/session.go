@@ -99,13 +99,18 @@ func (ss *SessionService) GetUserBySession(token string) (*models.User, error) {
 	}
 
 	var user models.User
-	query := `SELECT id, username, email, password, created FROM users WHERE id = ?`
+	query := `SELECT id, username, email, password, role, created, likes_public, avatar_version, reputation
+			  FROM users WHERE id = ?`
 	err = ss.db.DBConn.QueryRow(query, session.UserID).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.Password,
+		&user.Role,
 		&user.Created,
+		&user.LikesPublic,
+		&user.AvatarVersion,
+		&user.Reputation,
 	)
 
 	if err != nil {
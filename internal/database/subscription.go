@@ -0,0 +1,193 @@
+package database
+
+import (
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+type SubscriptionService struct {
+	db *Database
+}
+
+func NewSubscriptionService(db *Database) *SubscriptionService {
+	return &SubscriptionService{db: db}
+}
+
+// SubscribePost подписывает пользователя на новые комментарии поста
+func (ss *SubscriptionService) SubscribePost(userID, postID int) error {
+	query := `INSERT INTO post_subscriptions (user_id, post_id, subscribed, created) VALUES (?, ?, 1, ?)
+			  ON CONFLICT (user_id, post_id) DO UPDATE SET subscribed = 1`
+	if _, err := ss.db.DBConn.Exec(query, userID, postID, time.Now()); err != nil {
+		return fmt.Errorf("ошибка подписки на пост: %v", err)
+	}
+	return nil
+}
+
+// UnsubscribePost отписывает пользователя от поста. Отписка запоминается,
+// чтобы следующий комментарий не подписал его снова
+func (ss *SubscriptionService) UnsubscribePost(userID, postID int) error {
+	query := `INSERT INTO post_subscriptions (user_id, post_id, subscribed, created) VALUES (?, ?, 0, ?)
+			  ON CONFLICT (user_id, post_id) DO UPDATE SET subscribed = 0`
+	if _, err := ss.db.DBConn.Exec(query, userID, postID, time.Now()); err != nil {
+		return fmt.Errorf("ошибка отписки от поста: %v", err)
+	}
+	return nil
+}
+
+// IsSubscribedToPost проверяет подписку пользователя на пост
+func (ss *SubscriptionService) IsSubscribedToPost(userID, postID int) (bool, error) {
+	var subscribed bool
+	query := `SELECT EXISTS(SELECT 1 FROM post_subscriptions WHERE user_id = ? AND post_id = ? AND subscribed = 1)`
+	err := ss.db.DBConn.QueryRow(query, userID, postID).Scan(&subscribed)
+	return subscribed, err
+}
+
+// SubscribeCategory подписывает пользователя на новые посты категории
+func (ss *SubscriptionService) SubscribeCategory(userID, categoryID int) error {
+	query := `INSERT OR IGNORE INTO category_subscriptions (user_id, category_id, created) VALUES (?, ?, ?)`
+	if _, err := ss.db.DBConn.Exec(query, userID, categoryID, time.Now()); err != nil {
+		return fmt.Errorf("ошибка подписки на категорию: %v", err)
+	}
+	return nil
+}
+
+// UnsubscribeCategory отписывает пользователя от категории
+func (ss *SubscriptionService) UnsubscribeCategory(userID, categoryID int) error {
+	query := `DELETE FROM category_subscriptions WHERE user_id = ? AND category_id = ?`
+	if _, err := ss.db.DBConn.Exec(query, userID, categoryID); err != nil {
+		return fmt.Errorf("ошибка отписки от категории: %v", err)
+	}
+	return nil
+}
+
+// IsSubscribedToCategory проверяет подписку пользователя на категорию
+func (ss *SubscriptionService) IsSubscribedToCategory(userID, categoryID int) (bool, error) {
+	var subscribed bool
+	query := `SELECT EXISTS(SELECT 1 FROM category_subscriptions WHERE user_id = ? AND category_id = ?)`
+	err := ss.db.DBConn.QueryRow(query, userID, categoryID).Scan(&subscribed)
+	return subscribed, err
+}
+
+// GetSubscribedPosts получает посты, на которые подписан пользователь,
+// кроме ставших ему недоступными
+func (ss *SubscriptionService) GetSubscribedPosts(userID int) ([]*models.Post, error) {
+	hidden, err := ss.db.hiddenPostsFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
+			  FROM posts p
+			  JOIN users u ON p.user_id = u.id
+			  JOIN post_subscriptions s ON p.id = s.post_id
+			  WHERE s.user_id = ? AND s.subscribed = 1 AND p.published = 1 AND ` + hidden + `
+			  ORDER BY s.created DESC`
+
+	rows, err := ss.db.DBConn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID,
+			&post.Created, &post.Updated, &post.Username)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetSubscribedCategories получает категории, на которые подписан пользователь
+func (ss *SubscriptionService) GetSubscribedCategories(userID int) ([]*models.Category, error) {
+	query := `SELECT c.id, c.name, c.slug, c.description, c.created
+			  FROM categories c
+			  JOIN category_subscriptions s ON c.id = s.category_id
+			  WHERE s.user_id = ?
+			  ORDER BY c.name`
+
+	rows, err := ss.db.DBConn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.Category
+	for rows.Next() {
+		var category models.Category
+		err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.Description, &category.Created)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// autoSubscribePost подписывает комментатора на пост, если он не отписался явно
+func autoSubscribePost(db execer, userID, postID int) error {
+	query := `INSERT OR IGNORE INTO post_subscriptions (user_id, post_id, subscribed, created) VALUES (?, ?, 1, ?)`
+	if _, err := db.Exec(query, userID, postID, time.Now()); err != nil {
+		return fmt.Errorf("ошибка подписки на пост: %v", err)
+	}
+	return nil
+}
+
+// postSubscriberIDs возвращает ID подписчиков поста
+func postSubscriberIDs(db execer, postID int) ([]int, error) {
+	return queryIDs(db, `SELECT user_id FROM post_subscriptions WHERE post_id = ? AND subscribed = 1`, postID)
+}
+
+// categorySubscriberIDs возвращает ID подписчиков любой из категорий без повторов
+func categorySubscriberIDs(db execer, categoryIDs []int) ([]int, error) {
+	var result []int
+	seen := map[int]bool{}
+	for _, categoryID := range categoryIDs {
+		ids, err := queryIDs(db, `SELECT user_id FROM category_subscriptions WHERE category_id = ?`, categoryID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				result = append(result, id)
+			}
+		}
+	}
+	return result, nil
+}
+
+// queryIDs выполняет запрос, возвращающий один столбец с ID
+func queryIDs(db execer, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
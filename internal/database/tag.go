@@ -0,0 +1,331 @@
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrTagNotFound  = errors.New("тег не найден")
+	ErrLongTag      = errors.New("тег не должен превышать 50 символов")
+	ErrInvalidTag   = errors.New("тег может содержать только буквы, цифры, пробелы, дефис, точку и апостроф")
+	ErrTooManyTags  = errors.New("у поста может быть не больше 10 тегов")
+	ErrTagSetFailed = errors.New("ошибка сохранения тегов")
+)
+
+const (
+	// Максимальное количество тегов у поста
+	MaxPostTags = 10
+	// Максимальная длина тега в символах
+	maxTagLength = 50
+)
+
+type TagService struct {
+	db       *Database
+	synonyms map[string]string // нормализованный синоним -> канонический тег
+}
+
+func NewTagService(db *Database, synonyms map[string]string) *TagService {
+	if synonyms == nil {
+		synonyms = map[string]string{}
+	}
+	return &TagService{db: db, synonyms: synonyms}
+}
+
+// LoadTagSynonyms читает файл синонимов в формате "тег: синоним, синоним".
+// Отсутствующий файл означает пустой словарь
+func LoadTagSynonyms(path string) (map[string]string, error) {
+	synonyms := map[string]string{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return synonyms, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		canonical, variants, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: ожидается формат \"тег: синоним, синоним\"", path, line)
+		}
+
+		canonical = normalizeTag(canonical)
+		for _, variant := range strings.Split(variants, ",") {
+			if variant = normalizeTag(variant); variant != "" {
+				synonyms[variant] = canonical
+			}
+		}
+	}
+
+	return synonyms, scanner.Err()
+}
+
+// Normalize приводит тег к каноническому виду с учётом синонимов
+func (ts *TagService) Normalize(name string) string {
+	name = normalizeTag(name)
+	if canonical, ok := ts.synonyms[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// ParseTags разбирает строку тегов через запятую, нормализует и убирает повторы
+func (ts *TagService) ParseTags(input string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, raw := range strings.Split(input, ",") {
+		name := ts.Normalize(raw)
+		if name == "" || seen[name] {
+			continue
+		}
+		if err := validateTag(name); err != nil {
+			return nil, err
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	if len(names) > MaxPostTags {
+		return nil, ErrTooManyTags
+	}
+
+	return names, nil
+}
+
+// setPostTags заменяет теги поста; недостающие теги создаются
+func setPostTags(tx *sql.Tx, postID int, names []string) error {
+	if _, err := tx.Exec(`DELETE FROM post_tags WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("%w: %v", ErrTagSetFailed, err)
+	}
+
+	for _, name := range names {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO tags (name, created) VALUES (?, ?)`, name, time.Now())
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrTagSetFailed, err)
+		}
+
+		_, err = tx.Exec(`INSERT OR IGNORE INTO post_tags (post_id, tag_id)
+						  SELECT ?, id FROM tags WHERE name = ?`, postID, name)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrTagSetFailed, err)
+		}
+	}
+
+	return nil
+}
+
+// postTagNames получает имена тегов поста
+func postTagNames(db execer, postID int) ([]string, error) {
+	rows, err := db.Query(`SELECT t.name FROM tags t JOIN post_tags pt ON pt.tag_id = t.id
+						   WHERE pt.post_id = ? ORDER BY t.name`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// GetTagByName получает тег по имени (имя нормализуется)
+func (ts *TagService) GetTagByName(name string) (*models.Tag, error) {
+	var tag models.Tag
+	query := `SELECT id, name, created FROM tags WHERE name = ?`
+
+	err := ts.db.DBConn.QueryRow(query, ts.Normalize(name)).Scan(&tag.ID, &tag.Name, &tag.Created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// GetPostTags получает теги поста
+func (ts *TagService) GetPostTags(postID int) ([]*models.Tag, error) {
+	query := `SELECT t.id, t.name, t.created
+			  FROM tags t
+			  JOIN post_tags pt ON t.id = pt.tag_id
+			  WHERE pt.post_id = ?
+			  ORDER BY t.name`
+
+	rows, err := ts.db.DBConn.Query(query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Created); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// GetTagPosts получает страницу постов с тегом, доступных пользователю viewerID
+// (0 - гость), новые сначала. Если categoryID не 0, дополнительно фильтрует
+// по категории. before - курсор, как в GetAllPosts
+func (ts *TagService) GetTagPosts(tagID, categoryID, viewerID int, before *FeedCursor, limit int) ([]*models.Post, error) {
+	hidden, err := ts.db.hiddenPostsFilter(viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.id, p.title, p.content, p.user_id, p.created, p.updated, u.username
+			  FROM posts p
+			  JOIN users u ON p.user_id = u.id
+			  JOIN post_tags pt ON p.id = pt.post_id
+			  WHERE pt.tag_id = ? AND p.published = 1 AND ` + hidden + ` AND ` + feedCursorCondition + `
+			    AND (? = 0 OR p.id IN (SELECT post_id FROM post_categories WHERE category_id = ?))
+			  ORDER BY p.created DESC, p.id DESC
+			  LIMIT ?`
+
+	args := append([]interface{}{tagID}, before.args()...)
+	return NewPostService(ts.db).queryFeed(query, append(args, categoryID, categoryID), limit)
+}
+
+// SuggestTags подсказывает популярные теги по префиксу. Считаются только посты,
+// доступные пользователю viewerID (0 - гость); теги без таких постов не подсказываются
+func (ts *TagService) SuggestTags(prefix string, viewerID, limit int) ([]*models.Tag, error) {
+	prefix = normalizeTag(prefix)
+	if prefix == "" {
+		return nil, nil
+	}
+
+	hidden, err := ts.db.hiddenPostsFilter(viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Экранируем спецсимволы LIKE
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	query := `SELECT t.id, t.name, t.created, COUNT(pt.post_id) AS cnt
+			  FROM tags t
+			  JOIN post_tags pt ON t.id = pt.tag_id
+			      AND pt.post_id IN (SELECT p.id FROM posts p WHERE p.published = 1 AND ` + hidden + `)
+			  WHERE t.name LIKE ? ESCAPE '\'
+			  GROUP BY t.id
+			  ORDER BY cnt DESC, t.name
+			  LIMIT ?`
+
+	return ts.queryTagCounts(query, escaped+"%", limit)
+}
+
+// GetTagCloud получает самые используемые теги с количеством постов,
+// доступных пользователю viewerID (0 - гость)
+func (ts *TagService) GetTagCloud(viewerID, limit int) ([]*models.Tag, error) {
+	hidden, err := ts.db.hiddenPostsFilter(viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT t.id, t.name, t.created, COUNT(pt.post_id) AS cnt
+			  FROM tags t
+			  JOIN post_tags pt ON t.id = pt.tag_id
+			  JOIN posts p ON pt.post_id = p.id
+			  WHERE p.published = 1 AND ` + hidden + `
+			  GROUP BY t.id
+			  ORDER BY cnt DESC, t.name
+			  LIMIT ?`
+
+	tags, err := ts.queryTagCounts(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Облако показываем по алфавиту, размер зависит от количества
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// queryTagCounts выполняет запрос, возвращающий теги с количеством постов
+func (ts *TagService) queryTagCounts(query string, args ...interface{}) ([]*models.Tag, error) {
+	rows, err := ts.db.DBConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Created, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// normalizeTag приводит имя к нижнему регистру и схлопывает пробелы
+func normalizeTag(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// validateTag проверяет длину и допустимые символы тега
+func validateTag(name string) error {
+	if utf8.RuneCountInString(name) > maxTagLength {
+		return ErrLongTag
+	}
+	// Тег из одних знаков препинания не имеет смысла
+	hasAlnum := false
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			hasAlnum = true
+			continue
+		}
+		switch r {
+		case ' ', '-', '.', '\'':
+			continue
+		}
+		return ErrInvalidTag
+	}
+	if !hasAlnum {
+		return ErrInvalidTag
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotModerator      = errors.New("переносить, объединять и разделять темы могут только модераторы")
+	ErrMergeIntoItself   = errors.New("нельзя объединить пост с самим собой")
+	ErrNoCommentsToSplit = errors.New("выберите комментарии для нового поста")
+)
+
+// threadPost - данные поста, нужные для переноса обсуждения
+type threadPost struct {
+	userID      int
+	title       string
+	content     string
+	contentHTML string
+	created     time.Time
+}
+
+// getThreadPost получает пост для переноса обсуждения
+func getThreadPost(db execer, postID int) (*threadPost, error) {
+	var post threadPost
+	err := db.QueryRow(`SELECT user_id, title, content, content_html, created FROM posts WHERE id = ?`, postID).Scan(
+		&post.userID, &post.title, &post.content, &post.contentHTML, &post.created)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+	return &post, err
+}
+
+// checkThreadPost проверяет, что пост существует и виден модератору
+func (ps *PostService) checkThreadPost(moderatorID, postID int) error {
+	allowed, err := ps.db.canAccessPost(moderatorID, postID, models.CategoryView)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// checkThreadCategories проверяет, что категории существуют и видны модератору.
+// Публиковать в них модератору не обязательно: так посты переносят в архив
+func (ps *PostService) checkThreadCategories(moderatorID int, categoryIDs []int) error {
+	for _, categoryID := range categoryIDs {
+		var exists bool
+		err := ps.db.DBConn.QueryRow(`SELECT EXISTS(SELECT 1 FROM categories WHERE id = ?)`, categoryID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrCategoryNotFound
+		}
+	}
+
+	allowed, err := ps.db.canAccessCategories(moderatorID, categoryIDs, models.CategoryView)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// movedNotifications уведомляет авторов перенесённых публикаций, кроме модератора
+func movedNotifications(moderatorID, postID int, commentID *int, authorIDs ...int) []*models.Notification {
+	var notifications []*models.Notification
+	notified := map[int]bool{moderatorID: true}
+	for _, authorID := range authorIDs {
+		if notified[authorID] {
+			continue
+		}
+		notified[authorID] = true
+		notifications = append(notifications, &models.Notification{
+			UserID:    authorID,
+			ActorID:   moderatorID,
+			Type:      models.NotificationMoved,
+			PostID:    &postID,
+			CommentID: commentID,
+		})
+	}
+	return notifications
+}
+
+// MovePost переносит пост в другие категории. Перенос сохраняется в истории
+// правок поста, а версия увеличивается, чтобы открытая форма правки не вернула
+// старые категории
+func (ps *PostService) MovePost(postID int, categoryIDs []int, moderatorID int) error {
+	if !NewUserService(ps.db).IsModerator(moderatorID) {
+		return ErrNotModerator
+	}
+
+	if err := ps.checkThreadPost(moderatorID, postID); err != nil {
+		return err
+	}
+	if err := ps.checkThreadCategories(moderatorID, categoryIDs); err != nil {
+		return err
+	}
+
+	tx, err := ps.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	post, err := getThreadPost(tx, postID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM post_categories WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("ошибка переноса поста: %v", err)
+	}
+	for _, categoryID := range categoryIDs {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)`, postID, categoryID)
+		if err != nil {
+			return fmt.Errorf("ошибка переноса поста: %v", err)
+		}
+	}
+
+	if _, err = tx.Exec(`UPDATE posts SET version = version + 1, updated = ? WHERE id = ?`, time.Now(), postID); err != nil {
+		return fmt.Errorf("ошибка переноса поста: %v", err)
+	}
+
+	if err = insertPostRevision(tx, postID, moderatorID, post.title, post.content, categoryIDs); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	ps.db.deliver(movedNotifications(moderatorID, postID, nil, post.userID))
+
+	return nil
+}
+
+// MergePost объединяет дубликат sourceID с постом targetID: текст дубликата
+// становится комментарием от имени его автора, комментарии, подписки и закладки
+// переезжают в targetID, а старый адрес перенаправляет на targetID.
+// Реакции на сам дубликат удаляются, и репутация его автора уменьшается на их очки;
+// опрос и история правок дубликата удаляются
+func (ps *PostService) MergePost(sourceID, targetID, moderatorID int) error {
+	if sourceID == targetID {
+		return ErrMergeIntoItself
+	}
+	if !NewUserService(ps.db).IsModerator(moderatorID) {
+		return ErrNotModerator
+	}
+	for _, postID := range []int{sourceID, targetID} {
+		if err := ps.checkThreadPost(moderatorID, postID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := ps.db.DBConn.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	source, err := getThreadPost(tx, sourceID)
+	if err != nil {
+		return err
+	}
+	if _, err = getThreadPost(tx, targetID); err != nil {
+		return err
+	}
+
+	commenterIDs, err := queryIDs(tx, `SELECT DISTINCT user_id FROM comments WHERE post_id = ?`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Текст дубликата - первый из перенесённых комментариев
+	var commentID int
+	query := `INSERT INTO comments (content, content_html, post_id, user_id, created, updated)
+			  VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+	err = tx.QueryRow(query, source.content, source.contentHTML, targetID, source.userID, source.created, time.Now()).Scan(&commentID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCommentCreateFailed, err)
+	}
+	if err = insertCommentRevision(tx, commentID, source.userID, source.content); err != nil {
+		return err
+	}
+
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		// Реакции на дубликат удаляются вместе с уведомлениями о них
+		{`DELETE FROM notifications WHERE post_id = ? AND comment_id IS NULL AND type = ?`,
+			[]interface{}{sourceID, models.NotificationReaction}},
+		// Упоминания и уведомления из текста дубликата теперь относятся к комментарию
+		{`UPDATE mentions SET post_id = ?, comment_id = ? WHERE post_id = ? AND comment_id IS NULL`,
+			[]interface{}{targetID, commentID, sourceID}},
+		{`UPDATE notifications SET comment_id = ? WHERE post_id = ? AND comment_id IS NULL AND type = ?`,
+			[]interface{}{commentID, sourceID, models.NotificationMention}},
+		{`UPDATE comments SET post_id = ? WHERE post_id = ?`, []interface{}{targetID, sourceID}},
+		{`UPDATE mentions SET post_id = ? WHERE post_id = ?`, []interface{}{targetID, sourceID}},
+		{`UPDATE notifications SET post_id = ? WHERE post_id = ?`, []interface{}{targetID, sourceID}},
+		{`UPDATE attachments SET post_id = ? WHERE post_id = ?`, []interface{}{targetID, sourceID}},
+		{`INSERT OR IGNORE INTO post_subscriptions (user_id, post_id, subscribed, created)
+		  SELECT user_id, ?, subscribed, created FROM post_subscriptions WHERE post_id = ?`,
+			[]interface{}{targetID, sourceID}},
+		{`UPDATE OR IGNORE bookmarks SET post_id = ? WHERE post_id = ?`, []interface{}{targetID, sourceID}},
+		// Старые перенаправления на дубликат ведут сразу на targetID
+		{`UPDATE post_redirects SET target_id = ? WHERE target_id = ?`, []interface{}{targetID, sourceID}},
+		{`INSERT OR REPLACE INTO post_redirects (post_id, target_id, created) VALUES (?, ?, ?)`,
+			[]interface{}{sourceID, targetID, time.Now()}},
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query, q.args...); err != nil {
+			return fmt.Errorf("ошибка объединения постов: %v", err)
+		}
+	}
+
+	// Остальное удаляется вместе с дубликатом: опрос не переносится, потому что
+	// у поста может быть только один опрос, а история правок дубликата
+	// заканчивается его текстом, который стал комментарием
+	if err = deletePostRows(tx, sourceID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	notifications := movedNotifications(moderatorID, targetID, &commentID, source.userID)
+	for _, notification := range movedNotifications(moderatorID, targetID, nil, commenterIDs...) {
+		// Автор дубликата уже получил уведомление о своём тексте
+		if notification.UserID != source.userID {
+			notifications = append(notifications, notification)
+		}
+	}
+	ps.db.deliver(notifications)
+
+	return nil
+}
+
+// SplitPost выделяет комментарии commentIDs поста postID в новый пост с заголовком
+// title. Первый по времени комментарий становится текстом поста от имени его
+// автора, вместе со своими реакциями и упоминаниями; остальные переезжают как есть.
+// Ответы, родитель которых остался в другом посте, становятся ответами на пост
+func (ps *PostService) SplitPost(postID int, commentIDs []int, title string, categoryIDs []int,
+	moderatorID int) (*models.Post, error) {
+
+	if len(commentIDs) == 0 {
+		return nil, ErrNoCommentsToSplit
+	}
+	if !NewUserService(ps.db).IsModerator(moderatorID) {
+		return nil, ErrNotModerator
+	}
+	if err := ps.checkThreadPost(moderatorID, postID); err != nil {
+		return nil, err
+	}
+	if err := ps.checkThreadCategories(moderatorID, categoryIDs); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{postID}
+	seen := map[int]bool{}
+	for _, id := range commentIDs {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)-1), ",")
+
+	tx, err := ps.db.DBConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = getThreadPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT id, content, content_html, user_id, created FROM comments
+						   WHERE post_id = ? AND id IN (`+placeholders+`)
+						   ORDER BY created, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var comments []*models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		if err := rows.Scan(&comment.ID, &comment.Content, &comment.ContentHTML, &comment.UserID, &comment.Created); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	if len(comments) != len(args)-1 {
+		return nil, ErrCommentNotFound
+	}
+
+	first := comments[0]
+	if err := ps.validatePostData(title, first.Content); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	post := models.Post{
+		Title:       title,
+		Content:     first.Content,
+		ContentHTML: first.ContentHTML,
+		UserID:      first.UserID,
+		Version:     1,
+		Published:   true,
+		Created:     first.Created,
+		Updated:     now,
+	}
+
+	query := `INSERT INTO posts (title, content, content_html, user_id, published, created, updated)
+			  VALUES (?, ?, ?, ?, 1, ?, ?) RETURNING id`
+	err = tx.QueryRow(query, title, first.Content, first.ContentHTML, first.UserID, first.Created, now).Scan(&post.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPostCreateFailed, err)
+	}
+
+	for _, categoryID := range categoryIDs {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)`, post.ID, categoryID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка назначения категории: %v", err)
+		}
+	}
+
+	if err = insertPostRevision(tx, post.ID, first.UserID, title, first.Content, categoryIDs); err != nil {
+		return nil, err
+	}
+
+	// args без postID - ID выделяемых комментариев
+	movedArgs := append([]interface{}{post.ID}, args[1:]...)
+
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		// Первый комментарий становится самим постом
+		{`UPDATE likes SET post_id = ?, comment_id = NULL WHERE comment_id = ?`, []interface{}{post.ID, first.ID}},
+		{`UPDATE mentions SET post_id = ?, comment_id = NULL WHERE comment_id = ?`, []interface{}{post.ID, first.ID}},
+		{`UPDATE notifications SET post_id = ?, comment_id = NULL WHERE comment_id = ?`, []interface{}{post.ID, first.ID}},
+		{`DELETE FROM comment_revisions WHERE comment_id = ?`, []interface{}{first.ID}},
+		{`DELETE FROM comments WHERE id = ?`, []interface{}{first.ID}},
+		{`UPDATE comments SET post_id = ? WHERE id IN (` + placeholders + `)`, movedArgs},
+		{`UPDATE mentions SET post_id = ? WHERE comment_id IN (` + placeholders + `)`, movedArgs},
+		{`UPDATE notifications SET post_id = ? WHERE comment_id IN (` + placeholders + `)`, movedArgs},
+		// Ответы не ссылаются на комментарии из другого поста
+		{`UPDATE comments SET parent_id = NULL
+		  WHERE post_id = ? AND parent_id NOT IN (SELECT id FROM comments WHERE post_id = ?)`,
+			[]interface{}{post.ID, post.ID}},
+		{`UPDATE comments SET parent_id = NULL
+		  WHERE post_id = ? AND parent_id NOT IN (SELECT id FROM comments WHERE post_id = ?)`,
+			[]interface{}{postID, postID}},
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query, q.args...); err != nil {
+			return nil, fmt.Errorf("ошибка разделения поста: %v", err)
+		}
+	}
+
+	// Авторы выделенных комментариев следят за новым обсуждением
+	var authorIDs []int
+	for _, comment := range comments {
+		if !containsInt(authorIDs, comment.UserID) {
+			authorIDs = append(authorIDs, comment.UserID)
+		}
+	}
+	for _, authorID := range authorIDs {
+		if err = autoSubscribePost(tx, authorID, post.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	ps.db.deliver(movedNotifications(moderatorID, post.ID, nil, authorIDs...))
+	ps.db.checkBadges(first.UserID)
+
+	return &post, nil
+}
+
+// GetRedirect возвращает пост, с которым объединён удалённый пост postID
+func (ps *PostService) GetRedirect(postID int) (int, error) {
+	var targetID int
+	err := ps.db.DBConn.QueryRow(`SELECT target_id FROM post_redirects WHERE post_id = ?`, postID).Scan(&targetID)
+	if err == sql.ErrNoRows {
+		return 0, ErrPostNotFound
+	}
+	return targetID, err
+}
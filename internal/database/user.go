@@ -26,6 +26,7 @@ var (
 	ErrUserCreateFailed   = errors.New("ошибка создания пользователя")
 	ErrEmailNotFound      = errors.New("пользователь с таким email не найден")
 	ErrIncorrectPassword  = errors.New("неверный пароль")
+	ErrUserNotFound       = errors.New("пользователь не найден")
 )
 
 type UserService struct {
@@ -70,6 +71,7 @@ func (us *UserService) CreateUser(username, email, password string) (*models.Use
 	user.Username = username
 	user.Email = email
 	user.Password = hashedPassword
+	user.Role = models.RoleUser
 
 	return &user, nil
 }
@@ -96,6 +98,87 @@ func (us *UserService) VerifyUser(email, password string) (int, string, error) {
 	return id, username, nil
 }
 
+// IsModerator проверяет, есть ли у пользователя права модератора
+func (us *UserService) IsModerator(userID int) bool {
+	var role string
+	query := `SELECT role FROM users WHERE id = ?`
+	err := us.db.DBConn.QueryRow(query, userID).Scan(&role)
+	if err != nil {
+		return false
+	}
+	return role == models.RoleModerator || role == models.RoleAdmin
+}
+
+// GetUserByUsername получает публичные данные пользователя по имени (без email и пароля)
+func (us *UserService) GetUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	query := `SELECT id, username, role, created, likes_public, avatar_version, reputation FROM users WHERE username = ?`
+	err := us.db.DBConn.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Role, &user.Created,
+		&user.LikesPublic, &user.AvatarVersion, &user.Reputation)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetAuthor получает то, что показывается рядом с именем автора: версию аватара и репутацию
+func (us *UserService) GetAuthor(userID int) (*models.User, error) {
+	user := models.User{ID: userID}
+	query := `SELECT username, avatar_version, reputation FROM users WHERE id = ?`
+	err := us.db.DBConn.QueryRow(query, userID).Scan(&user.Username, &user.AvatarVersion, &user.Reputation)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetLikesPublic открывает или скрывает лайкнутые пользователем посты на его публичной странице
+func (us *UserService) SetLikesPublic(userID int, public bool) error {
+	_, err := us.db.DBConn.Exec(`UPDATE users SET likes_public = ? WHERE id = ?`, public, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения настроек профиля: %v", err)
+	}
+	return nil
+}
+
+// SuggestUsernames подсказывает имена пользователей по префиксу
+func (us *UserService) SuggestUsernames(prefix string, limit int) ([]string, error) {
+	if prefix == "" {
+		return nil, nil
+	}
+
+	// Экранируем спецсимволы LIKE
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	query := `SELECT username FROM users WHERE username LIKE ? ESCAPE '\' ORDER BY username LIMIT ?`
+	rows, err := us.db.DBConn.Query(query, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return usernames, nil
+}
+
 // checkUserUniqueness проверяет уникальность username и email
 func (us *UserService) checkUserUniqueness(username, email string) error {
 	// Проверяем username
@@ -109,6 +192,15 @@ func (us *UserService) checkUserUniqueness(username, email string) error {
 		return fmt.Errorf("ошибка проверки уникальности username: %v", err)
 	}
 
+	// Имя не должно совпадать со slug группы, иначе @username упоминал бы группу
+	err = us.db.DBConn.QueryRow(`SELECT 1 FROM user_groups WHERE slug = ?`, username).Scan(&exists)
+	if err != sql.ErrNoRows {
+		if err == nil {
+			return ErrUsernameExists
+		}
+		return fmt.Errorf("ошибка проверки уникальности username: %v", err)
+	}
+
 	// Проверяем email
 	query = `SELECT 1 FROM users WHERE email = ?`
 	err = us.db.DBConn.QueryRow(query, email).Scan(&exists)
@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxCells ограничивает таблицу сравнения: время и память растут как
+// произведение числа различающихся строк двух текстов
+const MaxCells = 1 << 20
+
+// ErrTooLarge - тексты различаются слишком многими строками для сравнения
+var ErrTooLarge = errors.New("изменения слишком большие для построчного сравнения")
+
+// Типы строк в результате сравнения
+const (
+	OpEqual  = " "
+	OpInsert = "+"
+	OpDelete = "-"
+)
+
+// Line - строка построчного сравнения двух текстов
+type Line struct {
+	Op   string // OpEqual, OpInsert или OpDelete
+	Text string // Текст строки
+}
+
+// Lines сравнивает два текста построчно через наибольшую общую подпоследовательность.
+// Общие начало и конец текстов не сравниваются; если оставшаяся таблица больше
+// MaxCells, возвращает ErrTooLarge
+func Lines(a, b string) ([]Line, error) {
+	x := splitLines(a)
+	y := splitLines(b)
+
+	var head, tail []Line
+	for len(x) > 0 && len(y) > 0 && x[0] == y[0] {
+		head = append(head, Line{Op: OpEqual, Text: x[0]})
+		x, y = x[1:], y[1:]
+	}
+	for len(x) > 0 && len(y) > 0 && x[len(x)-1] == y[len(y)-1] {
+		tail = append(tail, Line{Op: OpEqual, Text: x[len(x)-1]})
+		x, y = x[:len(x)-1], y[:len(y)-1]
+	}
+
+	if (len(x)+1)*(len(y)+1) > MaxCells {
+		return nil, ErrTooLarge
+	}
+
+	// lcs[i][j] - длина общей подпоследовательности x[i:] и y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := head
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Op: OpEqual, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: OpDelete, Text: x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: OpInsert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Op: OpDelete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Op: OpInsert, Text: y[j]})
+	}
+	for k := len(tail) - 1; k >= 0; k-- {
+		lines = append(lines, tail[k])
+	}
+
+	return lines, nil
+}
+
+// splitLines разбивает текст на строки, нормализуя переводы строк
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(s, "\n")
+}
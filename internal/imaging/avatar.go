@@ -0,0 +1,106 @@
+package imaging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// AvatarSizes - стороны квадратных вариантов аватара в пикселях
+var AvatarSizes = []int{32, 64, 128, 256}
+
+// identiconGrid - число клеток идентикона по каждой стороне
+const identiconGrid = 5
+
+// Avatar декодирует загруженное изображение, обрезает его до квадрата по центру
+// и создаёт варианты всех размеров из AvatarSizes. Имя варианта - его сторона.
+// Анимация GIF не сохраняется: аватар строится по первому кадру
+func Avatar(data []byte, mimeType string) ([]Variant, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if mimeType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	square := centerSquare(img.Bounds())
+	outType := outputType(mimeType, img)
+
+	var variants []Variant
+	for _, size := range AvatarSizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, square, draw.Src, nil)
+
+		variant, err := encode(strconv.Itoa(size), dst, outType)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// Identicon рисует PNG-идентикон: симметричный узор 5x5, однозначно
+// определяемый seed. Один и тот же seed всегда даёт одну и ту же картинку
+func Identicon(seed string, size int) ([]byte, error) {
+	sum := sha256.Sum256([]byte(seed))
+
+	// Цвет из первых байтов хеша, приглушённый, чтобы узор был виден на светлом фоне
+	fg := color.RGBA{R: 40 + sum[0]%160, G: 40 + sum[1]%160, B: 40 + sum[2]%160, A: 255}
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+
+	// Левая половина с центральным столбцом берётся из битов хеша, правая - её отражение
+	var cells [identiconGrid][identiconGrid]bool
+	bit := 0
+	for col := 0; col < (identiconGrid+1)/2; col++ {
+		for row := 0; row < identiconGrid; row++ {
+			on := sum[3+bit/8]&(1<<(bit%8)) != 0
+			cells[row][col] = on
+			cells[row][identiconGrid-1-col] = on
+			bit++
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if cells[y*identiconGrid/size][x*identiconGrid/size] {
+				img.Set(x, y, fg)
+			} else {
+				img.Set(x, y, bg)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// centerSquare возвращает наибольший квадрат в центре прямоугольника
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+
+	min := bounds.Min.Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(side, side))}
+}
@@ -0,0 +1,250 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("не удалось прочитать изображение")
+	ErrImageTooLarge    = errors.New("изображение слишком большое по размерам")
+)
+
+// Названия вариантов изображения
+const (
+	VariantOriginal  = "original"
+	VariantMedium    = "medium"
+	VariantThumbnail = "thumbnail"
+)
+
+const (
+	// Ширина уменьшенных вариантов в пикселях
+	ThumbnailWidth = 320
+	MediumWidth    = 1024
+	// Защита от "бомб распаковки": максимальное количество пикселей
+	// (у GIF - во всех кадрах вместе) и кадров анимации
+	maxPixels    = 50_000_000
+	maxGIFFrames = 1000
+	// Качество JPEG для всех вариантов
+	jpegQuality = 88
+)
+
+// Variant - готовый к сохранению вариант изображения
+type Variant struct {
+	Name     string // VariantOriginal, VariantMedium или VariantThumbnail
+	Data     []byte // Закодированный файл без метаданных
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// Process декодирует изображение, исправляет ориентацию по EXIF и перекодирует его,
+// отбрасывая все метаданные (в том числе GPS). Возвращает оригинал и уменьшенные
+// варианты; варианты шире оригинала не создаются
+func Process(data []byte, mimeType string) ([]Variant, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	var original Variant
+	var img image.Image
+
+	if mimeType == "image/gif" {
+		// GIF перекодируем целиком, чтобы сохранить анимацию
+		original, img, err = processGIF(data)
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrUnsupportedImage
+		}
+		if mimeType == "image/jpeg" {
+			img = applyOrientation(img, jpegOrientation(data))
+		}
+		original, err = encode(VariantOriginal, img, outputType(mimeType, img))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	variants := []Variant{original}
+
+	// Уменьшенные варианты GIF сохраняем как PNG (первый кадр)
+	resizedType := outputType(mimeType, img)
+	if mimeType == "image/gif" {
+		resizedType = "image/png"
+	}
+
+	for _, size := range []struct {
+		name  string
+		width int
+	}{{VariantMedium, MediumWidth}, {VariantThumbnail, ThumbnailWidth}} {
+		if img.Bounds().Dx() <= size.width {
+			continue
+		}
+		variant, err := encode(size.name, resize(img, size.width), resizedType)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// processGIF перекодирует GIF со всеми кадрами и возвращает первый кадр
+func processGIF(data []byte) (Variant, image.Image, error) {
+	// DecodeConfig проверяет только логический экран, а DecodeAll создаёт
+	// изображение для каждого кадра, поэтому кадры считаем заранее
+	frames, pixels, err := gifFrames(data)
+	if err != nil {
+		return Variant{}, nil, err
+	}
+	if frames > maxGIFFrames || pixels > maxPixels {
+		return Variant{}, nil, ErrImageTooLarge
+	}
+
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(animation.Image) == 0 {
+		return Variant{}, nil, ErrUnsupportedImage
+	}
+
+	// Комментарии и прочие расширения GIF при кодировании не сохраняются
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		return Variant{}, nil, err
+	}
+
+	variant := Variant{
+		Name:     VariantOriginal,
+		Data:     buf.Bytes(),
+		MimeType: "image/gif",
+		Width:    animation.Config.Width,
+		Height:   animation.Config.Height,
+	}
+
+	return variant, animation.Image[0], nil
+}
+
+// gifFrames проходит по блокам GIF, не распаковывая их, и возвращает количество
+// кадров и суммарную площадь кадров в пикселях
+func gifFrames(data []byte) (int, int, error) {
+	// Заголовок и дескриптор логического экрана с глобальной палитрой
+	if len(data) < 13 {
+		return 0, 0, ErrUnsupportedImage
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipSubBlocks пропускает цепочку подблоков, заканчивающуюся нулевым
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return pos <= len(data)
+			}
+		}
+		return false
+	}
+
+	frames, pixels := 0, 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // расширение: метка и подблоки
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, 0, ErrUnsupportedImage
+			}
+		case 0x2C: // кадр: дескриптор, локальная палитра, размер кода LZW и данные
+			if pos+10 > len(data) {
+				return 0, 0, ErrUnsupportedImage
+			}
+			width := int(data[pos+5]) | int(data[pos+6])<<8
+			height := int(data[pos+7]) | int(data[pos+8])<<8
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+			if !skipSubBlocks() {
+				return 0, 0, ErrUnsupportedImage
+			}
+			frames++
+			pixels += width * height
+		case 0x3B: // конец файла
+			return frames, pixels, nil
+		default:
+			return 0, 0, ErrUnsupportedImage
+		}
+	}
+
+	// Файл без завершающего блока DecodeAll тоже читает
+	return frames, pixels, nil
+}
+
+// outputType выбирает формат для перекодирования. WebP кодировать без cgo нельзя,
+// поэтому он сохраняется как PNG (с прозрачностью) или JPEG
+func outputType(mimeType string, img image.Image) string {
+	switch mimeType {
+	case "image/jpeg":
+		return "image/jpeg"
+	case "image/png", "image/gif":
+		return "image/png"
+	}
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// encode кодирует изображение в выбранный формат
+func encode(name string, img image.Image, mimeType string) (Variant, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch mimeType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	default:
+		mimeType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Variant{}, err
+	}
+
+	return Variant{
+		Name:     name,
+		Data:     buf.Bytes(),
+		MimeType: mimeType,
+		Width:    img.Bounds().Dx(),
+		Height:   img.Bounds().Dy(),
+	}, nil
+}
+
+// resize уменьшает изображение до заданной ширины с сохранением пропорций
+func resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,71 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// linkRel - значение rel для ссылок из пользовательского контента
+const linkRel = "nofollow ugc"
+
+var (
+	// renderer переводит CommonMark в HTML. Сырой HTML в тексте не пропускается
+	renderer = goldmark.New(
+		goldmark.WithExtensions(extension.Linkify),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(
+				util.Prioritized(mentionTransformer{}, 200),
+				util.Prioritized(linkRelTransformer{}, 100),
+			),
+		),
+		goldmark.WithRendererOptions(html.WithHardWraps()),
+	)
+
+	// policy - белый список тегов и атрибутов для итогового HTML
+	policy = newPolicy()
+)
+
+// Render преобразует Markdown в безопасный HTML
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := renderer.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// newPolicy создаёт политику санитайзера: стандартные теги пользовательского
+// контента, классы подсветки у блоков кода и упоминаний, rel="nofollow ugc" у ссылок
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-zA-Z0-9_+-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^mention$`)).OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^` + linkRel + `$`)).OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+// linkRelTransformer проставляет rel всем ссылкам в документе
+type linkRelTransformer struct{}
+
+func (linkRelTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindLink, ast.KindAutoLink:
+			n.SetAttributeString("rel", []byte(linkRel))
+		}
+		return ast.WalkContinue, nil
+	})
+}
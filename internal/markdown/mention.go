@@ -0,0 +1,154 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// mentionPattern находит @username; перед @ не должно быть буквы, цифры
+// или другого @, чтобы не цеплять адреса почты
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@/-])@([A-Za-z0-9_-]{3,50})`)
+
+// mentionsKey - ключ контекста парсера с адресами ссылок для упомянутых имён
+var mentionsKey = parser.NewContextKey()
+
+// Mentions возвращает имена, упомянутые в тексте через @username, без повторов.
+// Упоминания внутри кода и ссылок не учитываются
+func Mentions(source string) []string {
+	src := []byte(source)
+	doc := renderer.Parser().Parse(text.NewReader(src))
+
+	var names []string
+	seen := map[string]bool{}
+	for _, node := range mentionTextNodes(doc) {
+		segment := node.Segment
+		for _, match := range mentionPattern.FindAllSubmatch(segment.Value(src), -1) {
+			name := string(match[1])
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// RenderWithMentions работает как Render, но превращает упоминания в ссылки:
+// links - имя -> адрес (профиль пользователя или страница группы).
+// Имена, которых нет в links, остаются текстом
+func RenderWithMentions(source string, links map[string]string) (string, error) {
+	pc := parser.NewContext()
+	pc.Set(mentionsKey, links)
+
+	var buf bytes.Buffer
+	if err := renderer.Convert([]byte(source), &buf, parser.WithContext(pc)); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// mentionTransformer заменяет @username ссылками, если в контексте парсера
+// переданы адреса ссылок для упомянутых имён
+type mentionTransformer struct{}
+
+func (mentionTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	links, _ := pc.Get(mentionsKey).(map[string]string)
+	if len(links) == 0 {
+		return
+	}
+
+	src := reader.Source()
+	for _, node := range mentionTextNodes(doc) {
+		linkMentions(node, src, links)
+	}
+}
+
+// mentionTextNodes собирает текстовые узлы, в которых могут быть упоминания
+func mentionTextNodes(doc ast.Node) []*ast.Text {
+	var nodes []*ast.Text
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindCodeSpan, ast.KindCodeBlock, ast.KindFencedCodeBlock,
+			ast.KindLink, ast.KindAutoLink, ast.KindHTMLBlock, ast.KindRawHTML:
+			return ast.WalkSkipChildren, nil
+		case ast.KindText:
+			nodes = append(nodes, n.(*ast.Text))
+		default:
+			mergeTextNodes(n)
+		}
+		return ast.WalkContinue, nil
+	})
+	return nodes
+}
+
+// mergeTextNodes склеивает соседние текстовые узлы, идущие в исходнике
+// подряд: парсер разрывает текст на символах-разделителях вроде "_",
+// и без склейки @bob_smith выглядел бы как упоминание @bob_
+func mergeTextNodes(parent ast.Node) {
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		current, ok := child.(*ast.Text)
+		if !ok {
+			continue
+		}
+		for {
+			next, ok := current.NextSibling().(*ast.Text)
+			if !ok || current.SoftLineBreak() || current.HardLineBreak() || current.IsRaw() ||
+				next.IsRaw() || current.Segment.Stop != next.Segment.Start {
+				break
+			}
+			current.Segment = current.Segment.WithStop(next.Segment.Stop)
+			current.SetSoftLineBreak(next.SoftLineBreak())
+			current.SetHardLineBreak(next.HardLineBreak())
+			parent.RemoveChild(parent, next)
+		}
+	}
+}
+
+// linkMentions разбивает текстовый узел на текст и ссылки на профили и группы
+func linkMentions(node *ast.Text, src []byte, links map[string]string) {
+	segment := node.Segment
+	value := segment.Value(src)
+	parent := node.Parent()
+
+	start := 0
+	replaced := false
+	for _, match := range mentionPattern.FindAllSubmatchIndex(value, -1) {
+		// match[2]-1 - позиция символа @
+		at, end := match[2]-1, match[3]
+		destination, ok := links[string(value[match[2]:match[3]])]
+		if !ok {
+			continue
+		}
+
+		if at > start {
+			parent.InsertBefore(parent, node, ast.NewTextSegment(text.NewSegment(segment.Start+start, segment.Start+at)))
+		}
+
+		link := ast.NewLink()
+		link.Destination = []byte(destination)
+		link.SetAttributeString("class", []byte("mention"))
+		link.AppendChild(link, ast.NewTextSegment(text.NewSegment(segment.Start+at, segment.Start+end)))
+		parent.InsertBefore(parent, node, link)
+
+		start = end
+		replaced = true
+	}
+
+	if !replaced {
+		return
+	}
+
+	// Остаток текста сохраняет переносы строки исходного узла
+	rest := ast.NewTextSegment(text.NewSegment(segment.Start+start, segment.Stop))
+	rest.SetSoftLineBreak(node.SoftLineBreak())
+	rest.SetHardLineBreak(node.HardLineBreak())
+	parent.InsertBefore(parent, node, rest)
+	parent.RemoveChild(parent, node)
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type Attachment struct {
+	ID       int       // Уникальный идентификатор
+	PostID   int       // ID поста (0, если ещё не привязано)
+	UserID   int       // ID загрузившего пользователя
+	Hash     string    // sha256 содержимого, он же имя файла
+	MimeType string    // Тип, определённый по содержимому
+	Size     int64     // Размер в байтах
+	Width    int       // Ширина в пикселях
+	Height   int       // Высота в пикселях
+	Filename string    // Исходное имя файла
+	Created  time.Time // Дата загрузки
+	// Варианты размеров, от меньшего к большему
+	Variants []*AttachmentVariant
+}
+
+type AttachmentVariant struct {
+	Name     string // original, medium или thumbnail
+	Hash     string // sha256 содержимого варианта
+	MimeType string
+	Width    int
+	Height   int
+	Size     int64
+}
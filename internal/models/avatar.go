@@ -0,0 +1,8 @@
+package models
+
+// Avatar - картинка аватара одного размера, готовая к отдаче
+type Avatar struct {
+	Data     []byte // Содержимое файла
+	MimeType string // MIME-тип
+	Version  int    // Текущая версия аватара пользователя
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Badge - значок пользователя
+type Badge struct {
+	Code        string    // Код значка
+	Name        string    // Название
+	Description string    // За что выдаётся
+	Manual      bool      // Выдаётся и отзывается администраторами
+	Awarded     time.Time // Когда выдан (для выданных значков)
+}
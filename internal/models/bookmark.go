@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type Bookmark struct {
+	ID       int       // Уникальный идентификатор
+	UserID   int       // ID владельца
+	PostID   int       // ID сохранённого поста
+	FolderID *int      // ID папки (nil, если закладка вне папок)
+	Note     string    // Личная заметка владельца
+	Created  time.Time // Дата сохранения
+	// Сохранённый пост (для списка закладок)
+	Post *Post
+}
+
+// InFolder проверяет, лежит ли закладка в папке folderID
+func (b *Bookmark) InFolder(folderID int) bool {
+	return b.FolderID != nil && *b.FolderID == folderID
+}
+
+type BookmarkFolder struct {
+	ID      int       // Уникальный идентификатор
+	UserID  int       // ID владельца
+	Name    string    // Название папки
+	Created time.Time // Дата создания
+	// Количество закладок в папке
+	Count int
+}
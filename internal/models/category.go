@@ -2,10 +2,31 @@ package models
 
 import "time"
 
+// Действия, права на которые задаются для категории
+const (
+	CategoryView    = "view"    // видеть категорию и её посты
+	CategoryPost    = "post"    // публиковать посты в категории
+	CategoryComment = "comment" // комментировать посты категории
+)
+
+// CategoryActions - все действия в порядке отображения в настройках прав
+var CategoryActions = []string{CategoryView, CategoryPost, CategoryComment}
+
+// CategoryPermission - собственное правило категории для действия
+type CategoryPermission struct {
+	Action  string
+	Inherit bool            // своих правил нет, действуют правила предков
+	Roles   map[string]bool // роли, которым действие разрешено
+	Groups  map[int]bool    // группы, которым действие разрешено
+}
+
 type Category struct {
 	ID          int
 	Name        string
 	Slug        string
 	Description string
 	Created     time.Time
+	ParentID    *int        // Родительская категория (nil - корневая)
+	Children    []*Category // Подкатегории (заполняется при построении дерева)
+	Ancestors   []*Category // Предки от корня (заполняется для хлебных крошек)
 }
@@ -3,12 +3,24 @@ package models
 import "time"
 
 type Comment struct {
-	ID      int       // Уникальный идентификатор
-	Content string    // Содержимое комментария
-	PostID  int       // ID поста к которому привязан комментарий
-	UserID  int       // ID автора комментария
-	Created time.Time // Дата создания
-	Updated time.Time // Дата изменения
+	ID          int       // Уникальный идентификатор
+	Content     string    // Содержимое комментария
+	ContentHTML string    // Содержимое, отрендеренное из Markdown
+	PostID      int       // ID поста к которому привязан комментарий
+	ParentID    *int      // ID комментария, на который это ответ (nil - ответ на пост)
+	UserID      int       // ID автора комментария
+	Review      string    // ReviewNew, пока комментарий ждёт проверки модератором
+	Created     time.Time // Дата создания
+	Updated     time.Time // Дата изменения
 	// Данные автора (для JOIN запросов)
 	Username string // Имя автора
 }
+
+// VisibleTo проверяет, может ли пользователь (nil - гость) видеть комментарий.
+// Комментарий на проверке видят только автор и модераторы
+func (c *Comment) VisibleTo(user *User) bool {
+	if c.Review == "" {
+		return true
+	}
+	return user != nil && (user.ID == c.UserID || user.IsModerator())
+}
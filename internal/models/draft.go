@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Draft struct {
+	ID          int       // Уникальный идентификатор
+	UserID      int       // ID автора
+	PostID      *int      // ID редактируемого поста (nil для нового поста)
+	Title       string    // Заголовок
+	Content     string    // Содержимое
+	Tags        string    // Теги в том виде, как введены в форму
+	CategoryIDs []int     // Выбранные категории
+	Created     time.Time // Дата создания
+	Updated     time.Time // Дата последнего сохранения
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Действия в журнале групп
+const (
+	GroupAuditCreate = "create" // группа создана
+	GroupAuditDelete = "delete" // группа удалена
+	GroupAuditAdd    = "add"    // участника добавили
+	GroupAuditRemove = "remove" // участника исключили
+	GroupAuditJoin   = "join"   // пользователь вступил по приглашению
+	GroupAuditLeave  = "leave"  // участник вышел сам
+	GroupAuditInvite = "invite" // код приглашения сменён
+	GroupAuditOwner  = "owner"  // сменился владелец
+)
+
+// Group - группа пользователей
+type Group struct {
+	ID          int
+	Name        string
+	Slug        string // для ссылки на группу и упоминания @slug
+	Description string
+	OwnerID     int // 0 - владельца нет
+	OwnerName   string
+	InviteCode  string // код для вступления без администратора
+	MemberCount int
+	Created     time.Time
+}
+
+// ManagedBy сообщает, может ли пользователь управлять участниками группы
+func (g *Group) ManagedBy(u *User) bool {
+	return u != nil && (u.IsAdmin() || u.ID == g.OwnerID)
+}
+
+// GroupAuditEntry - запись журнала изменений группы
+type GroupAuditEntry struct {
+	ID        int
+	GroupID   int
+	GroupName string
+	ActorName string // "" - пользователь удалён
+	Action    string
+	UserName  string // участник, которого коснулось действие
+	Created   time.Time
+}
@@ -8,6 +8,7 @@ type Like struct {
 	PostID    *int      // ID поста (если лайк на пост)
 	CommentID *int      // ID комментария (если лайк на комментарий)
 	IsDislike bool      // true для дизлайка, false для лайка
+	Points    int       // Очки репутации, начисленные автору
 	Created   time.Time // Дата создания
 }
 
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type Conversation struct {
+	ID          int       // Уникальный идентификатор
+	Subject     string    // Тема (может быть пустой)
+	CreatedBy   int       // ID начавшего переписку
+	Created     time.Time // Дата создания
+	Updated     time.Time // Время последнего сообщения
+	Members     []*User   // Участники, включая текущего пользователя
+	LastMessage *Message  // Последнее видимое пользователю сообщение
+	Unread      int       // Количество непрочитанных сообщений
+	Archived    bool      // Переписка в архиве у текущего пользователя
+}
+
+// Others возвращает участников переписки, кроме пользователя userID
+func (c *Conversation) Others(userID int) []*User {
+	var others []*User
+	for _, member := range c.Members {
+		if member.ID != userID {
+			others = append(others, member)
+		}
+	}
+	return others
+}
+
+type Message struct {
+	ID             int       // Уникальный идентификатор
+	ConversationID int       // ID переписки
+	SenderID       int       // ID отправителя
+	SenderName     string    // Имя отправителя
+	Content        string    // Текст сообщения
+	Created        time.Time // Дата отправки
+	ReadBy         []string  // Участники, прочитавшие сообщение (кроме отправителя)
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Виды содержимого, которое проверяет фильтр
+const (
+	CheckedPost    = "post"    // новый пост
+	CheckedEdit    = "edit"    // правка поста
+	CheckedComment = "comment" // новый комментарий
+)
+
+// Решения фильтра содержимого
+const (
+	DecisionPublish = "publish" // опубликовать сразу
+	DecisionHold    = "hold"    // отправить на проверку модератору
+	DecisionReject  = "reject"  // отклонить без сохранения
+)
+
+// Состояния проверки модератором (колонка review постов и комментариев)
+const (
+	ReviewNew  = "new"  // новый пост или комментарий ждёт проверки
+	ReviewEdit = "edit" // правка опубликованного поста ждёт проверки, пост показывается в прежнем виде
+)
+
+// PendingEdit - правка опубликованного поста, ждущая проверки модератором
+type PendingEdit struct {
+	PostID      int
+	EditorID    int
+	Title       string
+	Content     string
+	CategoryIDs []int
+	Tags        []string // теги поста после одобрения
+	// Новые загрузки, которые привяжутся к посту, и вложения, которые правка удаляет
+	AttachmentIDs        []int
+	RemovedAttachmentIDs []int
+	Attachments          []*Attachment // новые загрузки для показа
+	Created              time.Time
+}
+
+// Removes проверяет, удаляет ли правка вложение поста
+func (e *PendingEdit) Removes(attachmentID int) bool {
+	for _, id := range e.RemovedAttachmentIDs {
+		if id == attachmentID {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentCheckEntry - запись журнала решений фильтра содержимого
+type ContentCheckEntry struct {
+	ID        int
+	Kind      string
+	PostID    int // 0 - содержимое не сохранено или удалено
+	CommentID int
+	Username  string // автор проверенного текста
+	Decision  string
+	Score     int
+	Reasons   string
+	Created   time.Time
+}
+
+// ReviewItem - пост или комментарий в очереди проверки
+type ReviewItem struct {
+	PostID    int
+	CommentID int    // 0 - пост
+	Review    string // ReviewNew или ReviewEdit
+	Title     string // заголовок поста (у комментария - обсуждаемого поста)
+	Content   string
+	Username  string    // автор
+	Reasons   string    // причины, по которым фильтр отправил текст на проверку
+	Updated   time.Time // когда текст попал на проверку
+}
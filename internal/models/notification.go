@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Типы уведомлений
+const (
+	NotificationComment  = "comment"  // новый комментарий к посту пользователя
+	NotificationReply    = "reply"    // ответ на комментарий пользователя
+	NotificationReaction = "reaction" // лайк поста или комментария пользователя
+	NotificationMention  = "mention"  // пользователя упомянули через @username
+	// новый комментарий в посте, на который подписан пользователь
+	NotificationWatchedPost = "watched_post"
+	// новый пост в категории, на которую подписан пользователь
+	NotificationWatchedCategory = "watched_category"
+	NotificationBadge           = "badge" // пользователь получил значок
+	// модератор перенёс пост или комментарий пользователя в другое место
+	NotificationMoved = "moved"
+)
+
+// NotificationTypes - все типы уведомлений в порядке отображения в настройках
+var NotificationTypes = []string{
+	NotificationComment,
+	NotificationReply,
+	NotificationReaction,
+	NotificationMention,
+	NotificationWatchedPost,
+	NotificationWatchedCategory,
+	NotificationBadge,
+	NotificationMoved,
+}
+
+type Notification struct {
+	ID      int    // Уникальный идентификатор
+	UserID  int    // ID получателя
+	ActorID int    // ID пользователя, вызвавшего уведомление
+	Type    string // Тип уведомления
+	PostID  *int   // ID поста (если есть)
+	// ID комментария, к которому относится событие: родительского для reply,
+	// оценённого для reaction, содержащего упоминание для mention
+	CommentID *int
+	Badge     string     // Код полученного значка для badge
+	Created   time.Time  // Дата создания
+	ReadAt    *time.Time // Дата прочтения (nil - не прочитано)
+	// Данные для отображения (для JOIN запросов)
+	ActorName string // Имя пользователя, вызвавшего уведомление
+	PostTitle string // Заголовок поста
+}
+
+// NotificationGroup объединяет однотипные уведомления об одном объекте,
+// например "5 человек оценили ваш пост"
+type NotificationGroup struct {
+	Type      string
+	PostID    *int
+	CommentID *int
+	PostTitle string
+	Badge     string    // Код значка для badge
+	Actors    []string  // Имена участников без повторов, от последнего
+	Unread    bool      // Есть непрочитанные уведомления в группе
+	Latest    time.Time // Время последнего события
+	IDs       []int     // ID уведомлений группы
+}
+
+// OtherActors возвращает количество участников сверх первых shown
+func (g *NotificationGroup) OtherActors(shown int) int {
+	if len(g.Actors) <= shown {
+		return 0
+	}
+	return len(g.Actors) - shown
+}
+
+// NotificationSetting - включён ли тип уведомлений у пользователя
+type NotificationSetting struct {
+	Type    string
+	Enabled bool
+}
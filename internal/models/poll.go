@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+type Poll struct {
+	ID               int        // Уникальный идентификатор
+	PostID           int        // ID поста, к которому прикреплён опрос
+	Question         string     // Вопрос
+	Multiple         bool       // true, если можно выбрать несколько вариантов
+	ResultsAfterVote bool       // true, если результаты видны только проголосовавшим
+	ClosesAt         *time.Time // Время закрытия (nil - бессрочный)
+	Created          time.Time  // Дата создания
+	Options          []*PollOption
+	Voters           int   // Количество проголосовавших
+	UserChoice       []int // ID вариантов, выбранных текущим пользователем
+}
+
+type PollOption struct {
+	ID       int    // Уникальный идентификатор
+	Text     string // Текст варианта
+	Position int    // Порядок отображения
+	Votes    int    // Количество голосов
+	Percent  int    // Доля проголосовавших за вариант, %
+	Chosen   bool   // Выбран текущим пользователем
+}
+
+// IsClosed сообщает, закрыт ли опрос
+func (p *Poll) IsClosed() bool {
+	return p.ClosesAt != nil && !time.Now().Before(*p.ClosesAt)
+}
+
+// HasVoted сообщает, голосовал ли текущий пользователь
+func (p *Poll) HasVoted() bool {
+	return len(p.UserChoice) > 0
+}
+
+// ShowResults сообщает, можно ли показывать результаты текущему пользователю
+func (p *Poll) ShowResults() bool {
+	return !p.ResultsAfterVote || p.HasVoted() || p.IsClosed()
+}
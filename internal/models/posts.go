@@ -3,13 +3,34 @@ package models
 import "time"
 
 type Post struct {
-	ID      int       // Уникальный идентификатор
-	Title   string    // Заголовок поста
-	Content string    // Содержимое поста
-	UserID  int       // ID автора
-	Created time.Time // Дата создания
-	Updated time.Time // Дата изменения
+	ID          int        // Уникальный идентификатор
+	Title       string     // Заголовок поста
+	Content     string     // Содержимое поста
+	ContentHTML string     // Содержимое, отрендеренное из Markdown
+	UserID      int        // ID автора
+	Version     int        // Номер версии для обнаружения конфликтов правок
+	Published   bool       // false, пока пост ждёт публикации
+	PublishAt   *time.Time // Время отложенной публикации (nil, если не назначено)
+	Review      string     // ReviewNew или ReviewEdit, пока пост или его правка ждут проверки модератором
+	Created     time.Time  // Дата создания
+	Updated     time.Time  // Дата изменения
 	// Данные автора (для JOIN запросов)
-	Username   string // Имя автора
-	Categories []*Category
+	Username    string // Имя автора
+	Categories  []*Category
+	Attachments []*Attachment // Прикреплённые изображения
+	Tags        []*Tag        // Пользовательские теги
+	Poll        *Poll         // Опрос (nil, если не прикреплён)
+	Bookmarks   int           // Сколько раз пост сохранён в закладки
+
+	AuthorAvatarVersion int // Версия аватара автора для адреса картинки
+	AuthorReputation    int // Репутация автора
+}
+
+// VisibleTo проверяет, может ли пользователь (nil - гость) видеть пост.
+// Неопубликованный пост видят только автор и модераторы
+func (p *Post) VisibleTo(user *User) bool {
+	if p.Published {
+		return true
+	}
+	return user != nil && (user.ID == p.UserID || user.IsModerator())
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Revision - сохранённая версия поста или комментария
+type Revision struct {
+	ID       int       // Уникальный идентификатор
+	TargetID int       // ID поста или комментария
+	EditorID int       // ID пользователя, сделавшего правку
+	Title    string    // Заголовок (пусто для комментариев)
+	Content  string    // Содержимое
+	Created  time.Time // Время правки
+	// Данные редактора (для JOIN запросов)
+	EditorName string
+	Categories []*Category // Категории поста на момент правки
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Tag struct {
+	ID      int       // Уникальный идентификатор
+	Name    string    // Нормализованное имя тега
+	Created time.Time // Дата создания
+	// Количество постов с тегом (для облака тегов)
+	Count int
+}
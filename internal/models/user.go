@@ -2,10 +2,37 @@ package models
 
 import "time"
 
+// Роли пользователей
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	// RoleGuest - посетитель без входа; используется только в правах категорий
+	RoleGuest = "guest"
+)
+
+// Roles - роли, которым можно выдать права на категорию
+var Roles = []string{RoleGuest, RoleUser, RoleModerator, RoleAdmin}
+
 type User struct {
 	ID       int       // Уникальный идентификатор
 	Username string    // Имя пользователя
 	Email    string    // Email (уникален)
 	Password []byte    // Хешированный пароль
+	Role     string    // Роль: user, moderator или admin
 	Created  time.Time // Дата регистрации
+
+	LikesPublic   bool // Лайкнутые посты видны на публичной странице
+	AvatarVersion int  // Версия аватара для адреса картинки
+	Reputation    int  // Репутация по реакциям на посты и комментарии
+}
+
+// IsAdmin сообщает, является ли пользователь администратором
+func (u *User) IsAdmin() bool {
+	return u != nil && u.Role == RoleAdmin
+}
+
+// IsModerator сообщает, может ли пользователь модерировать чужой контент
+func (u *User) IsModerator() bool {
+	return u != nil && (u.Role == RoleModerator || u.Role == RoleAdmin)
 }
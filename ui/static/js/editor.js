@@ -0,0 +1,182 @@
+// Предпросмотр Markdown в формах создания и редактирования поста
+(function () {
+    const source = document.querySelector("[data-preview-source]");
+    const button = document.querySelector("[data-preview-button]");
+    const target = document.querySelector("[data-preview-target]");
+    if (!source || !button || !target) {
+        return;
+    }
+
+    button.addEventListener("click", async function () {
+        const response = await fetch("/post/preview", {
+            method: "POST",
+            body: new URLSearchParams({ content: source.value }),
+        });
+        if (!response.ok) {
+            return;
+        }
+        // Сервер возвращает уже очищенный санитайзером HTML
+        target.innerHTML = await response.text();
+        target.hidden = false;
+    });
+})();
+
+// Автодополнение тегов: подсказываем только последний тег в списке через запятую
+(function () {
+    const input = document.querySelector("[data-tag-input]");
+    const list = document.getElementById("tag-suggestions");
+    if (!input || !list) {
+        return;
+    }
+
+    let lastQuery = "";
+    input.addEventListener("input", async function () {
+        const parts = input.value.split(",");
+        const query = parts.pop().trim();
+        if (query === "" || query === lastQuery) {
+            return;
+        }
+        lastQuery = query;
+
+        const response = await fetch("/tags/suggest?q=" + encodeURIComponent(query));
+        if (!response.ok) {
+            return;
+        }
+        const names = await response.json();
+
+        // Вариант datalist должен совпадать со всем значением поля
+        const prefix = parts.map((part) => part.trim()).filter(Boolean).join(", ");
+        list.replaceChildren(...names.map(function (name) {
+            const option = document.createElement("option");
+            option.value = prefix ? prefix + ", " + name : name;
+            return option;
+        }));
+    });
+})();
+
+// Автодополнение @упоминаний в тексте поста
+(function () {
+    const source = document.querySelector("[data-preview-source]");
+    if (!source) {
+        return;
+    }
+
+    const list = document.createElement("ul");
+    list.className = "mention-suggestions";
+    list.hidden = true;
+    source.insertAdjacentElement("afterend", list);
+
+    // Ищем @префикс непосредственно перед курсором
+    function currentMention() {
+        const before = source.value.slice(0, source.selectionStart);
+        const match = before.match(/(?:^|[^A-Za-z0-9_@\/-])@([A-Za-z0-9_-]{1,50})$/);
+        if (!match) {
+            return null;
+        }
+        return { prefix: match[1], start: source.selectionStart - match[1].length };
+    }
+
+    function insert(name, mention) {
+        const after = source.value.slice(source.selectionStart);
+        source.value = source.value.slice(0, mention.start) + name + " " + after;
+        const caret = mention.start + name.length + 1;
+        source.setSelectionRange(caret, caret);
+        list.hidden = true;
+        source.focus();
+    }
+
+    source.addEventListener("input", async function () {
+        const mention = currentMention();
+        if (!mention) {
+            list.hidden = true;
+            return;
+        }
+
+        const response = await fetch("/users/suggest?q=" + encodeURIComponent(mention.prefix));
+        if (!response.ok) {
+            return;
+        }
+        const names = await response.json();
+
+        list.replaceChildren(...names.map(function (name) {
+            const item = document.createElement("li");
+            item.textContent = name;
+            item.addEventListener("mousedown", function (event) {
+                event.preventDefault();
+                insert(name, mention);
+            });
+            return item;
+        }));
+        list.hidden = names.length === 0;
+    });
+
+    source.addEventListener("blur", function () {
+        list.hidden = true;
+    });
+})();
+
+// Автосохранение черновика на сервере, чтобы текст не пропал, если сессия
+// истечёт во время написания
+(function () {
+    const form = document.querySelector("form[data-autosave]");
+    if (!form) {
+        return;
+    }
+
+    const status = form.querySelector("[data-autosave-status]");
+    const draftID = form.querySelector("input[name=draft_id]");
+    let dirty = false;
+
+    form.addEventListener("input", function () {
+        dirty = true;
+    });
+    form.addEventListener("change", function () {
+        dirty = true;
+    });
+
+    async function save() {
+        if (!dirty) {
+            return;
+        }
+        dirty = false;
+
+        // Файлы и номер версии в черновик не попадают
+        const params = new URLSearchParams();
+        for (const [name, value] of new FormData(form)) {
+            if (typeof value === "string" && name !== "version") {
+                params.append(name, value);
+            }
+        }
+
+        let response;
+        try {
+            response = await fetch("/drafts/autosave", { method: "POST", body: params });
+        } catch (e) {
+            dirty = true;
+            status.textContent = "Нет связи с сервером, черновик не сохранён";
+            return;
+        }
+
+        if (response.status === 401) {
+            // Повторим после входа в соседней вкладке: cookie у вкладок общие
+            dirty = true;
+            status.textContent = "Сессия истекла. Войдите в соседней вкладке, и черновик сохранится";
+            return;
+        }
+        if (!response.ok) {
+            status.textContent = "Не удалось сохранить черновик";
+            return;
+        }
+
+        const draft = await response.json();
+        if (draftID) {
+            draftID.value = draft.id;
+        }
+        status.textContent = "Черновик сохранён в " + new Date(draft.updated).toLocaleTimeString();
+    }
+
+    const timer = setInterval(save, 10000);
+    form.addEventListener("submit", function () {
+        clearInterval(timer);
+    });
+})();
@@ -0,0 +1,7 @@
+// Подтверждение действий для кнопок с атрибутом data-confirm
+document.addEventListener("click", function (event) {
+    const button = event.target.closest("[data-confirm]");
+    if (button && !confirm(button.dataset.confirm)) {
+        event.preventDefault();
+    }
+});
@@ -7,19 +7,36 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 type app struct {
-	infoLog         *log.Logger
-	errorLog        *log.Logger
-	HTMLDir         *string
-	StaticDir       *string
-	Database        *database.Database
-	UserService     *database.UserService
-	SessionService  *database.SessionService
-	PostService     *database.PostService
-	CategoryService *database.CategoryService
+	infoLog             *log.Logger
+	errorLog            *log.Logger
+	HTMLDir             *string
+	StaticDir           *string
+	Database            *database.Database
+	UserService         *database.UserService
+	SessionService      *database.SessionService
+	PostService         *database.PostService
+	CategoryService     *database.CategoryService
+	CommentService      *database.CommentService
+	RevisionService     *database.RevisionService
+	AttachmentService   *database.AttachmentService
+	TagService          *database.TagService
+	PollService         *database.PollService
+	NotificationService *database.NotificationService
+	SubscriptionService *database.SubscriptionService
+	BookmarkService     *database.BookmarkService
+	DraftService        *database.DraftService
+	MessageService      *database.MessageService
+	FollowService       *database.FollowService
+	LikeService         *database.LikeService
+	AvatarService       *database.AvatarService
+	BadgeService        *database.BadgeService
+	GroupService        *database.GroupService
+	ReviewService       *database.ReviewService
 }
 
 func RunApp() {
@@ -30,6 +47,25 @@ func RunApp() {
 	htmlDir := flag.String("html-dir", "./ui/html", "Path to HTML templates")
 	staticDir := flag.String("static-dir", "./ui/static", "Path to static assets")
 	dsn := flag.String("dsn", "./forum.db", "Path to SQLite3 database file")
+	schemaPath := flag.String("schema", "./forum.sql", "Path to the SQL schema applied to the database at startup")
+	uploadDir := flag.String("upload-dir", "./uploads", "Path to uploaded files")
+	maxUploadMB := flag.Int64("max-upload-mb", 5, "Maximum size of an uploaded image in megabytes")
+	tagSynonyms := flag.String("tag-synonyms", "./tag-synonyms.txt", "Path to tag synonyms file")
+	smtpAddr := flag.String("smtp-addr", "", "SMTP server host:port for email notifications (empty disables email)")
+	smtpFrom := flag.String("smtp-from", "forum@localhost", "Sender address of email notifications")
+	baseURL := flag.String("base-url", "http://localhost:4000", "Public URL of the forum used in email links")
+	repPostLike := flag.Int("rep-post-like", database.DefaultReputationWeights.PostLike, "Reputation points for a like on a post")
+	repPostDislike := flag.Int("rep-post-dislike", database.DefaultReputationWeights.PostDislike, "Reputation points for a dislike on a post")
+	repCommentLike := flag.Int("rep-comment-like", database.DefaultReputationWeights.CommentLike, "Reputation points for a like on a comment")
+	repCommentDislike := flag.Int("rep-comment-dislike", database.DefaultReputationWeights.CommentDislike, "Reputation points for a dislike on a comment")
+	repDailyCap := flag.Int("rep-daily-cap", database.DefaultReputationWeights.DailyCap, "Maximum reputation points one user can give another per day (0 disables the cap)")
+	blocklistPath := flag.String("blocklist", "./blocklist.txt", "Path to word blocklist file for new content")
+	spamMaxLinks := flag.Int("spam-max-links", database.DefaultSpamSettings.MaxLinks, "Links allowed in a post or comment before it scores as spam (0 disables the limit)")
+	spamLinkScore := flag.Int("spam-link-score", database.DefaultSpamSettings.LinkScore, "Spam score for exceeding the link limit")
+	spamRepeatWindow := flag.Duration("spam-repeat-window", database.DefaultSpamSettings.RepeatWindow, "How far back to look for the author's identical content (0 disables the check)")
+	spamRepeatScore := flag.Int("spam-repeat-score", database.DefaultSpamSettings.RepeatScore, "Spam score for each repeat of identical content")
+	spamHoldScore := flag.Int("spam-hold-score", database.DefaultSpamSettings.HoldScore, "Spam score at which content waits for moderator review (0 holds only on blocklist matches)")
+	backfillVariants := flag.Bool("backfill-variants", false, "Generate resized variants for existing attachments and exit")
 
 	flag.Parse()
 
@@ -47,27 +83,111 @@ func RunApp() {
 	infoLog.Println("SQLite DB connected:", *dsn)
 
 	db := &database.Database{DBConn: dbConn}
+	columnsAdded, err := db.Migrate(*schemaPath)
+	if err != nil {
+		errorLog.Fatal("Failed to apply schema:", err)
+	}
+	infoLog.Printf("Schema applied: %s, columns added: %d", *schemaPath, columnsAdded)
+
+	db.Channels = []database.NotificationChannel{database.NewInAppChannel(db)}
+	if *smtpAddr != "" {
+		// Учётные данные SMTP берутся из окружения, чтобы не светиться в списке процессов
+		db.Channels = append(db.Channels, database.NewEmailChannel(db, *smtpAddr, *smtpFrom,
+			os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), *baseURL))
+		infoLog.Println("Email notifications enabled via", *smtpAddr)
+	}
+
+	blocklist, err := database.LoadBlocklist(*blocklistPath)
+	if err != nil {
+		errorLog.Fatal("Failed to load blocklist:", err)
+	}
+	db.Pipeline = database.NewContentPipeline(blocklist, database.SpamSettings{
+		MaxLinks:     *spamMaxLinks,
+		LinkScore:    *spamLinkScore,
+		RepeatWindow: *spamRepeatWindow,
+		RepeatScore:  *spamRepeatScore,
+		HoldScore:    *spamHoldScore,
+	})
+
 	userService := database.NewUserService(db)
 	sessionService := database.NewSessionService(db)
 	postService := database.NewPostService(db)
 	categoryService := database.NewCategoryService(db)
+	commentService := database.NewCommentService(db)
+	revisionService := database.NewRevisionService(db)
+	attachmentService := database.NewAttachmentService(db, *uploadDir, *maxUploadMB<<20)
+
+	synonyms, err := database.LoadTagSynonyms(*tagSynonyms)
+	if err != nil {
+		errorLog.Fatal("Failed to load tag synonyms:", err)
+	}
+	tagService := database.NewTagService(db, synonyms)
+	pollService := database.NewPollService(db)
+	notificationService := database.NewNotificationService(db)
+	subscriptionService := database.NewSubscriptionService(db)
+	bookmarkService := database.NewBookmarkService(db)
+	draftService := database.NewDraftService(db)
+	messageService := database.NewMessageService(db)
+	followService := database.NewFollowService(db)
+	likeService := database.NewLikeService(db, database.ReputationWeights{
+		PostLike:       *repPostLike,
+		PostDislike:    *repPostDislike,
+		CommentLike:    *repCommentLike,
+		CommentDislike: *repCommentDislike,
+		DailyCap:       *repDailyCap,
+	})
+	avatarService := database.NewAvatarService(db, filepath.Join(*uploadDir, "avatars"), *maxUploadMB<<20)
+	badgeService := database.NewBadgeService(db)
+	groupService := database.NewGroupService(db)
+	reviewService := database.NewReviewService(db)
 
 	app := &app{
-		errorLog:        errorLog,
-		infoLog:         infoLog,
-		HTMLDir:         htmlDir,
-		StaticDir:       staticDir,
-		Database:        &database.Database{DBConn: dbConn},
-		UserService:     userService,
-		SessionService:  sessionService,
-		PostService:     postService,
-		CategoryService: categoryService,
+		errorLog:            errorLog,
+		infoLog:             infoLog,
+		HTMLDir:             htmlDir,
+		StaticDir:           staticDir,
+		Database:            db,
+		UserService:         userService,
+		SessionService:      sessionService,
+		PostService:         postService,
+		CategoryService:     categoryService,
+		CommentService:      commentService,
+		RevisionService:     revisionService,
+		AttachmentService:   attachmentService,
+		TagService:          tagService,
+		PollService:         pollService,
+		NotificationService: notificationService,
+		SubscriptionService: subscriptionService,
+		BookmarkService:     bookmarkService,
+		DraftService:        draftService,
+		MessageService:      messageService,
+		FollowService:       followService,
+		LikeService:         likeService,
+		AvatarService:       avatarService,
+		BadgeService:        badgeService,
+		GroupService:        groupService,
+		ReviewService:       reviewService,
+	}
+
+	// Разовая команда: обработать старые вложения и выйти
+	if *backfillVariants {
+		processed, err := app.AttachmentService.BackfillVariants()
+		if err != nil {
+			errorLog.Fatal("Failed to backfill attachment variants:", err)
+		}
+		infoLog.Printf("Attachment variants backfilled: %d", processed)
+		return
 	}
 
 	if err := app.SessionService.CleanupExpiredSessions(); err != nil {
 		app.infoLog.Printf("Warning: failed to cleanup expired sessions: %v", err)
 	}
 
+	go app.collectOrphanAttachments()
+	go app.publishScheduledPosts()
+	go app.recomputeReputation()
+	go app.awardBadges()
+
 	srv := &http.Server{
 		Addr:     *addr,
 		ErrorLog: app.errorLog,
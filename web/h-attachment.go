@@ -0,0 +1,203 @@
+package web
+
+import (
+	"errors"
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Как долго непривязанная загрузка ждёт публикации поста
+	orphanAttachmentAge = 24 * time.Hour
+	// Как часто запускается сборщик осиротевших загрузок
+	orphanCollectInterval = time.Hour
+	// Сколько даётся на приём запроса с изображениями и ответ на него:
+	// ReadTimeout и WriteTimeout сервера рассчитаны на обычные формы
+	uploadTimeout = 2 * time.Minute
+)
+
+// serveAttachment отдаёт файл вложения по хешу содержимого
+func (app *app) serveAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.MethodNotAllowed(w, []string{"GET", "HEAD"})
+		return
+	}
+
+	hash := strings.TrimPrefix(r.URL.Path, "/uploads/")
+	if !database.IsAttachmentHash(hash) {
+		app.NotFound(w)
+		return
+	}
+
+	mimeType, created, err := app.AttachmentService.GetFileInfo(hash)
+	if err != nil {
+		if err == database.ErrAttachmentNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	// Файл виден тем же, кому виден пост с ним. Файлы, которые видит
+	// и гость, можно кешировать в общих кешах
+	postIDs, uploaderIDs, err := app.AttachmentService.GetFileOwners(hash)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	public, err := app.attachmentVisible(postIDs, uploaderIDs, nil)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	cacheControl := "public, max-age=31536000, immutable"
+	if !public {
+		visible, err := app.attachmentVisible(postIDs, uploaderIDs, app.getCurrentUser(r))
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		if !visible {
+			app.NotFound(w)
+			return
+		}
+		cacheControl = "private, max-age=31536000, immutable"
+	}
+
+	file, err := app.AttachmentService.Open(hash)
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+	defer file.Close()
+
+	// Содержимое по этому адресу никогда не меняется
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", `"`+hash+`"`)
+
+	http.ServeContent(w, r, "", created, file)
+}
+
+// attachmentVisible проверяет, виден ли файл пользователю (nil - гость):
+// хотя бы один пост с ним должен быть виден так же, как на странице поста.
+// Ещё не привязанную к посту загрузку видят её автор и модераторы: она может
+// ждать проверки вместе с правкой поста
+func (app *app) attachmentVisible(postIDs, uploaderIDs []int, viewer *models.User) (bool, error) {
+	if viewer != nil && viewer.IsModerator() && len(uploaderIDs) > 0 {
+		return true, nil
+	}
+	if viewer != nil {
+		for _, uploaderID := range uploaderIDs {
+			if uploaderID == viewer.ID {
+				return true, nil
+			}
+		}
+	}
+
+	for _, postID := range postIDs {
+		_, err := app.PostService.GetPost(postID, viewer)
+		if err == nil {
+			return true, nil
+		}
+		if err != database.ErrPostNotFound {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// extendUploadDeadline продлевает сроки чтения и записи соединения для
+// запроса с файлами. Если соединение этого не умеет, остаются общие сроки
+func extendUploadDeadline(w http.ResponseWriter) {
+	deadline := time.Now().Add(uploadTimeout)
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+}
+
+// parsePostForm разбирает форму поста, в том числе multipart с изображениями.
+// Превышение размера тела даёт ErrAttachmentTooLarge; остальные ошибки
+// означают повреждённую форму и возвращаются как есть
+func (app *app) parsePostForm(w http.ResponseWriter, r *http.Request) error {
+	maxBody := app.AttachmentService.MaxSize()*database.MaxPostAttachments + 1<<20
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		extendUploadDeadline(w)
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return database.ErrAttachmentTooLarge
+	}
+	return err
+}
+
+// saveUploads сохраняет изображения из поля images и возвращает ID вложений
+func (app *app) saveUploads(r *http.Request, userID int) ([]int, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+
+	files := r.MultipartForm.File["images"]
+	if len(files) > database.MaxPostAttachments {
+		return nil, database.ErrTooManyAttachments
+	}
+
+	var attachmentIDs []int
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		attachment, err := app.AttachmentService.SaveUpload(userID, header.Filename, file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		app.infoLog.Printf("Attachment uploaded: ID=%d, Type=%s, Size=%d", attachment.ID, attachment.MimeType, attachment.Size)
+		attachmentIDs = append(attachmentIDs, attachment.ID)
+	}
+
+	return attachmentIDs, nil
+}
+
+// loadAttachments получает вложения для списка постов
+func (app *app) loadAttachments(posts []*models.Post) {
+	for _, post := range posts {
+		attachments, err := app.AttachmentService.GetPostAttachments(post.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to get attachments for post %d: %v", post.ID, err)
+			continue
+		}
+		post.Attachments = attachments
+	}
+}
+
+// collectOrphanAttachments периодически удаляет загрузки, так и не привязанные к постам
+func (app *app) collectOrphanAttachments() {
+	ticker := time.NewTicker(orphanCollectInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := app.AttachmentService.DeleteOrphans(orphanAttachmentAge)
+		if err != nil {
+			app.errorLog.Printf("Failed to collect orphan attachments: %v", err)
+		} else if deleted > 0 {
+			app.infoLog.Printf("Orphan attachments removed: %d", deleted)
+		}
+		<-ticker.C
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"forum/internal/models"
 	"net/http"
 )
 
@@ -122,12 +123,33 @@ func (app *app) profile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.renderProfile(w, r, "")
+}
+
+// renderProfile отрисовывает личный профиль; formError - ошибка формы аватара
+func (app *app) renderProfile(w http.ResponseWriter, r *http.Request, formError string) {
 	user := app.getCurrentUser(r)
 
+	// Подписки показываются в профиле, чтобы от них можно было отписаться
+	posts, err := app.SubscriptionService.GetSubscribedPosts(user.ID)
+	if err != nil {
+		app.errorLog.Printf("Failed to get subscribed posts of user %d: %v", user.ID, err)
+		posts = []*models.Post{}
+	}
+
+	categories, err := app.SubscriptionService.GetSubscribedCategories(user.ID)
+	if err != nil {
+		app.errorLog.Printf("Failed to get subscribed categories of user %d: %v", user.ID, err)
+		categories = []*models.Category{}
+	}
+
 	data := &HTMLData{
 		Title:       "Profile",
 		Path:        r.URL.Path,
+		FormError:   formError,
 		CurrentUser: user,
+		Posts:       posts,
+		Categories:  categories,
 	}
 
 	app.RenderHTML(w, r, "profile.page.html", data)
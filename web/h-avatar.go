@@ -0,0 +1,136 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"forum/internal/database"
+	"forum/internal/imaging"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// avatarPath разбирает /avatar/{userID}/{size}
+var avatarPath = regexp.MustCompile(`^/avatar/(\d+)/(\d+)$`)
+
+// avatarURL возвращает адрес аватара. Версия в адресе меняется при каждой
+// смене аватара, поэтому картинку можно кэшировать навсегда
+func avatarURL(userID, version, size int) string {
+	return fmt.Sprintf("/avatar/%d/%d?v=%d", userID, size, version)
+}
+
+// serveAvatar отдаёт аватар пользователя или его идентикон
+func (app *app) serveAvatar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.MethodNotAllowed(w, []string{"GET", "HEAD"})
+		return
+	}
+
+	matches := avatarPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	userID, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+	size, err := strconv.Atoi(matches[2])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	avatar, err := app.AvatarService.GetAvatar(userID, size)
+	if err != nil {
+		if err == database.ErrAvatarNotFound || err == database.ErrAvatarSize {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	// Навсегда кэшируется только адрес с актуальной версией: старые ссылки
+	// и ссылки без версии перепроверяются при каждом запросе
+	version := strconv.Itoa(avatar.Version)
+	if r.URL.Query().Get("v") == version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", avatar.MimeType)
+	w.Header().Set("ETag", fmt.Sprintf(`"avatar-%d-%s-%d"`, userID, version, size))
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(avatar.Data))
+}
+
+// uploadAvatar заменяет аватар текущего пользователя (/profile/avatar)
+// или удаляет его, возвращая идентикон (/profile/avatar/delete)
+func (app *app) uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	if r.URL.Path == "/profile/avatar/delete" {
+		if err := app.AvatarService.DeleteAvatar(user.ID); err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.AttachmentService.MaxSize()+1<<20)
+	extendUploadDeadline(w)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		app.renderProfile(w, r, database.ErrAttachmentTooLarge.Error())
+		return
+	}
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		app.renderProfile(w, r, database.ErrNoAvatarFile.Error())
+		return
+	}
+	defer file.Close()
+
+	if err := app.AvatarService.SaveAvatar(user.ID, file); err != nil {
+		switch err {
+		case database.ErrAttachmentTooLarge, database.ErrAttachmentType,
+			imaging.ErrUnsupportedImage, imaging.ErrImageTooLarge:
+			app.renderProfile(w, r, err.Error())
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// loadAuthors загружает версии аватаров и репутацию авторов постов
+func (app *app) loadAuthors(posts []*models.Post) {
+	authors := map[int]*models.User{}
+	for _, post := range posts {
+		author, ok := authors[post.UserID]
+		if !ok {
+			var err error
+			author, err = app.UserService.GetAuthor(post.UserID)
+			if err != nil {
+				app.errorLog.Printf("Failed to get author %d: %v", post.UserID, err)
+				continue
+			}
+			authors[post.UserID] = author
+		}
+		post.AuthorAvatarVersion = author.AvatarVersion
+		post.AuthorReputation = author.Reputation
+	}
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"forum/internal/database"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// badgeCheckInterval - как часто проверяются правила автоматических значков
+const badgeCheckInterval = time.Hour
+
+// userBadgePath разбирает /user/{username}/badges/award и /user/{username}/badges/revoke
+var userBadgePath = regexp.MustCompile(`^/user/([^/]+)/badges/(award|revoke)$`)
+
+// manageBadge выдаёт или отзывает ручной значок из поля badge. Доступно только администраторам
+func (app *app) manageBadge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+	if !user.IsAdmin() {
+		app.Forbidden(w)
+		return
+	}
+
+	matches := userBadgePath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	profileUser, err := app.UserService.GetUserByUsername(matches[1])
+	if err != nil {
+		if err == database.ErrUserNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	badge := r.FormValue("badge")
+	if matches[2] == "award" {
+		err = app.BadgeService.AwardBadge(profileUser.ID, user.ID, badge)
+	} else {
+		err = app.BadgeService.RevokeBadge(profileUser.ID, badge)
+	}
+	if err != nil {
+		if err == database.ErrUnknownBadge || err == database.ErrBadgeNotManual {
+			app.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/"+profileUser.Username, http.StatusSeeOther)
+}
+
+// awardBadges периодически выдаёт значки, заслуженные без события на форуме
+// (например, годовщина) или пропущенные при обработке событий
+func (app *app) awardBadges() {
+	ticker := time.NewTicker(badgeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		awarded, err := app.BadgeService.AwardBadges()
+		if err != nil {
+			app.errorLog.Printf("Failed to award badges: %v", err)
+		} else if awarded > 0 {
+			app.infoLog.Printf("Badges awarded: %d", awarded)
+		}
+		<-ticker.C
+	}
+}
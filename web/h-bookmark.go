@@ -0,0 +1,255 @@
+package web
+
+import (
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// bookmarkPostPath разбирает /post/{id}/bookmark и /post/{id}/bookmark/edit
+	bookmarkPostPath = regexp.MustCompile(`^/post/(\d+)/bookmark(/edit)?$`)
+	// bookmarkFolderPath разбирает /saved/folders/{id}/rename и /saved/folders/{id}/delete
+	bookmarkFolderPath = regexp.MustCompile(`^/saved/folders/(\d+)/(rename|delete)$`)
+)
+
+// bookmarksPerPage - размер страницы списка закладок
+const bookmarksPerPage = 20
+
+// saved показывает закладки пользователя: все или одной папки
+func (app *app) saved(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	app.renderSaved(w, r, "")
+}
+
+// renderSaved отрисовывает страницу закладок. Параметры запроса:
+// folder - ID папки, sort - saved или post, page - номер страницы
+func (app *app) renderSaved(w http.ResponseWriter, r *http.Request, formError string) {
+	user := app.getCurrentUser(r)
+	query := r.URL.Query()
+
+	var folder *models.BookmarkFolder
+	folderID, _ := strconv.Atoi(query.Get("folder"))
+	if folderID > 0 {
+		var err error
+		folder, err = app.BookmarkService.GetFolder(user.ID, folderID)
+		if err != nil {
+			if err == database.ErrFolderNotFound {
+				app.NotFound(w)
+				return
+			}
+			app.ServerError(w, err)
+			return
+		}
+	}
+
+	sort := query.Get("sort")
+	if sort != database.BookmarkSortPost {
+		sort = database.BookmarkSortSaved
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	// Запрашиваем на одну закладку больше, чтобы узнать, есть ли следующая страница
+	bookmarks, err := app.BookmarkService.GetBookmarks(user.ID, folderID, sort,
+		bookmarksPerPage+1, (page-1)*bookmarksPerPage)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	data := &HTMLData{
+		Title:          "Закладки",
+		Path:           r.URL.Path,
+		FormError:      formError,
+		CurrentUser:    user,
+		BookmarkFolder: folder,
+		Sort:           sort,
+		PrevPage:       page - 1,
+	}
+
+	if len(bookmarks) > bookmarksPerPage {
+		bookmarks = bookmarks[:bookmarksPerPage]
+		data.NextPage = page + 1
+	}
+	data.Bookmarks = bookmarks
+
+	data.BookmarkFolders, err = app.BookmarkService.GetFolders(user.ID)
+	if err != nil {
+		app.errorLog.Printf("Failed to get bookmark folders of user %d: %v", user.ID, err)
+	}
+
+	app.RenderHTML(w, r, "saved.page.html", data)
+}
+
+// bookmarkPost сохраняет пост в закладки или убирает его оттуда
+// (/post/{id}/bookmark), либо меняет папку и заметку закладки (/post/{id}/bookmark/edit)
+func (app *app) bookmarkPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	matches := bookmarkPostPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	postID, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	post, err := app.PostService.GetPost(postID, user)
+	if err != nil {
+		if err == database.ErrPostNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	if matches[2] == "" {
+		if _, err := app.BookmarkService.ToggleBookmark(user.ID, post.ID); err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		app.redirectBack(w, r, "/post/"+strconv.Itoa(post.ID))
+		return
+	}
+
+	var folderID *int
+	if id, err := strconv.Atoi(r.FormValue("folder_id")); err == nil && id > 0 {
+		folderID = &id
+	}
+
+	err = app.BookmarkService.UpdateBookmark(user.ID, post.ID, folderID, r.FormValue("note"))
+	if err != nil {
+		switch {
+		case err == database.ErrBookmarkNotFound || err == database.ErrFolderNotFound:
+			app.NotFound(w)
+		case err == database.ErrLongBookmarkNote:
+			// Длину заметки ограничивает и сама форма
+			app.ClientError(w, http.StatusBadRequest)
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	app.redirectBack(w, r, "/post/"+strconv.Itoa(post.ID))
+}
+
+// createBookmarkFolder создаёт папку закладок
+func (app *app) createBookmarkFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	folder, err := app.BookmarkService.CreateFolder(user.ID, r.FormValue("name"))
+	if err != nil {
+		if err == database.ErrEmptyFolderName || err == database.ErrLongFolderName || err == database.ErrFolderExists {
+			app.renderSaved(w, r, err.Error())
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/saved?folder="+strconv.Itoa(folder.ID), http.StatusSeeOther)
+}
+
+// bookmarkFolder переименовывает или удаляет папку закладок
+func (app *app) bookmarkFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	matches := bookmarkFolderPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	folderID, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	if matches[2] == "delete" {
+		err = app.BookmarkService.DeleteFolder(user.ID, folderID)
+	} else {
+		err = app.BookmarkService.RenameFolder(user.ID, folderID, r.FormValue("name"))
+	}
+	if err != nil {
+		switch err {
+		case database.ErrFolderNotFound:
+			app.NotFound(w)
+		case database.ErrEmptyFolderName, database.ErrLongFolderName, database.ErrFolderExists:
+			app.renderSaved(w, r, err.Error())
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	if matches[2] == "delete" {
+		http.Redirect(w, r, "/saved", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/saved?folder="+strconv.Itoa(folderID), http.StatusSeeOther)
+}
+
+// loadBookmarkCounts загружает, сколько раз сохранён каждый пост
+func (app *app) loadBookmarkCounts(posts []*models.Post) {
+	for _, post := range posts {
+		count, err := app.BookmarkService.CountPostBookmarks(post.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to count bookmarks of post %d: %v", post.ID, err)
+			continue
+		}
+		post.Bookmarks = count
+	}
+}
+
+// loadBookmark загружает закладку текущего пользователя на пост и его папки
+func (app *app) loadBookmark(data *HTMLData) {
+	if data.CurrentUser == nil {
+		return
+	}
+
+	bookmark, err := app.BookmarkService.GetBookmark(data.CurrentUser.ID, data.Post.ID)
+	if err != nil {
+		if err != database.ErrBookmarkNotFound {
+			app.errorLog.Printf("Failed to get bookmark of post %d: %v", data.Post.ID, err)
+		}
+		return
+	}
+	data.Bookmark = bookmark
+
+	data.BookmarkFolders, err = app.BookmarkService.GetFolders(data.CurrentUser.ID)
+	if err != nil {
+		app.errorLog.Printf("Failed to get bookmark folders of user %d: %v", data.CurrentUser.ID, err)
+	}
+}
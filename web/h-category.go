@@ -4,9 +4,14 @@ import (
 	"forum/internal/database"
 	"forum/internal/models"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// categoryPermissionsPath разбирает /category/{slug}/permissions
+var categoryPermissionsPath = regexp.MustCompile(`^/category/([a-z0-9-]+)/permissions$`)
+
 // categories - список всех категорий
 func (app *app) categories(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -14,7 +19,13 @@ func (app *app) categories(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	categories, err := app.CategoryService.GetAllCategories()
+	user := app.getCurrentUser(r)
+	viewerID := 0
+	if user != nil {
+		viewerID = user.ID
+	}
+
+	categories, err := app.CategoryService.GetCategoryTree(viewerID)
 	if err != nil {
 		app.ServerError(w, err)
 		return
@@ -23,14 +34,15 @@ func (app *app) categories(w http.ResponseWriter, r *http.Request) {
 	data := &HTMLData{
 		Title:       "Категории",
 		Path:        r.URL.Path,
-		CurrentUser: app.getCurrentUser(r),
+		CurrentUser: user,
 		Categories:  categories,
 	}
 
 	app.RenderHTML(w, r, "categories.page.html", data)
 }
 
-// viewCategory - просмотр постов категории
+// viewCategory - просмотр постов категории вместе с подкатегориями;
+// ?direct=1 оставляет только посты самой категории
 func (app *app) viewCategory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		app.MethodNotAllowed(w, []string{"GET"})
@@ -49,19 +61,145 @@ func (app *app) viewCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := app.CategoryService.GetCategoryPosts(category.ID, 20, 0)
+	user := app.getCurrentUser(r)
+	viewerID := 0
+	if user != nil {
+		viewerID = user.ID
+	}
+
+	// Закрытая категория для посторонних выглядит несуществующей
+	allowed, err := app.CategoryService.CanAccess(viewerID, category.ID, models.CategoryView)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if !allowed {
+		app.NotFound(w)
+		return
+	}
+
+	if err := app.CategoryService.LoadAncestors([]*models.Category{category}); err != nil {
+		app.errorLog.Printf("Failed to get ancestors of category %d: %v", category.ID, err)
+	}
+	if category.Children, err = app.CategoryService.GetSubcategories(category.ID, viewerID); err != nil {
+		app.errorLog.Printf("Failed to get subcategories of category %d: %v", category.ID, err)
+	}
+
+	direct := r.URL.Query().Get("direct") == "1"
+
+	before, err := database.ParseFeedCursor(r.URL.Query().Get("before"))
+	if err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	posts, err := app.CategoryService.GetCategoryPosts(category.ID, viewerID, !direct, before, postsPerPage+1)
 	if err != nil {
 		app.errorLog.Printf("Failed to get category posts: %v", err)
 		posts = []*models.Post{}
 	}
+	posts, nextCursor := feedPage(posts)
+
+	app.loadAttachments(posts)
+	app.loadTags(posts)
+	app.loadBookmarkCounts(posts)
+	app.loadAuthors(posts)
 
 	data := &HTMLData{
 		Title:       category.Name,
 		Path:        r.URL.Path,
-		CurrentUser: app.getCurrentUser(r),
+		CurrentUser: user,
 		Category:    category,
 		Posts:       posts,
+		DirectOnly:  direct,
+		NextCursor:  nextCursor,
+		FirstPage:   before == nil,
+	}
+
+	if user != nil {
+		subscribed, err := app.SubscriptionService.IsSubscribedToCategory(user.ID, category.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to check subscription to category %d: %v", category.ID, err)
+		}
+		data.Subscribed = subscribed
+	}
+
+	if user.IsAdmin() {
+		if data.Permissions, err = app.CategoryService.GetPermissions(category.ID); err != nil {
+			app.errorLog.Printf("Failed to get permissions of category %d: %v", category.ID, err)
+		}
+		data.Roles = models.Roles
+		if data.Groups, err = app.GroupService.GetAllGroups(); err != nil {
+			app.errorLog.Printf("Failed to get groups: %v", err)
+		}
 	}
 
 	app.RenderHTML(w, r, "category.page.html", data)
 }
+
+// categoryPermissions сохраняет правила категории из формы: для каждого действия
+// либо флажок inherit_{действие}, либо роли в поле {действие} и ID групп
+// в поле {действие}_group.
+// Доступно только администраторам
+func (app *app) categoryPermissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+	if !user.IsAdmin() {
+		app.Forbidden(w)
+		return
+	}
+
+	matches := categoryPermissionsPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	category, err := app.CategoryService.GetCategoryBySlug(matches[1])
+	if err != nil {
+		if err == database.ErrCategoryNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	for _, action := range models.CategoryActions {
+		var roles []string
+		var groupIDs []int
+		if r.FormValue("inherit_"+action) == "" {
+			roles = append([]string{}, r.Form[action]...)
+			for _, value := range r.Form[action+"_group"] {
+				groupID, err := strconv.Atoi(value)
+				if err != nil {
+					app.ClientError(w, http.StatusBadRequest)
+					return
+				}
+				groupIDs = append(groupIDs, groupID)
+			}
+		}
+
+		if err := app.CategoryService.SetPermissions(category.ID, action, roles, groupIDs); err != nil {
+			if err == database.ErrUnknownRole || err == database.ErrGroupNotFound {
+				app.ClientError(w, http.StatusBadRequest)
+				return
+			}
+			app.ServerError(w, err)
+			return
+		}
+	}
+
+	app.infoLog.Printf("Category permissions updated: ID=%d, Admin=%q", category.ID, user.Username)
+
+	http.Redirect(w, r, "/category/"+category.Slug, http.StatusSeeOther)
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"encoding/json"
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// draftDeletePath разбирает /drafts/{id}/delete
+var draftDeletePath = regexp.MustCompile(`^/drafts/(\d+)/delete$`)
+
+// drafts показывает черновики пользователя
+func (app *app) drafts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	drafts, err := app.DraftService.GetUserDrafts(user.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	// Отложенные посты тоже ещё не видны читателям, поэтому они здесь же
+	scheduled, err := app.PostService.GetScheduledPosts(user.ID)
+	if err != nil {
+		app.errorLog.Printf("Failed to get scheduled posts of user %d: %v", user.ID, err)
+	}
+
+	data := &HTMLData{
+		Title:       "Черновики",
+		Path:        r.URL.Path,
+		CurrentUser: user,
+		Drafts:      drafts,
+		Posts:       scheduled,
+	}
+
+	app.RenderHTML(w, r, "drafts.page.html", data)
+}
+
+// autosaveDraft сохраняет черновик из формы создания или правки поста и
+// отвечает JSON с ID черновика. Вызывается скриптом, поэтому вместо
+// перенаправления на /login отвечает 401: форма останется на странице
+// и сохранится, когда пользователь снова войдёт
+func (app *app) autosaveDraft(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	user := app.getCurrentUser(r)
+	if user == nil {
+		app.ClientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	r.ParseForm()
+
+	draftID, _ := strconv.Atoi(r.FormValue("draft_id"))
+
+	var postID *int
+	if id, err := strconv.Atoi(r.FormValue("post_id")); err == nil {
+		post, err := app.PostService.GetPost(id, user)
+		if err != nil {
+			if err == database.ErrPostNotFound {
+				app.NotFound(w)
+				return
+			}
+			app.ServerError(w, err)
+			return
+		}
+		if post.UserID != user.ID && !user.IsModerator() {
+			app.Forbidden(w)
+			return
+		}
+		postID = &post.ID
+	}
+
+	draft, err := app.DraftService.SaveDraft(user.ID, draftID, postID,
+		strings.TrimSpace(r.FormValue("title")), strings.TrimSpace(r.FormValue("content")),
+		strings.TrimSpace(r.FormValue("tags")), formCategoryIDs(r))
+	if err != nil {
+		switch err {
+		case database.ErrDraftNotFound:
+			app.NotFound(w)
+		case database.ErrEmptyDraft, database.ErrLongTitle, database.ErrLongContent:
+			app.ClientError(w, http.StatusBadRequest)
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ID      int       `json:"id"`
+		Updated time.Time `json:"updated"`
+	}{draft.ID, draft.Updated})
+}
+
+// deleteDraft удаляет черновик
+func (app *app) deleteDraft(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	matches := draftDeletePath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	draftID, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	if err := app.DraftService.DeleteDraft(user.ID, draftID); err != nil {
+		if err == database.ErrDraftNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	app.redirectBack(w, r, "/drafts")
+}
+
+// discardDraft удаляет черновик после публикации; ошибка только пишется в журнал
+func (app *app) discardDraft(draft *models.Draft) {
+	if draft == nil {
+		return
+	}
+	if err := app.DraftService.DeleteDraft(draft.UserID, draft.ID); err != nil && err != database.ErrDraftNotFound {
+		app.errorLog.Printf("Failed to delete draft %d: %v", draft.ID, err)
+	}
+}
+
+// formCategoryIDs собирает ID выбранных в форме категорий
+func formCategoryIDs(r *http.Request) []int {
+	var categoryIDs []int
+	for _, categoryIDStr := range r.Form["categories"] {
+		categoryID, err := strconv.Atoi(categoryIDStr)
+		if err != nil {
+			continue
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	return categoryIDs
+}
@@ -0,0 +1,266 @@
+package web
+
+import (
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// groupAuditLimit - сколько записей журнала показывать
+const groupAuditLimit = 50
+
+// groupActionPath разбирает /group/{slug}/{действие}
+var groupActionPath = regexp.MustCompile(`^/group/([a-z0-9-]+)/(add|remove|leave|invite|owner|delete)$`)
+
+// groups - список групп, вступление по коду и создание групп администраторами
+func (app *app) groups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	app.renderGroups(w, r, "", nil)
+}
+
+// renderGroups показывает список групп; formError и formData - ошибка и значения
+// отправленной формы
+func (app *app) renderGroups(w http.ResponseWriter, r *http.Request, formError string, formData map[string]string) {
+	user := app.getCurrentUser(r)
+
+	groups, err := app.GroupService.GetAllGroups()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	data := &HTMLData{
+		Title:       "Группы",
+		Path:        r.URL.Path,
+		CurrentUser: user,
+		Groups:      groups,
+		FormError:   formError,
+		FormData:    formData,
+	}
+
+	if user.IsAdmin() {
+		if data.GroupAudit, err = app.GroupService.GetAudit(0, groupAuditLimit); err != nil {
+			app.errorLog.Printf("Failed to get group audit: %v", err)
+		}
+	}
+
+	app.RenderHTML(w, r, "groups.page.html", data)
+}
+
+// createGroup создаёт группу. Доступно только администраторам
+func (app *app) createGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+	if !user.IsAdmin() {
+		app.Forbidden(w)
+		return
+	}
+
+	formData := map[string]string{
+		"name":        r.FormValue("name"),
+		"slug":        r.FormValue("slug"),
+		"description": r.FormValue("description"),
+		"owner":       r.FormValue("owner"),
+	}
+
+	// Владелец необязателен: группой без владельца управляют администраторы
+	ownerID := 0
+	if formData["owner"] != "" {
+		owner, err := app.UserService.GetUserByUsername(formData["owner"])
+		if err != nil {
+			if err == database.ErrUserNotFound {
+				app.renderGroups(w, r, "Владелец группы не найден", formData)
+				return
+			}
+			app.ServerError(w, err)
+			return
+		}
+		ownerID = owner.ID
+	}
+
+	group, err := app.GroupService.CreateGroup(formData["name"], formData["slug"], formData["description"], ownerID, user.ID)
+	if err != nil {
+		switch err {
+		case database.ErrEmptyGroupName, database.ErrLongGroupName, database.ErrInvalidGroupSlug,
+			database.ErrGroupSlugIsUser, database.ErrGroupExists, database.ErrLongDescription:
+			app.renderGroups(w, r, err.Error(), formData)
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	app.infoLog.Printf("Group created: ID=%d, Slug=%q, Admin=%q", group.ID, group.Slug, user.Username)
+
+	http.Redirect(w, r, "/group/"+group.Slug, http.StatusSeeOther)
+}
+
+// joinGroup вступает в группу по коду приглашения
+func (app *app) joinGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	group, err := app.GroupService.JoinByInvite(r.FormValue("code"), user.ID)
+	if err != nil {
+		if err == database.ErrInvalidInviteCode {
+			app.renderGroups(w, r, err.Error(), map[string]string{"code": r.FormValue("code")})
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/group/"+group.Slug, http.StatusSeeOther)
+}
+
+// viewGroup - страница группы с участниками; владельцу и администраторам
+// доступны управление участниками, код приглашения и журнал
+func (app *app) viewGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	group, err := app.GroupService.GetGroupBySlug(strings.TrimPrefix(r.URL.Path, "/group/"))
+	if err != nil {
+		if err == database.ErrGroupNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	app.renderGroup(w, r, group, "")
+}
+
+// renderGroup показывает страницу группы с ошибкой формы formError
+func (app *app) renderGroup(w http.ResponseWriter, r *http.Request, group *models.Group, formError string) {
+	user := app.getCurrentUser(r)
+
+	members, err := app.GroupService.GetMembers(group.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	data := &HTMLData{
+		Title:        group.Name,
+		Path:         r.URL.Path,
+		CurrentUser:  user,
+		Group:        group,
+		GroupMembers: members,
+		FormError:    formError,
+	}
+
+	if user != nil {
+		for _, member := range members {
+			if member.ID == user.ID {
+				data.GroupMember = true
+				break
+			}
+		}
+	}
+
+	if group.ManagedBy(user) {
+		if data.GroupAudit, err = app.GroupService.GetAudit(group.ID, groupAuditLimit); err != nil {
+			app.errorLog.Printf("Failed to get audit of group %d: %v", group.ID, err)
+		}
+	}
+
+	app.RenderHTML(w, r, "group.page.html", data)
+}
+
+// manageGroup выполняет действие с группой. Выйти может любой участник, удалить
+// группу - администратор, остальное - владелец группы и администраторы
+func (app *app) manageGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	matches := groupActionPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	group, err := app.GroupService.GetGroupBySlug(matches[1])
+	if err != nil {
+		if err == database.ErrGroupNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	user := app.getCurrentUser(r)
+	action := matches[2]
+
+	allowed := group.ManagedBy(user)
+	switch action {
+	case "leave":
+		allowed = true
+	case "delete":
+		allowed = user.IsAdmin()
+	}
+	if !allowed {
+		app.Forbidden(w)
+		return
+	}
+
+	switch action {
+	case "leave":
+		err = app.GroupService.RemoveMember(group, user.ID, user.ID)
+	case "invite":
+		err = app.GroupService.ResetInviteCode(group, user.ID)
+	case "delete":
+		if err = app.GroupService.DeleteGroup(group, user.ID); err == nil {
+			app.infoLog.Printf("Group deleted: ID=%d, Slug=%q, Admin=%q", group.ID, group.Slug, user.Username)
+			http.Redirect(w, r, "/groups", http.StatusSeeOther)
+			return
+		}
+	default:
+		var member *models.User
+		member, err = app.UserService.GetUserByUsername(r.FormValue("username"))
+		if err != nil {
+			break
+		}
+		switch action {
+		case "add":
+			err = app.GroupService.AddMember(group, member.ID, user.ID)
+		case "remove":
+			err = app.GroupService.RemoveMember(group, member.ID, user.ID)
+		case "owner":
+			err = app.GroupService.SetOwner(group, member.ID, user.ID)
+		}
+	}
+
+	if err != nil {
+		switch err {
+		case database.ErrUserNotFound, database.ErrAlreadyGroupMember, database.ErrNotGroupMember,
+			database.ErrGroupOwnerLeaving:
+			app.renderGroup(w, r, group, err.Error())
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/group/"+group.Slug, http.StatusSeeOther)
+}
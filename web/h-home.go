@@ -6,6 +6,17 @@ import (
 	"net/http"
 )
 
+// postsPerPage - размер страницы ленты
+const postsPerPage = 20
+
+// Ленты главной страницы
+const (
+	feedAll       = ""          // все посты
+	feedFollowing = "following" // подписки на пользователей и категории
+)
+
+// home показывает ленту постов. Параметры запроса: feed - лента,
+// category и tag - фильтры общей ленты, before - курсор следующей страницы
 func (app *app) home(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		app.MethodNotAllowed(w, []string{"GET"})
@@ -13,16 +24,43 @@ func (app *app) home(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := app.getCurrentUser(r)
+	viewerID := 0
+	if user != nil {
+		viewerID = user.ID
+	}
+
+	feed := r.URL.Query().Get("feed")
+	if feed != feedFollowing {
+		feed = feedAll
+	}
+	if feed == feedFollowing && user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	before, err := database.ParseFeedCursor(r.URL.Query().Get("before"))
+	if err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
 
-	// Получаем параметр фильтра по категории
+	// Получаем параметры фильтра по категории и тегу
 	categorySlug := r.URL.Query().Get("category")
+	tagName := r.URL.Query().Get("tag")
+	if feed == feedFollowing {
+		// Фильтры относятся только к общей ленте
+		categorySlug, tagName = "", ""
+	}
 
+	// Все ленты листаются курсором и запрашиваются на один пост больше
+	// страницы, чтобы узнать, есть ли следующая
 	var posts []*models.Post
-	var err error
+	var nextCursor string
 
+	var category *models.Category
 	if categorySlug != "" {
 		// Получаем категорию по slug
-		category, err := app.CategoryService.GetCategoryBySlug(categorySlug)
+		category, err = app.CategoryService.GetCategoryBySlug(categorySlug)
 		if err != nil {
 			if err == database.ErrCategoryNotFound {
 				app.NotFound(w)
@@ -32,35 +70,71 @@ func (app *app) home(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		allowed, err := app.CategoryService.CanAccess(viewerID, category.ID, models.CategoryView)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		if !allowed {
+			app.NotFound(w)
+			return
+		}
+	}
+
+	if tagName != "" {
+		var tag *models.Tag
+		tag, err = app.TagService.GetTagByName(tagName)
+		if err != nil {
+			if err == database.ErrTagNotFound {
+				app.NotFound(w)
+				return
+			}
+			app.ServerError(w, err)
+			return
+		}
+		tagName = tag.Name
+
+		// Посты с тегом, при необходимости только из выбранной категории
+		categoryID := 0
+		if category != nil {
+			categoryID = category.ID
+		}
+		posts, err = app.TagService.GetTagPosts(tag.ID, categoryID, viewerID, before, postsPerPage+1)
+	} else if category != nil {
 		// Получаем посты этой категории
-		posts, err = app.CategoryService.GetCategoryPosts(category.ID, 20, 0)
+		posts, err = app.CategoryService.GetCategoryPosts(category.ID, viewerID, true, before, postsPerPage+1)
+	} else if feed == feedFollowing {
+		posts, err = app.PostService.GetFollowingPosts(user.ID, before, postsPerPage+1)
 	} else {
-		// Получаем все посты
-		posts, err = app.PostService.GetAllPosts(20, 0)
+		posts, err = app.PostService.GetAllPosts(viewerID, before, postsPerPage+1)
 	}
+	posts, nextCursor = feedPage(posts)
 
 	if err != nil {
 		app.errorLog.Printf("Failed to get posts: %v", err)
 		posts = []*models.Post{}
 	}
 
-	// Для каждого поста получаем категории
-	for _, post := range posts {
-		categories, err := app.CategoryService.GetPostCategories(post.ID)
-		if err != nil {
-			app.errorLog.Printf("Failed to get categories for post %d: %v", post.ID, err)
-			categories = []*models.Category{}
-		}
-		post.Categories = categories
-	}
+	app.loadAttachments(posts)
+	app.loadTags(posts)
+	app.loadBookmarkCounts(posts)
+	app.loadAuthors(posts)
 
-	// Получаем все категории для фильтра
+	// Получаем все доступные категории для фильтра
 	categories, err := app.CategoryService.GetAllCategories()
+	if err == nil {
+		categories, err = app.CategoryService.FilterCategories(viewerID, categories, models.CategoryView)
+	}
 	if err != nil {
 		app.errorLog.Printf("Failed to get categories: %v", err)
 		categories = []*models.Category{}
 	}
 
+	tagCloud, err := app.TagService.GetTagCloud(viewerID, 40)
+	if err != nil {
+		app.errorLog.Printf("Failed to get tag cloud: %v", err)
+	}
+
 	data := &HTMLData{
 		Title:          "Главная",
 		Path:           r.URL.Path,
@@ -68,7 +142,22 @@ func (app *app) home(w http.ResponseWriter, r *http.Request) {
 		Posts:          posts,
 		Categories:     categories,
 		FilterCategory: categorySlug,
+		FilterTag:      tagName,
+		TagCloud:       tagCloud,
+		Feed:           feed,
+		NextCursor:     nextCursor,
+		FirstPage:      before == nil,
 	}
 
 	app.RenderHTML(w, r, "home.page.html", data)
 }
+
+// feedPage обрезает ленту, запрошенную на один пост больше страницы, и
+// возвращает курсор следующей страницы (пустой, если это последняя)
+func feedPage(posts []*models.Post) ([]*models.Post, string) {
+	if len(posts) <= postsPerPage {
+		return posts, ""
+	}
+	posts = posts[:postsPerPage]
+	return posts, database.NewFeedCursor(posts[len(posts)-1]).String()
+}
@@ -0,0 +1,257 @@
+package web
+
+import (
+	"errors"
+	"forum/internal/database"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// conversationPath разбирает /messages/{id} и /messages/{id}/archive|unarchive|delete
+var conversationPath = regexp.MustCompile(`^/messages/(\d+)(?:/(archive|unarchive|delete))?$`)
+
+// messages показывает переписки пользователя: входящие или архив (?archived=1)
+func (app *app) messages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+	archived := r.URL.Query().Get("archived") == "1"
+
+	conversations, err := app.MessageService.GetConversations(user.ID, archived)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	blocked, err := app.MessageService.GetBlockedUsers(user.ID)
+	if err != nil {
+		app.errorLog.Printf("Failed to get blocked users of user %d: %v", user.ID, err)
+	}
+
+	data := &HTMLData{
+		Title:         "Сообщения",
+		Path:          r.URL.Path,
+		CurrentUser:   user,
+		Conversations: conversations,
+		BlockedUsers:  blocked,
+		Archived:      archived,
+	}
+
+	app.RenderHTML(w, r, "messages.page.html", data)
+}
+
+// newConversation начинает переписку. Получатели перечисляются через запятую
+// в поле to; ?to=username заполняет его при переходе со страницы пользователя
+func (app *app) newConversation(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		data := &HTMLData{
+			Title:       "Новое сообщение",
+			Path:        r.URL.Path,
+			CurrentUser: user,
+			FormData:    map[string]string{"to": r.URL.Query().Get("to")},
+		}
+		app.RenderHTML(w, r, "new-message.page.html", data)
+
+	case http.MethodPost:
+		r.ParseForm()
+
+		to := r.FormValue("to")
+		subject := r.FormValue("subject")
+		content := r.FormValue("content")
+
+		conversationID, err := app.MessageService.StartConversation(user.ID, strings.Split(to, ","), subject, content)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrRecipientNotFound), errors.Is(err, database.ErrSenderBlocked),
+				err == database.ErrNoRecipients, err == database.ErrTooManyRecipients,
+				err == database.ErrMessageToSelf, err == database.ErrEmptyMessage,
+				err == database.ErrLongMessage, err == database.ErrLongSubject,
+				err == database.ErrConversationRateLimit:
+
+				data := &HTMLData{
+					Title:       "Новое сообщение",
+					Path:        r.URL.Path,
+					CurrentUser: user,
+					FormError:   err.Error(),
+					FormData: map[string]string{
+						"to":      to,
+						"subject": subject,
+						"content": content,
+					},
+				}
+				if err == database.ErrConversationRateLimit {
+					w.WriteHeader(http.StatusTooManyRequests)
+				}
+				app.RenderHTML(w, r, "new-message.page.html", data)
+			default:
+				app.ServerError(w, err)
+			}
+			return
+		}
+
+		http.Redirect(w, r, "/messages/"+strconv.Itoa(conversationID), http.StatusSeeOther)
+
+	default:
+		app.MethodNotAllowed(w, []string{"GET", "POST"})
+	}
+}
+
+// conversation показывает переписку и принимает ответ в неё (/messages/{id}),
+// а также архивирует и удаляет её (/messages/{id}/archive|unarchive|delete)
+func (app *app) conversation(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUser(r)
+
+	matches := conversationPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	if matches[2] != "" {
+		if r.Method != http.MethodPost {
+			app.MethodNotAllowed(w, []string{"POST"})
+			return
+		}
+
+		if matches[2] == "delete" {
+			err = app.MessageService.DeleteConversation(conversationID, user.ID)
+		} else {
+			err = app.MessageService.SetArchived(conversationID, user.ID, matches[2] == "archive")
+		}
+		if err != nil {
+			if err == database.ErrConversationNotFound {
+				app.NotFound(w)
+				return
+			}
+			app.ServerError(w, err)
+			return
+		}
+
+		if matches[2] == "unarchive" {
+			http.Redirect(w, r, "/messages/"+strconv.Itoa(conversationID), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/messages", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		app.renderConversation(w, r, conversationID, "", "")
+
+	case http.MethodPost:
+		content := r.FormValue("content")
+
+		_, err := app.MessageService.SendMessage(conversationID, user.ID, content)
+		if err != nil {
+			switch err {
+			case database.ErrConversationNotFound:
+				app.NotFound(w)
+			case database.ErrEmptyMessage, database.ErrLongMessage, database.ErrSenderBlocked:
+				app.renderConversation(w, r, conversationID, err.Error(), content)
+			default:
+				app.ServerError(w, err)
+			}
+			return
+		}
+
+		http.Redirect(w, r, "/messages/"+strconv.Itoa(conversationID), http.StatusSeeOther)
+
+	default:
+		app.MethodNotAllowed(w, []string{"GET", "POST"})
+	}
+}
+
+// renderConversation отрисовывает переписку и отмечает её прочитанной
+func (app *app) renderConversation(w http.ResponseWriter, r *http.Request, conversationID int, formError, content string) {
+	user := app.getCurrentUser(r)
+
+	conversation, err := app.MessageService.GetConversation(conversationID, user.ID)
+	if err != nil {
+		if err == database.ErrConversationNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	messages, err := app.MessageService.GetMessages(conversation.ID, user.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	// Отмечаем до отрисовки, чтобы значок в шапке сразу обнулился
+	if err := app.MessageService.MarkRead(conversation.ID, user.ID); err != nil {
+		app.errorLog.Printf("Failed to mark conversation %d read: %v", conversation.ID, err)
+	}
+
+	title := conversation.Subject
+	if title == "" {
+		title = "Переписка"
+	}
+
+	data := &HTMLData{
+		Title:        title,
+		Path:         r.URL.Path,
+		CurrentUser:  user,
+		FormError:    formError,
+		FormData:     map[string]string{"content": content},
+		Conversation: conversation,
+		Messages:     messages,
+	}
+
+	app.RenderHTML(w, r, "conversation.page.html", data)
+}
+
+// blockUser запрещает пользователю из поля username писать текущему (/messages/block)
+// или снимает запрет (/messages/unblock)
+func (app *app) blockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	blocked, err := app.UserService.GetUserByUsername(r.FormValue("username"))
+	if err != nil {
+		if err == database.ErrUserNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	if r.URL.Path == "/messages/block" {
+		err = app.MessageService.BlockUser(user.ID, blocked.ID)
+	} else {
+		err = app.MessageService.UnblockUser(user.ID, blocked.ID)
+	}
+	if err != nil {
+		if err == database.ErrBlockSelf {
+			app.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	app.redirectBack(w, r, "/messages")
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"forum/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// notifications показывает уведомления пользователя, сгруппированные по событиям,
+// и настройки типов уведомлений
+func (app *app) notifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	groups, err := app.NotificationService.GetUserNotificationGroups(user.ID, 200)
+	if err != nil {
+		app.errorLog.Printf("Failed to get notifications of user %d: %v", user.ID, err)
+		groups = []*models.NotificationGroup{}
+	}
+
+	settings, err := app.NotificationService.GetSettings(user.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	data := &HTMLData{
+		Title:                "Уведомления",
+		Path:                 r.URL.Path,
+		CurrentUser:          user,
+		NotificationGroups:   groups,
+		NotificationSettings: settings,
+	}
+
+	app.RenderHTML(w, r, "notifications.page.html", data)
+}
+
+// markNotificationsRead отмечает прочитанными уведомления одной группы
+func (app *app) markNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	r.ParseForm()
+	var ids []int
+	for _, idStr := range r.Form["id"] {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	if err := app.NotificationService.MarkRead(user.ID, ids); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// markAllNotificationsRead отмечает прочитанными все уведомления
+func (app *app) markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	if err := app.NotificationService.MarkAllRead(user.ID); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// notificationSettings сохраняет включённые типы уведомлений
+func (app *app) notificationSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	r.ParseForm()
+	if err := app.NotificationService.SetEnabledTypes(user.ID, r.Form["types"]); err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
@@ -0,0 +1,255 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pollPostID извлекает ID поста из путей вида /post/{id}/poll...
+var pollPostID = regexp.MustCompile(`^/post/(\d+)/poll`)
+
+// datetimeLocalLayout - формат значения поля datetime-local
+const datetimeLocalLayout = "2006-01-02T15:04"
+
+// createPoll показывает форму и прикрепляет опрос к посту
+func (app *app) createPoll(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUser(r)
+
+	post, ok := app.pollPost(w, r)
+	if !ok {
+		return
+	}
+
+	if post.UserID != user.ID {
+		app.Forbidden(w)
+		return
+	}
+
+	// Опрос у поста может быть только один
+	if _, err := app.PollService.GetPostPoll(post.ID, user.ID); err == nil {
+		http.Redirect(w, r, "/post/"+strconv.Itoa(post.ID), http.StatusSeeOther)
+		return
+	}
+
+	data := &HTMLData{
+		Title:       "Добавить опрос",
+		Path:        r.URL.Path,
+		CurrentUser: user,
+		Post:        post,
+		FormData:    map[string]string{},
+		PollOptions: make([]string, database.MaxPollOptions),
+	}
+
+	if r.Method != http.MethodPost {
+		app.RenderHTML(w, r, "create-poll.page.html", data)
+		return
+	}
+
+	question := strings.TrimSpace(r.FormValue("question"))
+	options := r.Form["options"]
+	multiple := r.FormValue("multiple") == "on"
+	resultsAfterVote := r.FormValue("results_after_vote") == "on"
+	closesAtStr := r.FormValue("closes_at")
+
+	var err error
+	var closesAt *time.Time
+	if closesAtStr != "" {
+		var t time.Time
+		t, err = time.ParseInLocation(datetimeLocalLayout, closesAtStr, time.Local)
+		if err != nil {
+			err = errors.New("неверный формат времени закрытия")
+		}
+		closesAt = &t
+	}
+
+	if err == nil {
+		_, err = app.PollService.CreatePoll(post.ID, user.ID, question, options,
+			multiple, resultsAfterVote, closesAt)
+	}
+	if err != nil {
+		data.FormError = err.Error()
+		data.FormData = map[string]string{
+			"question":           question,
+			"closes_at":          closesAtStr,
+			"multiple":           r.FormValue("multiple"),
+			"results_after_vote": r.FormValue("results_after_vote"),
+		}
+		copy(data.PollOptions, options)
+		app.RenderHTML(w, r, "create-poll.page.html", data)
+		return
+	}
+
+	app.infoLog.Printf("Poll created: PostID=%d, Author=%q", post.ID, user.Username)
+	http.Redirect(w, r, "/post/"+strconv.Itoa(post.ID), http.StatusSeeOther)
+}
+
+// votePoll сохраняет или меняет голос пользователя
+func (app *app) votePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	post, ok := app.pollPost(w, r)
+	if !ok {
+		return
+	}
+
+	poll, err := app.PollService.GetPostPoll(post.ID, user.ID)
+	if err != nil {
+		if err == database.ErrPollNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	r.ParseForm()
+	var optionIDs []int
+	for _, optionIDStr := range r.Form["options"] {
+		optionID, err := strconv.Atoi(optionIDStr)
+		if err != nil {
+			continue
+		}
+		optionIDs = append(optionIDs, optionID)
+	}
+
+	if err := app.PollService.Vote(poll.ID, user.ID, optionIDs); err != nil {
+		if errors.Is(err, database.ErrPollVoteFailed) {
+			app.ServerError(w, err)
+			return
+		}
+		app.renderPost(w, r, post, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/post/"+strconv.Itoa(post.ID)+"#poll", http.StatusSeeOther)
+}
+
+// pollResults отдаёт результаты опроса в JSON. Если результаты видны только
+// после голосования, количество голосов не раскрывается
+func (app *app) pollResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	post, ok := app.pollPost(w, r)
+	if !ok {
+		return
+	}
+
+	userID := 0
+	if user := app.getCurrentUser(r); user != nil {
+		userID = user.ID
+	}
+
+	poll, err := app.PollService.GetPostPoll(post.ID, userID)
+	if err != nil {
+		if err == database.ErrPollNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	type optionJSON struct {
+		ID      int    `json:"id"`
+		Text    string `json:"text"`
+		Votes   *int   `json:"votes,omitempty"`
+		Percent *int   `json:"percent,omitempty"`
+		Chosen  bool   `json:"chosen"`
+	}
+
+	response := struct {
+		ID               int          `json:"id"`
+		PostID           int          `json:"post_id"`
+		Question         string       `json:"question"`
+		Multiple         bool         `json:"multiple"`
+		ResultsAfterVote bool         `json:"results_after_vote"`
+		ClosesAt         *time.Time   `json:"closes_at"`
+		Closed           bool         `json:"closed"`
+		ResultsVisible   bool         `json:"results_visible"`
+		Voters           *int         `json:"voters,omitempty"`
+		Options          []optionJSON `json:"options"`
+	}{
+		ID:               poll.ID,
+		PostID:           poll.PostID,
+		Question:         poll.Question,
+		Multiple:         poll.Multiple,
+		ResultsAfterVote: poll.ResultsAfterVote,
+		ClosesAt:         poll.ClosesAt,
+		Closed:           poll.IsClosed(),
+		ResultsVisible:   poll.ShowResults(),
+	}
+
+	if response.ResultsVisible {
+		response.Voters = &poll.Voters
+	}
+	for _, option := range poll.Options {
+		item := optionJSON{ID: option.ID, Text: option.Text, Chosen: option.Chosen}
+		if response.ResultsVisible {
+			item.Votes = &option.Votes
+			item.Percent = &option.Percent
+		}
+		response.Options = append(response.Options, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// pollPost загружает пост по ID из пути. При ошибке сам отвечает клиенту
+func (app *app) pollPost(w http.ResponseWriter, r *http.Request) (*models.Post, bool) {
+	matches := pollPostID.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return nil, false
+	}
+
+	post, err := app.PostService.GetPost(id, app.getCurrentUser(r))
+	if err != nil {
+		if err == database.ErrPostNotFound {
+			app.NotFound(w)
+			return nil, false
+		}
+		app.ServerError(w, err)
+		return nil, false
+	}
+
+	return post, true
+}
+
+// loadPoll загружает опрос поста с выбором текущего пользователя
+func (app *app) loadPoll(post *models.Post, user *models.User) {
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+
+	poll, err := app.PollService.GetPostPoll(post.ID, userID)
+	if err != nil {
+		if err != database.ErrPollNotFound {
+			app.errorLog.Printf("Failed to get poll for post %d: %v", post.ID, err)
+		}
+		return
+	}
+	post.Poll = poll
+}
@@ -1,11 +1,14 @@
 package web
 
 import (
+	"errors"
 	"forum/internal/database"
+	"forum/internal/markdown"
 	"forum/internal/models"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // createPost создает новый пост
@@ -16,8 +19,11 @@ func (app *app) createPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получаем все категории для формы
+	// Форма предлагает только категории, в которых пользователь может публиковать
 	categories, err := app.CategoryService.GetAllCategories()
+	if err == nil {
+		categories, err = app.CategoryService.FilterCategories(user.ID, categories, models.CategoryPost)
+	}
 	if err != nil {
 		app.errorLog.Printf("Failed to get categories: %v", err)
 		categories = []*models.Category{}
@@ -30,10 +36,42 @@ func (app *app) createPost(w http.ResponseWriter, r *http.Request) {
 			CurrentUser: user,
 			Categories:  categories,
 		}
+
+		// Продолжение черновика из списка /drafts
+		if draftID, err := strconv.Atoi(r.URL.Query().Get("draft")); err == nil {
+			draft, err := app.DraftService.GetDraft(user.ID, draftID)
+			if err != nil {
+				if err == database.ErrDraftNotFound {
+					app.NotFound(w)
+					return
+				}
+				app.ServerError(w, err)
+				return
+			}
+
+			// Черновик правки открывается на странице редактирования поста
+			if draft.PostID != nil {
+				http.Redirect(w, r, "/post/"+strconv.Itoa(*draft.PostID)+"/edit", http.StatusSeeOther)
+				return
+			}
+
+			data.Draft = draft
+			data.FormData = draftFormData(draft)
+			data.PostCategories = selectCategories(categories, draft.CategoryIDs)
+		}
+
 		app.RenderHTML(w, r, "create-post.page.html", data)
 		return
 	}
 
+	// Форма может содержать изображения (multipart). Слишком большие
+	// загрузки показываем в форме, повреждённое тело - ошибка запроса
+	formErr := app.parsePostForm(w, r)
+	if formErr != nil && formErr != database.ErrAttachmentTooLarge {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
 	title := strings.TrimSpace(r.FormValue("title"))
 	content := strings.TrimSpace(r.FormValue("content"))
 
@@ -49,18 +87,59 @@ func (app *app) createPost(w http.ResponseWriter, r *http.Request) {
 		categoryIDs = append(categoryIDs, categoryID)
 	}
 
-	// Передаем categoryIDs в CreatePost
-	post, err := app.PostService.CreatePost(title, content, user.ID, categoryIDs)
+	tagsValue, tagNames, tagsErr := app.parseTags(r)
+	if formErr == nil {
+		formErr = tagsErr
+	}
+
+	// Время отложенной публикации; пустое поле - опубликовать сразу
+	publishAtValue := r.FormValue("publish_at")
+	var publishAt *time.Time
+	if publishAtValue != "" && formErr == nil {
+		t, err := time.ParseInLocation(datetimeLocalLayout, publishAtValue, time.Local)
+		if err != nil {
+			formErr = errors.New("неверный формат времени публикации")
+		}
+		publishAt = &t
+	}
+
+	// Черновик, который автосохранялся из этой формы
+	var draft *models.Draft
+	if draftID, err := strconv.Atoi(r.FormValue("draft_id")); err == nil {
+		draft, err = app.DraftService.GetDraft(user.ID, draftID)
+		if err != nil && err != database.ErrDraftNotFound {
+			app.errorLog.Printf("Failed to get draft %d: %v", draftID, err)
+		}
+	}
+
+	// Сохраняем изображения до создания поста; если пост не создастся,
+	// загрузки останутся непривязанными и их удалит сборщик
+	var attachmentIDs []int
+	if formErr == nil {
+		attachmentIDs, formErr = app.saveUploads(r, user.ID)
+	}
+
+	var post *models.Post
+	err = formErr
+	if err == nil {
+		// Передаем categoryIDs в CreatePost
+		media := &database.PostMedia{Tags: tagNames, AttachmentIDs: attachmentIDs}
+		post, err = app.PostService.CreatePost(title, content, user.ID, categoryIDs, media, publishAt)
+	}
 	if err != nil {
 		data := &HTMLData{
-			Title:       "Создать пост",
-			Path:        r.URL.Path,
-			FormError:   err.Error(),
-			CurrentUser: user,
-			Categories:  categories,
+			Title:          "Создать пост",
+			Path:           r.URL.Path,
+			FormError:      err.Error(),
+			CurrentUser:    user,
+			Categories:     categories,
+			PostCategories: selectCategories(categories, categoryIDs),
+			Draft:          draft,
 			FormData: map[string]string{
-				"title":   title,
-				"content": content,
+				"title":      title,
+				"content":    content,
+				"tags":       tagsValue,
+				"publish_at": publishAtValue,
 			},
 		}
 		app.RenderHTML(w, r, "create-post.page.html", data)
@@ -80,9 +159,17 @@ func (app *app) createPost(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	app.discardDraft(draft)
+
 	app.infoLog.Printf("Post created: ID=%d, Title=%q, Author=%q",
 		post.ID, post.Title, user.Username)
 
+	// Отложенного поста и поста на проверке нет в ленте, поэтому показываем его автору
+	if !post.Published {
+		http.Redirect(w, r, "/post/"+strconv.Itoa(post.ID), http.StatusSeeOther)
+		return
+	}
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -100,9 +187,14 @@ func (app *app) viewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := app.PostService.GetPost(id)
+	post, err := app.PostService.GetPost(id, app.getCurrentUser(r))
 	if err != nil {
 		if err == database.ErrPostNotFound {
+			// Пост объединён с другим: старый адрес ведёт на новое место обсуждения
+			if targetID, err := app.PostService.GetRedirect(id); err == nil {
+				http.Redirect(w, r, "/post/"+strconv.Itoa(targetID), http.StatusMovedPermanently)
+				return
+			}
 			app.NotFound(w)
 			return
 		}
@@ -110,13 +202,47 @@ func (app *app) viewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.renderPost(w, r, post, "")
+}
+
+// renderPost показывает страницу поста со всеми связанными данными;
+// formError выводится, например, при ошибке голосования в опросе
+func (app *app) renderPost(w http.ResponseWriter, r *http.Request, post *models.Post, formError string) {
+	user := app.getCurrentUser(r)
+
+	app.loadAttachments([]*models.Post{post})
+	app.loadTags([]*models.Post{post})
+	app.loadBookmarkCounts([]*models.Post{post})
+	app.loadAuthors([]*models.Post{post})
+	app.loadPoll(post, user)
+
+	if err := app.CategoryService.LoadAncestors(post.Categories); err != nil {
+		app.errorLog.Printf("Failed to get category ancestors of post %d: %v", post.ID, err)
+	}
+
 	data := &HTMLData{
 		Title:       post.Title,
 		Path:        r.URL.Path,
-		CurrentUser: app.getCurrentUser(r),
+		FormError:   formError,
+		CurrentUser: user,
 		Post:        post,
 	}
 
+	if user != nil {
+		subscribed, err := app.SubscriptionService.IsSubscribedToPost(user.ID, post.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to check subscription to post %d: %v", post.ID, err)
+		}
+		data.Subscribed = subscribed
+	}
+
+	app.loadBookmark(data)
+
+	// Автор и модераторы видят, что изменит правка на проверке
+	if user != nil && (user.ID == post.UserID || user.IsModerator()) {
+		data.PendingEdit = app.loadPendingEdit(post)
+	}
+
 	app.RenderHTML(w, r, "view-post.page.html", data)
 }
 
@@ -136,27 +262,33 @@ func (app *app) editPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := app.PostService.GetPost(id)
+	post, err := app.PostService.GetPost(id, user)
 	if err != nil {
 		app.NotFound(w)
 		return
 	}
 
-	// Проверяем, что пользователь - автор поста
-	if post.UserID != user.ID {
+	// Проверяем, что пользователь - автор поста или модератор
+	if post.UserID != user.ID && !user.IsModerator() {
 		app.Forbidden(w)
 		return
 	}
 
-	// Получаем все категории
+	app.loadAttachments([]*models.Post{post})
+	app.loadTags([]*models.Post{post})
+
+	// Получаем категории, в которых пользователь может публиковать
 	allCategories, err := app.CategoryService.GetAllCategories()
+	if err == nil {
+		allCategories, err = app.CategoryService.FilterCategories(user.ID, allCategories, models.CategoryPost)
+	}
 	if err != nil {
 		app.errorLog.Printf("Failed to get categories: %v", err)
 		allCategories = []*models.Category{}
 	}
 
 	// Получаем категории поста
-	postCategories, err := app.CategoryService.GetPostCategories(id)
+	postCategories, err := app.CategoryService.GetPostCategories(id, user.ID)
 	if err != nil {
 		app.errorLog.Printf("Failed to get post categories: %v", err)
 		postCategories = []*models.Category{}
@@ -173,12 +305,41 @@ func (app *app) editPost(w http.ResponseWriter, r *http.Request) {
 			FormData: map[string]string{
 				"title":   post.Title,
 				"content": post.Content,
+				"tags":    tagsInput(post.Tags),
 			},
 		}
+
+		// Правку на проверке продолжают с её текста: новое сохранение заменит её
+		if edit := app.loadPendingEdit(post); edit != nil {
+			data.PendingEdit = edit
+			data.FormData["title"] = edit.Title
+			data.FormData["content"] = edit.Content
+			data.FormData["tags"] = strings.Join(edit.Tags, ", ")
+			data.PostCategories = selectCategories(allCategories, edit.CategoryIDs)
+		}
+
+		// Несохранённая правка восстанавливается из черновика
+		draft, err := app.DraftService.GetPostDraft(user.ID, id)
+		if err == nil {
+			data.Draft = draft
+			data.FormData = draftFormData(draft)
+			data.PostCategories = selectCategories(allCategories, draft.CategoryIDs)
+		} else if err != database.ErrDraftNotFound {
+			app.errorLog.Printf("Failed to get draft of post %d: %v", id, err)
+		}
+
 		app.RenderHTML(w, r, "edit-post.page.html", data)
 		return
 	}
 
+	// Форма может содержать изображения (multipart). Слишком большие
+	// загрузки показываем в форме, повреждённое тело - ошибка запроса
+	formErr := app.parsePostForm(w, r)
+	if formErr != nil && formErr != database.ErrAttachmentTooLarge {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
 	title := strings.TrimSpace(r.FormValue("title"))
 	content := strings.TrimSpace(r.FormValue("content"))
 	selectedCategories := r.Form["categories"]
@@ -192,7 +353,58 @@ func (app *app) editPost(w http.ResponseWriter, r *http.Request) {
 		categoryIDs = append(categoryIDs, categoryID)
 	}
 
-	err = app.PostService.UpdatePost(id, title, content, categoryIDs, user.ID)
+	version, err := strconv.Atoi(r.FormValue("version"))
+	if err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	tagsValue, tagNames, tagsErr := app.parseTags(r)
+	if formErr == nil {
+		formErr = tagsErr
+	}
+
+	var attachmentIDs []int
+	if formErr == nil {
+		attachmentIDs, formErr = app.saveUploads(r, user.ID)
+	}
+
+	// Новые загрузки правки на проверке остаются в форме отмеченными
+	attachmentIDs = append(attachmentIDs, formIDs(r.Form["pending_attachments"])...)
+
+	err = formErr
+	if err == nil {
+		media := &database.PostMedia{
+			Tags:                 tagNames,
+			AttachmentIDs:        attachmentIDs,
+			RemovedAttachmentIDs: formIDs(r.Form["remove_attachments"]),
+		}
+		err = app.PostService.UpdatePost(id, title, content, categoryIDs, media, user.ID, version)
+	}
+
+	// Пост изменили, пока пользователь редактировал: показываем обе версии
+	var conflict *database.PostConflictError
+	if errors.As(err, &conflict) {
+		app.loadAttachments([]*models.Post{conflict.Current})
+		data := &HTMLData{
+			Title:          "Редактировать пост",
+			Path:           r.URL.Path,
+			FormError:      err.Error(),
+			CurrentUser:    user,
+			Post:           conflict.Current,
+			ConflictPost:   conflict.Current,
+			Categories:     allCategories,
+			PostCategories: selectCategories(allCategories, categoryIDs),
+			FormData: map[string]string{
+				"title":   title,
+				"content": content,
+				"tags":    tagsValue,
+			},
+		}
+		app.RenderHTML(w, r, "edit-post.page.html", data)
+		return
+	}
+
 	if err != nil {
 		data := &HTMLData{
 			Title:          "Редактировать пост",
@@ -205,28 +417,15 @@ func (app *app) editPost(w http.ResponseWriter, r *http.Request) {
 			FormData: map[string]string{
 				"title":   title,
 				"content": content,
+				"tags":    tagsValue,
 			},
 		}
 		app.RenderHTML(w, r, "edit-post.page.html", data)
 		return
 	}
 
-	// Удаляем все старые связи с категориями
-	for _, category := range postCategories {
-		app.CategoryService.RemovePostFromCategory(id, category.ID)
-	}
-
-	// Добавляем новые связи
-	for _, categoryIDStr := range selectedCategories {
-		categoryID, err := strconv.Atoi(categoryIDStr)
-		if err != nil {
-			continue
-		}
-
-		if err := app.CategoryService.AssignPostToCategory(id, categoryID); err != nil {
-			app.errorLog.Printf("Failed to assign post %d to category %d: %v",
-				id, categoryID, err)
-		}
+	if draft, err := app.DraftService.GetPostDraft(user.ID, id); err == nil {
+		app.discardDraft(draft)
 	}
 
 	app.infoLog.Printf("Post updated: ID=%d, Title=%q, Author=%q",
@@ -235,6 +434,29 @@ func (app *app) editPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/post/"+strconv.Itoa(id), http.StatusSeeOther)
 }
 
+// previewPost возвращает HTML-предпросмотр Markdown для форм создания и редактирования
+func (app *app) previewPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		app.ClientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	html, err := markdown.Render(r.FormValue("content"))
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
 // deletePost удаляет пост
 func (app *app) deletePost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -265,3 +487,60 @@ func (app *app) deletePost(w http.ResponseWriter, r *http.Request) {
 	app.infoLog.Printf("Post deleted: ID=%d, Author=%q", id, user.Username)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// draftFormData заполняет поля формы поста из черновика
+func draftFormData(draft *models.Draft) map[string]string {
+	return map[string]string{
+		"title":   draft.Title,
+		"content": draft.Content,
+		"tags":    draft.Tags,
+	}
+}
+
+// selectCategories возвращает категории из списка, ID которых выбраны в форме
+func selectCategories(categories []*models.Category, ids []int) []*models.Category {
+	var selected []*models.Category
+	for _, category := range categories {
+		for _, id := range ids {
+			if category.ID == id {
+				selected = append(selected, category)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// loadPendingEdit получает правку поста, ждущую проверки, вместе с её новыми
+// загрузками. nil - правки нет
+func (app *app) loadPendingEdit(post *models.Post) *models.PendingEdit {
+	if post.Review != models.ReviewEdit {
+		return nil
+	}
+
+	edit, err := app.PostService.GetPendingEdit(post.ID)
+	if err != nil {
+		if err != database.ErrNotInReview {
+			app.errorLog.Printf("Failed to get pending edit of post %d: %v", post.ID, err)
+		}
+		return nil
+	}
+
+	edit.Attachments, err = app.AttachmentService.GetAttachments(edit.AttachmentIDs)
+	if err != nil {
+		app.errorLog.Printf("Failed to get attachments of pending edit of post %d: %v", post.ID, err)
+	}
+
+	return edit
+}
+
+// formIDs разбирает ID из значений поля формы, пропуская нечисловые
+func formIDs(values []string) []int {
+	var ids []int
+	for _, value := range values {
+		if id, err := strconv.Atoi(value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
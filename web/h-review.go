@@ -0,0 +1,102 @@
+package web
+
+import (
+	"forum/internal/database"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// contentCheckLimit - сколько последних решений фильтра показывать
+const contentCheckLimit = 50
+
+// reviewActionPath разбирает /moderation/{post|comment}/{id}/{approve|reject}
+var reviewActionPath = regexp.MustCompile(`^/moderation/(post|comment)/(\d+)/(approve|reject)$`)
+
+// reviewQueue показывает модератору очередь проверки и журнал решений фильтра
+func (app *app) reviewQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	if !app.getCurrentUser(r).IsModerator() {
+		app.Forbidden(w)
+		return
+	}
+
+	app.renderReviewQueue(w, r, "")
+}
+
+// renderReviewQueue показывает очередь проверки с ошибкой формы formError
+func (app *app) renderReviewQueue(w http.ResponseWriter, r *http.Request, formError string) {
+	queue, err := app.ReviewService.GetQueue()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	checks, err := app.ReviewService.GetChecks(contentCheckLimit)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	data := &HTMLData{
+		Title:         "Проверка содержимого",
+		Path:          r.URL.Path,
+		CurrentUser:   app.getCurrentUser(r),
+		ReviewQueue:   queue,
+		ContentChecks: checks,
+		FormError:     formError,
+	}
+
+	app.RenderHTML(w, r, "review.page.html", data)
+}
+
+// reviewContent одобряет или отклоняет пост или комментарий из очереди проверки
+func (app *app) reviewContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	matches := reviewActionPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+	id, _ := strconv.Atoi(matches[2])
+
+	user := app.getCurrentUser(r)
+	if !user.IsModerator() {
+		app.Forbidden(w)
+		return
+	}
+
+	var err error
+	switch matches[1] + "/" + matches[3] {
+	case "post/approve":
+		err = app.ReviewService.ApprovePost(id, user.ID)
+	case "post/reject":
+		err = app.ReviewService.RejectPost(id, user.ID)
+	case "comment/approve":
+		err = app.ReviewService.ApproveComment(id, user.ID)
+	case "comment/reject":
+		err = app.ReviewService.RejectComment(id, user.ID)
+	}
+
+	if err != nil {
+		switch err {
+		case database.ErrPostNotFound, database.ErrCommentNotFound, database.ErrNotInReview:
+			app.renderReviewQueue(w, r, err.Error())
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	app.infoLog.Printf("Review %s %s: ID=%d, Moderator=%q", matches[1], matches[3], id, user.Username)
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
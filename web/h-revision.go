@@ -0,0 +1,261 @@
+package web
+
+import (
+	"errors"
+	"forum/internal/database"
+	"forum/internal/diff"
+	"forum/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// postHistory показывает историю правок поста и разницу между двумя версиями
+func (app *app) postHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/post/")
+	idStr = strings.TrimSuffix(idStr, "/history")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	post, err := app.PostService.GetPost(id, app.getCurrentUser(r))
+	if err != nil {
+		if err == database.ErrPostNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	revisions, err := app.RevisionService.GetPostRevisions(id)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	from, to := selectRevisions(r, revisions)
+
+	data := &HTMLData{
+		Title:        "История правок",
+		Path:         r.URL.Path,
+		CurrentUser:  app.getCurrentUser(r),
+		Post:         post,
+		Revisions:    revisions,
+		FromRevision: from,
+		ToRevision:   to,
+	}
+	if from != nil && to != nil {
+		var titleErr, contentErr error
+		data.TitleDiff, titleErr = diff.Lines(from.Title, to.Title)
+		data.Diff, contentErr = diff.Lines(from.Content, to.Content)
+		data.DiffTooLarge = titleErr == diff.ErrTooLarge || contentErr == diff.ErrTooLarge
+	}
+
+	app.RenderHTML(w, r, "history.page.html", data)
+}
+
+// rollbackPost откатывает пост к выбранной версии
+func (app *app) rollbackPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/post/")
+	idStr = strings.TrimSuffix(idStr, "/rollback")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	revisionID, err := strconv.Atoi(r.FormValue("revision_id"))
+	if err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	version, err := strconv.Atoi(r.FormValue("version"))
+	if err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	err = app.PostService.RollbackPost(id, revisionID, user.ID, version)
+	if err != nil {
+		// Пост изменился после открытия истории - показываем историю заново
+		var conflict *database.PostConflictError
+		if errors.As(err, &conflict) {
+			http.Redirect(w, r, "/post/"+strconv.Itoa(id)+"/history", http.StatusSeeOther)
+			return
+		}
+
+		switch err {
+		case database.ErrRevisionNotFound, database.ErrPostNotFound:
+			app.NotFound(w)
+		case database.ErrNotPostEditor:
+			app.Forbidden(w)
+		case database.ErrContentRejected:
+			app.ClientError(w, http.StatusBadRequest)
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	app.infoLog.Printf("Post rolled back: ID=%d, Revision=%d, Editor=%q", id, revisionID, user.Username)
+
+	http.Redirect(w, r, "/post/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+// commentHistory показывает историю правок комментария
+func (app *app) commentHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/comment/")
+	idStr = strings.TrimSuffix(idStr, "/history")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	comment, err := app.CommentService.GetComment(id)
+	if err != nil {
+		if err == database.ErrCommentNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	if !comment.VisibleTo(app.getCurrentUser(r)) {
+		app.NotFound(w)
+		return
+	}
+
+	// История комментария видна только тем, кому виден его пост
+	if _, err := app.PostService.GetPost(comment.PostID, app.getCurrentUser(r)); err != nil {
+		if err == database.ErrPostNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	revisions, err := app.RevisionService.GetCommentRevisions(id)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	from, to := selectRevisions(r, revisions)
+
+	data := &HTMLData{
+		Title:        "История правок",
+		Path:         r.URL.Path,
+		CurrentUser:  app.getCurrentUser(r),
+		Comment:      comment,
+		Revisions:    revisions,
+		FromRevision: from,
+		ToRevision:   to,
+	}
+	if from != nil && to != nil {
+		var err error
+		data.Diff, err = diff.Lines(from.Content, to.Content)
+		data.DiffTooLarge = err == diff.ErrTooLarge
+	}
+
+	app.RenderHTML(w, r, "history.page.html", data)
+}
+
+// rollbackComment откатывает комментарий к выбранной версии
+func (app *app) rollbackComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/comment/")
+	idStr = strings.TrimSuffix(idStr, "/rollback")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	revisionID, err := strconv.Atoi(r.FormValue("revision_id"))
+	if err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	err = app.CommentService.RollbackComment(id, revisionID, user.ID)
+	if err != nil {
+		switch err {
+		case database.ErrRevisionNotFound, database.ErrCommentNotFound:
+			app.NotFound(w)
+		case database.ErrNotCommentEditor:
+			app.Forbidden(w)
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	app.infoLog.Printf("Comment rolled back: ID=%d, Revision=%d, Editor=%q", id, revisionID, user.Username)
+
+	http.Redirect(w, r, "/comment/"+strconv.Itoa(id)+"/history", http.StatusSeeOther)
+}
+
+// selectRevisions выбирает пару версий для сравнения из параметров from и to.
+// По умолчанию сравниваются две последние версии.
+func selectRevisions(r *http.Request, revisions []*models.Revision) (*models.Revision, *models.Revision) {
+	if len(revisions) == 0 {
+		return nil, nil
+	}
+
+	find := func(param string) *models.Revision {
+		id, err := strconv.Atoi(r.URL.Query().Get(param))
+		if err != nil {
+			return nil
+		}
+		for _, revision := range revisions {
+			if revision.ID == id {
+				return revision
+			}
+		}
+		return nil
+	}
+
+	// Версии отсортированы от новой к старой
+	from, to := find("from"), find("to")
+	if to == nil {
+		to = revisions[0]
+	}
+	if from == nil {
+		from = revisions[len(revisions)-1]
+		if len(revisions) > 1 {
+			from = revisions[1]
+		}
+	}
+
+	return from, to
+}
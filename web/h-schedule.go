@@ -0,0 +1,100 @@
+package web
+
+import (
+	"errors"
+	"forum/internal/database"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// publishCheckInterval - как часто планировщик ищет посты, время публикации которых наступило
+const publishCheckInterval = time.Minute
+
+// schedulePostPath разбирает /post/{id}/schedule
+var schedulePostPath = regexp.MustCompile(`^/post/(\d+)/schedule$`)
+
+// schedulePost меняет расписание неопубликованного поста. Поле action:
+// schedule - перенести на publish_at, cancel - отменить расписание,
+// publish - опубликовать сейчас
+func (app *app) schedulePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	matches := schedulePostPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	id, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	post, err := app.PostService.GetPost(id, user)
+	if err != nil {
+		if err == database.ErrPostNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "publish":
+		err = app.PostService.PublishPost(post.ID, user.ID)
+	case "cancel":
+		err = app.PostService.SchedulePost(post.ID, user.ID, nil)
+	case "schedule":
+		var publishAt time.Time
+		publishAt, err = time.ParseInLocation(datetimeLocalLayout, r.FormValue("publish_at"), time.Local)
+		if err != nil {
+			err = errors.New("неверный формат времени публикации")
+			break
+		}
+		err = app.PostService.SchedulePost(post.ID, user.ID, &publishAt)
+	default:
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case err == database.ErrNotPostEditor:
+			app.Forbidden(w)
+		case errors.Is(err, database.ErrPostUpdateFailed):
+			app.ServerError(w, err)
+		default:
+			app.renderPost(w, r, post, err.Error())
+		}
+		return
+	}
+
+	app.infoLog.Printf("Post schedule changed: ID=%d, Action=%q, Editor=%q",
+		post.ID, r.FormValue("action"), user.Username)
+	http.Redirect(w, r, "/post/"+strconv.Itoa(post.ID), http.StatusSeeOther)
+}
+
+// publishScheduledPosts периодически публикует отложенные посты
+func (app *app) publishScheduledPosts() {
+	ticker := time.NewTicker(publishCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		published, err := app.PostService.PublishDuePosts()
+		if err != nil {
+			app.errorLog.Printf("Failed to publish scheduled posts: %v", err)
+		} else if published > 0 {
+			app.infoLog.Printf("Scheduled posts published: %d", published)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// subscriptionPostPath разбирает /post/{id}/subscribe и /post/{id}/unsubscribe
+	subscriptionPostPath = regexp.MustCompile(`^/post/(\d+)/(subscribe|unsubscribe)$`)
+	// subscriptionCategoryPath разбирает /category/{slug}/subscribe и /category/{slug}/unsubscribe
+	subscriptionCategoryPath = regexp.MustCompile(`^/category/([a-z0-9-]+)/(subscribe|unsubscribe)$`)
+)
+
+// postSubscription подписывает на комментарии поста или отписывает от них
+func (app *app) postSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	matches := subscriptionPostPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	postID, err := strconv.Atoi(matches[1])
+	if err != nil {
+		app.NotFound(w)
+		return
+	}
+
+	if _, err := app.PostService.GetPost(postID, user); err != nil {
+		if err == database.ErrPostNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	if matches[2] == "subscribe" {
+		err = app.SubscriptionService.SubscribePost(user.ID, postID)
+	} else {
+		err = app.SubscriptionService.UnsubscribePost(user.ID, postID)
+	}
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.redirectBack(w, r, "/post/"+strconv.Itoa(postID))
+}
+
+// categorySubscription подписывает на новые посты категории или отписывает от них
+func (app *app) categorySubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	matches := subscriptionCategoryPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	category, err := app.CategoryService.GetCategoryBySlug(matches[1])
+	if err != nil {
+		if err == database.ErrCategoryNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	allowed, err := app.CategoryService.CanAccess(user.ID, category.ID, models.CategoryView)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if !allowed {
+		app.NotFound(w)
+		return
+	}
+
+	if matches[2] == "subscribe" {
+		err = app.SubscriptionService.SubscribeCategory(user.ID, category.ID)
+	} else {
+		err = app.SubscriptionService.UnsubscribeCategory(user.ID, category.ID)
+	}
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.redirectBack(w, r, "/category/"+category.Slug)
+}
+
+// redirectBack возвращает на страницу из поля next (например, в профиль),
+// иначе на fallback. Принимаются только локальные пути
+func (app *app) redirectBack(w http.ResponseWriter, r *http.Request, fallback string) {
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = fallback
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
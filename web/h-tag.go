@@ -0,0 +1,116 @@
+package web
+
+import (
+	"encoding/json"
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// viewTag - просмотр постов с тегом
+func (app *app) viewTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/tag/")
+
+	tag, err := app.TagService.GetTagByName(name)
+	if err != nil {
+		if err == database.ErrTagNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	// Синоним ведёт на канонический тег
+	if tag.Name != name {
+		http.Redirect(w, r, "/tag/"+url.PathEscape(tag.Name), http.StatusMovedPermanently)
+		return
+	}
+
+	before, err := database.ParseFeedCursor(r.URL.Query().Get("before"))
+	if err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	posts, err := app.TagService.GetTagPosts(tag.ID, 0, app.currentUserID(r), before, postsPerPage+1)
+	if err != nil {
+		app.errorLog.Printf("Failed to get tag posts: %v", err)
+		posts = []*models.Post{}
+	}
+	posts, nextCursor := feedPage(posts)
+
+	app.loadAttachments(posts)
+	app.loadTags(posts)
+	app.loadBookmarkCounts(posts)
+	app.loadAuthors(posts)
+
+	data := &HTMLData{
+		Title:       "#" + tag.Name,
+		Path:        r.URL.Path,
+		CurrentUser: app.getCurrentUser(r),
+		Tag:         tag,
+		Posts:       posts,
+		NextCursor:  nextCursor,
+		FirstPage:   before == nil,
+	}
+
+	app.RenderHTML(w, r, "tag.page.html", data)
+}
+
+// suggestTags отдаёт JSON со списком тегов по префиксу для автодополнения
+func (app *app) suggestTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	tags, err := app.TagService.SuggestTags(r.URL.Query().Get("q"), app.currentUserID(r), 10)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	names := []string{}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// loadTags загружает теги для списка постов
+func (app *app) loadTags(posts []*models.Post) {
+	for _, post := range posts {
+		tags, err := app.TagService.GetPostTags(post.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to get tags for post %d: %v", post.ID, err)
+			continue
+		}
+		post.Tags = tags
+	}
+}
+
+// parseTags разбирает поле tags формы. Пустая строка означает отсутствие тегов
+func (app *app) parseTags(r *http.Request) (string, []string, error) {
+	input := strings.TrimSpace(r.FormValue("tags"))
+	names, err := app.TagService.ParseTags(input)
+	return input, names, err
+}
+
+// tagsInput собирает теги поста в строку для поля формы
+func tagsInput(tags []*models.Tag) string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// threadPostPath разбирает /post/{id}/moderate, /move, /merge и /split
+var threadPostPath = regexp.MustCompile(`^/post/(\d+)/(moderate|move|merge|split)$`)
+
+// moderatePost показывает модератору формы переноса, объединения и разделения
+// темы (GET /post/{id}/moderate) и выполняет их (POST /post/{id}/move, /merge, /split)
+func (app *app) moderatePost(w http.ResponseWriter, r *http.Request) {
+	matches := threadPostPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+	id, _ := strconv.Atoi(matches[1])
+	action := matches[2]
+
+	if action == "moderate" && r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+	if action != "moderate" && r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+	if !user.IsModerator() {
+		app.Forbidden(w)
+		return
+	}
+
+	post, err := app.PostService.GetPost(id, user)
+	if err != nil {
+		if err == database.ErrPostNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	if action == "moderate" {
+		app.renderModeratePost(w, r, post, "", nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		app.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	categoryIDs := formCategoryIDs(r)
+
+	redirectID := post.ID
+	switch action {
+	case "move":
+		err = app.PostService.MovePost(post.ID, categoryIDs, user.ID)
+	case "merge":
+		var targetID int
+		if targetID, err = strconv.Atoi(r.FormValue("target_id")); err != nil {
+			app.renderModeratePost(w, r, post, "Укажите номер поста, с которым нужно объединить этот", nil)
+			return
+		}
+		err = app.PostService.MergePost(post.ID, targetID, user.ID)
+		redirectID = targetID
+	case "split":
+		var commentIDs []int
+		for _, value := range r.Form["comment_id"] {
+			commentID, err := strconv.Atoi(value)
+			if err != nil {
+				app.ClientError(w, http.StatusBadRequest)
+				return
+			}
+			commentIDs = append(commentIDs, commentID)
+		}
+		var newPost *models.Post
+		if newPost, err = app.PostService.SplitPost(post.ID, commentIDs, r.FormValue("title"), categoryIDs, user.ID); err == nil {
+			redirectID = newPost.ID
+		}
+	}
+
+	if err != nil {
+		switch err {
+		case database.ErrPostNotFound, database.ErrCategoryNotFound, database.ErrCommentNotFound,
+			database.ErrMergeIntoItself, database.ErrNoCommentsToSplit, database.ErrEmptyTitle,
+			database.ErrLongTitle, database.ErrEmptyContent, database.ErrLongContent:
+			app.renderModeratePost(w, r, post, err.Error(), map[string]string{
+				"target_id": r.FormValue("target_id"),
+				"title":     r.FormValue("title"),
+			})
+		default:
+			app.ServerError(w, err)
+		}
+		return
+	}
+
+	app.infoLog.Printf("Thread %s: Post=%d, Result=%d, Moderator=%q", action, post.ID, redirectID, user.Username)
+
+	http.Redirect(w, r, "/post/"+strconv.Itoa(redirectID), http.StatusSeeOther)
+}
+
+// renderModeratePost показывает страницу модерации темы
+func (app *app) renderModeratePost(w http.ResponseWriter, r *http.Request, post *models.Post, formError string,
+	formData map[string]string) {
+	user := app.getCurrentUser(r)
+
+	categories, err := app.CategoryService.GetAllCategories()
+	if err == nil {
+		categories, err = app.CategoryService.FilterCategories(user.ID, categories, models.CategoryView)
+	}
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	comments, err := app.CommentService.GetPostComments(post.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	var categoryIDs []int
+	for _, category := range post.Categories {
+		categoryIDs = append(categoryIDs, category.ID)
+	}
+
+	data := &HTMLData{
+		Title:          "Модерация темы",
+		Path:           r.URL.Path,
+		CurrentUser:    user,
+		Post:           post,
+		Categories:     categories,
+		PostCategories: selectCategories(categories, categoryIDs),
+		Comments:       comments,
+		FormError:      formError,
+		FormData:       formData,
+	}
+
+	app.RenderHTML(w, r, "moderate-post.page.html", data)
+}
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"encoding/json"
+	"forum/internal/database"
+	"forum/internal/models"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// followUserPath разбирает /user/{username}/follow и /user/{username}/unfollow
+var followUserPath = regexp.MustCompile(`^/user/([^/]+)/(follow|unfollow)$`)
+
+// recentActivityLimit - сколько последних постов, комментариев и лайков
+// показывает публичная страница пользователя
+const recentActivityLimit = 10
+
+// reputationRecomputeHour - час ночного пересчёта репутации по местному времени
+const reputationRecomputeHour = 3
+
+// viewUser - публичная страница пользователя. Email на ней не показывается никогда:
+// GetUserByUsername его даже не загружает
+func (app *app) viewUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	username := strings.TrimPrefix(r.URL.Path, "/user/")
+
+	profileUser, err := app.UserService.GetUserByUsername(username)
+	if err != nil {
+		if err == database.ErrUserNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	// Посты из закрытых категорий видны только тем, кому они доступны
+	viewerID := app.currentUserID(r)
+
+	posts, err := app.PostService.GetUserPosts(profileUser.ID, viewerID, recentActivityLimit)
+	if err != nil {
+		app.errorLog.Printf("Failed to get posts of user %d: %v", profileUser.ID, err)
+		posts = []*models.Post{}
+	}
+
+	app.loadAttachments(posts)
+	app.loadTags(posts)
+	app.loadBookmarkCounts(posts)
+	app.loadAuthors(posts)
+
+	comments, err := app.CommentService.GetUserComments(profileUser.ID, viewerID, recentActivityLimit)
+	if err != nil {
+		app.errorLog.Printf("Failed to get comments of user %d: %v", profileUser.ID, err)
+	}
+
+	data := &HTMLData{
+		Title:       profileUser.Username,
+		Path:        r.URL.Path,
+		CurrentUser: app.getCurrentUser(r),
+		ProfileUser: profileUser,
+		Posts:       posts,
+		Comments:    comments,
+	}
+
+	if data.PostCount, err = app.PostService.CountUserPosts(profileUser.ID, viewerID); err != nil {
+		app.errorLog.Printf("Failed to count posts of user %d: %v", profileUser.ID, err)
+	}
+	if data.CommentCount, err = app.CommentService.CountUserComments(profileUser.ID); err != nil {
+		app.errorLog.Printf("Failed to count comments of user %d: %v", profileUser.ID, err)
+	}
+
+	if profileUser.LikesPublic {
+		liked, err := app.LikeService.GetUserLikedPosts(profileUser.ID, viewerID, recentActivityLimit)
+		if err != nil {
+			app.errorLog.Printf("Failed to get liked posts of user %d: %v", profileUser.ID, err)
+		}
+		data.LikedPosts = liked
+	}
+
+	if data.Badges, err = app.BadgeService.GetUserBadges(profileUser.ID); err != nil {
+		app.errorLog.Printf("Failed to get badges of user %d: %v", profileUser.ID, err)
+	}
+	if data.CurrentUser.IsAdmin() {
+		data.ManualBadges = app.BadgeService.ManualBadges()
+	}
+	if data.Groups, err = app.GroupService.GetUserGroups(profileUser.ID); err != nil {
+		app.errorLog.Printf("Failed to get groups of user %d: %v", profileUser.ID, err)
+	}
+
+	data.Followers, data.Following, err = app.FollowService.CountFollows(profileUser.ID)
+	if err != nil {
+		app.errorLog.Printf("Failed to count follows of user %d: %v", profileUser.ID, err)
+	}
+
+	if data.CurrentUser != nil && data.CurrentUser.ID != profileUser.ID {
+		data.Subscribed, err = app.FollowService.IsFollowing(data.CurrentUser.ID, profileUser.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to check follow of user %d: %v", profileUser.ID, err)
+		}
+
+		data.Blocked, err = app.MessageService.IsBlocked(data.CurrentUser.ID, profileUser.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to check block of user %d: %v", profileUser.ID, err)
+		}
+	}
+
+	app.RenderHTML(w, r, "user.page.html", data)
+}
+
+// followUser подписывает текущего пользователя на посты другого или отписывает от них
+func (app *app) followUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	matches := followUserPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		app.NotFound(w)
+		return
+	}
+
+	followee, err := app.UserService.GetUserByUsername(matches[1])
+	if err != nil {
+		if err == database.ErrUserNotFound {
+			app.NotFound(w)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	if matches[2] == "follow" {
+		err = app.FollowService.Follow(user.ID, followee.ID)
+	} else {
+		err = app.FollowService.Unfollow(user.ID, followee.ID)
+	}
+	if err != nil {
+		if err == database.ErrFollowSelf {
+			app.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		app.ServerError(w, err)
+		return
+	}
+
+	app.redirectBack(w, r, "/user/"+followee.Username)
+}
+
+// likesVisibility открывает или скрывает лайкнутые посты на публичной странице текущего пользователя
+func (app *app) likesVisibility(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	user := app.getCurrentUser(r)
+
+	if err := app.UserService.SetLikesPublic(user.ID, r.FormValue("public") == "1"); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// suggestUsernames отдаёт JSON со списком имён по префиксу для @упоминаний
+func (app *app) suggestUsernames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+
+	usernames, err := app.UserService.SuggestUsernames(r.URL.Query().Get("q"), 10)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	if usernames == nil {
+		usernames = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usernames)
+}
+
+// recomputeReputation пересчитывает репутацию при запуске и затем каждую ночь,
+// исправляя расхождения, накопившиеся при инкрементальных обновлениях
+func (app *app) recomputeReputation() {
+	for {
+		changed, err := app.LikeService.RecomputeReputation()
+		if err != nil {
+			app.errorLog.Printf("Failed to recompute reputation: %v", err)
+		} else if changed > 0 {
+			app.infoLog.Printf("Reputation corrected for users: %d", changed)
+		}
+
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), reputationRecomputeHour, 0, 0, 0, time.Local)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		time.Sleep(time.Until(next))
+	}
+}
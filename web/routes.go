@@ -10,6 +10,8 @@ func (app *app) routes() http.Handler {
 
 	fileServer := http.FileServer(http.Dir(*app.StaticDir))
 	mux.Handle("/static/", http.StripPrefix("/static", fileServer))
+	mux.HandleFunc("/uploads/", app.serveAttachment)
+	mux.HandleFunc("/avatar/", app.serveAvatar)
 
 	mux.HandleFunc("/", app.home)
 
@@ -20,15 +22,55 @@ func (app *app) routes() http.Handler {
 	// Маршруты только для авторизованных пользователей
 	mux.HandleFunc("/logout", app.requireAuth(app.logout))
 	mux.HandleFunc("/profile", app.requireAuth(app.profile))
+	mux.HandleFunc("/profile/likes", app.requireAuth(app.likesVisibility))
+	mux.HandleFunc("/profile/avatar", app.requireAuth(app.uploadAvatar))
+	mux.HandleFunc("/profile/avatar/delete", app.requireAuth(app.uploadAvatar))
 
 	mux.HandleFunc("/post/create", app.requireAuth(app.createPost))
 	mux.HandleFunc("/post/delete", app.requireAuth(app.deletePost))
+	mux.HandleFunc("/post/preview", app.requireAuth(app.previewPost))
 	mux.HandleFunc("/post/", app.handlePostRoutes)
 
+	mux.HandleFunc("/comment/", app.handleCommentRoutes)
+
 	mux.HandleFunc("/categories", app.categories)
 	mux.HandleFunc("/category/", app.handleCategoryRoutes)
 
-	return mux
+	mux.HandleFunc("/moderation", app.requireAuth(app.reviewQueue))
+	mux.HandleFunc("/moderation/", app.requireAuth(app.reviewContent))
+
+	mux.HandleFunc("/groups", app.groups)
+	mux.HandleFunc("/groups/create", app.requireAuth(app.createGroup))
+	mux.HandleFunc("/groups/join", app.requireAuth(app.joinGroup))
+	mux.HandleFunc("/group/", app.handleGroupRoutes)
+
+	mux.HandleFunc("/notifications", app.requireAuth(app.notifications))
+	mux.HandleFunc("/notifications/read", app.requireAuth(app.markNotificationsRead))
+	mux.HandleFunc("/notifications/read-all", app.requireAuth(app.markAllNotificationsRead))
+	mux.HandleFunc("/notifications/settings", app.requireAuth(app.notificationSettings))
+
+	mux.HandleFunc("/drafts", app.requireAuth(app.drafts))
+	// Автосохранение само отвечает 401 вместо перенаправления на /login
+	mux.HandleFunc("/drafts/autosave", app.autosaveDraft)
+	mux.HandleFunc("/drafts/", app.requireAuth(app.deleteDraft))
+
+	mux.HandleFunc("/messages", app.requireAuth(app.messages))
+	mux.HandleFunc("/messages/new", app.requireAuth(app.newConversation))
+	mux.HandleFunc("/messages/block", app.requireAuth(app.blockUser))
+	mux.HandleFunc("/messages/unblock", app.requireAuth(app.blockUser))
+	mux.HandleFunc("/messages/", app.requireAuth(app.conversation))
+
+	mux.HandleFunc("/saved", app.requireAuth(app.saved))
+	mux.HandleFunc("/saved/folders", app.requireAuth(app.createBookmarkFolder))
+	mux.HandleFunc("/saved/folders/", app.requireAuth(app.bookmarkFolder))
+
+	mux.HandleFunc("/user/", app.handleUserRoutes)
+	mux.HandleFunc("/users/suggest", app.suggestUsernames)
+
+	mux.HandleFunc("/tag/", app.viewTag)
+	mux.HandleFunc("/tags/suggest", app.suggestTags)
+
+	return app.secureHeaders(mux)
 }
 
 // handlePostRoutes обрабатывает динамические маршруты постов
@@ -47,6 +89,79 @@ func (app *app) handlePostRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /post/{id}/history
+	if matches := regexp.MustCompile(`^/post/(\d+)/history$`).FindStringSubmatch(path); matches != nil {
+		app.postHistory(w, r)
+		return
+	}
+
+	// /post/{id}/rollback
+	if matches := regexp.MustCompile(`^/post/(\d+)/rollback$`).FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.rollbackPost)(w, r)
+		return
+	}
+
+	// /post/{id}/poll
+	if matches := regexp.MustCompile(`^/post/(\d+)/poll$`).FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.createPoll)(w, r)
+		return
+	}
+
+	// /post/{id}/poll/vote
+	if matches := regexp.MustCompile(`^/post/(\d+)/poll/vote$`).FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.votePoll)(w, r)
+		return
+	}
+
+	// /post/{id}/poll.json
+	if matches := regexp.MustCompile(`^/post/(\d+)/poll\.json$`).FindStringSubmatch(path); matches != nil {
+		app.pollResults(w, r)
+		return
+	}
+
+	// /post/{id}/schedule
+	if matches := schedulePostPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.schedulePost)(w, r)
+		return
+	}
+
+	// /post/{id}/bookmark, /post/{id}/bookmark/edit
+	if matches := bookmarkPostPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.bookmarkPost)(w, r)
+		return
+	}
+
+	// /post/{id}/moderate, /move, /merge, /split
+	if matches := threadPostPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.moderatePost)(w, r)
+		return
+	}
+
+	// /post/{id}/subscribe, /post/{id}/unsubscribe
+	if matches := subscriptionPostPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.postSubscription)(w, r)
+		return
+	}
+
+	app.NotFound(w)
+}
+
+// handleCommentRoutes обрабатывает динамические маршруты комментариев
+func (app *app) handleCommentRoutes(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	// /comment/{id}/history
+	if matches := regexp.MustCompile(`^/comment/(\d+)/history$`).FindStringSubmatch(path); matches != nil {
+		app.commentHistory(w, r)
+		return
+	}
+
+	// /comment/{id}/rollback
+	if matches := regexp.MustCompile(`^/comment/(\d+)/rollback$`).FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.rollbackComment)(w, r)
+		return
+	}
+
 	app.NotFound(w)
 }
 
@@ -60,6 +175,62 @@ func (app *app) handleCategoryRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /category/{slug}/subscribe, /category/{slug}/unsubscribe
+	if matches := subscriptionCategoryPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.categorySubscription)(w, r)
+		return
+	}
+
+	// /category/{slug}/permissions
+	if matches := categoryPermissionsPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.categoryPermissions)(w, r)
+		return
+	}
+
+	app.NotFound(w)
+}
+
+// handleGroupRoutes обрабатывает динамические маршруты групп
+func (app *app) handleGroupRoutes(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	// /group/{slug}
+	if matches := regexp.MustCompile(`^/group/([a-z0-9-]+)$`).FindStringSubmatch(path); matches != nil {
+		app.viewGroup(w, r)
+		return
+	}
+
+	// /group/{slug}/add, /remove, /leave, /invite, /owner, /delete
+	if matches := groupActionPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.manageGroup)(w, r)
+		return
+	}
+
+	app.NotFound(w)
+}
+
+// handleUserRoutes обрабатывает динамические маршруты пользователей
+func (app *app) handleUserRoutes(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	// /user/{username}
+	if matches := regexp.MustCompile(`^/user/([^/]+)$`).FindStringSubmatch(path); matches != nil {
+		app.viewUser(w, r)
+		return
+	}
+
+	// /user/{username}/badges/award, /user/{username}/badges/revoke
+	if matches := userBadgePath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.manageBadge)(w, r)
+		return
+	}
+
+	// /user/{username}/follow, /user/{username}/unfollow
+	if matches := followUserPath.FindStringSubmatch(path); matches != nil {
+		app.requireAuth(app.followUser)(w, r)
+		return
+	}
+
 	app.NotFound(w)
 }
 
@@ -0,0 +1,404 @@
+package web
+
+import (
+	"database/sql"
+	"forum/internal/database"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// xssPayload подставляется во все поля, которые вводят пользователи
+const xssPayload = `<script>alert(1)</script>`
+
+// newTestServer поднимает приложение на временной базе со схемой из forum.sql
+func newTestServer(t *testing.T) (*httptest.Server, *database.Database) {
+	t.Helper()
+
+	dir := t.TempDir()
+	dbConn, err := sql.Open("sqlite3", filepath.Join(dir, "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbConn.Close() })
+
+	db := &database.Database{DBConn: dbConn}
+	if _, err := db.Migrate("../forum.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	htmlDir := "../ui/html"
+	staticDir := "../ui/static"
+	app := &app{
+		infoLog:             log.New(io.Discard, "", 0),
+		errorLog:            log.New(io.Discard, "", 0),
+		HTMLDir:             &htmlDir,
+		StaticDir:           &staticDir,
+		Database:            db,
+		UserService:         database.NewUserService(db),
+		SessionService:      database.NewSessionService(db),
+		PostService:         database.NewPostService(db),
+		CategoryService:     database.NewCategoryService(db),
+		CommentService:      database.NewCommentService(db),
+		RevisionService:     database.NewRevisionService(db),
+		AttachmentService:   database.NewAttachmentService(db, filepath.Join(dir, "uploads"), 1<<20),
+		TagService:          database.NewTagService(db, nil),
+		PollService:         database.NewPollService(db),
+		NotificationService: database.NewNotificationService(db),
+		SubscriptionService: database.NewSubscriptionService(db),
+		BookmarkService:     database.NewBookmarkService(db),
+		DraftService:        database.NewDraftService(db),
+		MessageService:      database.NewMessageService(db),
+		FollowService:       database.NewFollowService(db),
+		LikeService:         database.NewLikeService(db, database.DefaultReputationWeights),
+		AvatarService:       database.NewAvatarService(db, filepath.Join(dir, "avatars"), 1<<20),
+		BadgeService:        database.NewBadgeService(db),
+		GroupService:        database.NewGroupService(db),
+		ReviewService:       database.NewReviewService(db),
+	}
+
+	srv := httptest.NewServer(app.routes())
+	t.Cleanup(srv.Close)
+	return srv, db
+}
+
+// newTestClient возвращает клиента, который хранит cookie сессии
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// fetch выполняет запрос и возвращает ответ с прочитанным телом
+func fetch(t *testing.T, client *http.Client, method, target string, form url.Values) (*http.Response, string) {
+	t.Helper()
+
+	var resp *http.Response
+	var err error
+	if method == http.MethodPost {
+		resp, err = client.PostForm(target, form)
+	} else {
+		resp, err = client.Get(target)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// registerTestUser регистрирует пользователя и оставляет клиента в его сессии
+func registerTestUser(t *testing.T, client *http.Client, srv *httptest.Server, username string) {
+	t.Helper()
+
+	resp, _ := fetch(t, client, http.MethodPost, srv.URL+"/register", url.Values{
+		"username": {username},
+		"email":    {username + "@example.com"},
+		"password": {"password"},
+	})
+	if resp.Request.URL.Path != "/" {
+		t.Fatalf("registration of %s ended on %s", username, resp.Request.URL.Path)
+	}
+}
+
+// createTestPost создаёт пост от имени клиента и возвращает его адрес
+func createTestPost(t *testing.T, client *http.Client, srv *httptest.Server, db *database.Database, form url.Values) string {
+	t.Helper()
+
+	resp, _ := fetch(t, client, http.MethodPost, srv.URL+"/post/create", form)
+	if resp.Request.URL.Path != "/" {
+		t.Fatalf("post creation ended on %s", resp.Request.URL.Path)
+	}
+
+	var id string
+	if err := db.DBConn.QueryRow("SELECT MAX(id) FROM posts").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return "/post/" + id
+}
+
+// assertEscaped проверяет, что payload попал на страницу только экранированным
+func assertEscaped(t *testing.T, page, body string) {
+	t.Helper()
+
+	if strings.Contains(body, xssPayload) {
+		t.Errorf("%s: payload is not escaped", page)
+	}
+	if !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("%s: escaped payload not found", page)
+	}
+}
+
+// assertPagesEscaped открывает страницы клиентом и проверяет каждую assertEscaped
+func assertPagesEscaped(t *testing.T, client *http.Client, srv *httptest.Server, pages ...string) {
+	t.Helper()
+
+	for _, page := range pages {
+		resp, body := fetch(t, client, http.MethodGet, srv.URL+page, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d", page, resp.StatusCode)
+			continue
+		}
+		assertEscaped(t, page, body)
+	}
+}
+
+func TestUserInputIsEscaped(t *testing.T) {
+	srv, db := newTestServer(t)
+	client := newTestClient(t)
+
+	// Недопустимое имя возвращается в форму регистрации
+	_, body := fetch(t, client, http.MethodPost, srv.URL+"/register", url.Values{
+		"username": {xssPayload},
+		"email":    {"alice@example.com"},
+		"password": {"password"},
+	})
+	assertEscaped(t, "register form", body)
+
+	registerTestUser(t, client, srv, "alice")
+
+	// Недопустимый тег возвращается в форму поста
+	_, body = fetch(t, client, http.MethodPost, srv.URL+"/post/create", url.Values{
+		"title":      {"Title"},
+		"content":    {"Content"},
+		"categories": {"1"},
+		"tags":       {xssPayload},
+	})
+	assertEscaped(t, "create post form", body)
+
+	postPath := createTestPost(t, client, srv, db, url.Values{
+		"title":      {xssPayload},
+		"content":    {xssPayload + "\n\n**bold**"},
+		"categories": {"1"},
+	})
+
+	resp, _ := fetch(t, client, http.MethodPost, srv.URL+postPath+"/poll", url.Values{
+		"question": {"Question"},
+		"options":  {xssPayload, "Option"},
+	})
+	if resp.Request.URL.Path != postPath {
+		t.Fatalf("poll creation ended on %s", resp.Request.URL.Path)
+	}
+
+	// Профиль меняется только через базу: формы редактирования профиля нет.
+	// Имя пользователя, категория и тег с разметкой могли остаться
+	// в базе из старых версий, поэтому записываем их напрямую
+	queries := []string{
+		`UPDATE users SET username = '` + xssPayload + `', email = '` + xssPayload + `' WHERE username = 'alice'`,
+		`INSERT INTO categories (name, slug, description) VALUES ('` + xssPayload + `', 'xss', '` + xssPayload + `')`,
+		`INSERT INTO post_categories (post_id, category_id)
+			SELECT MAX(post_id), (SELECT id FROM categories WHERE slug = 'xss') FROM post_categories`,
+		`INSERT INTO tags (name) VALUES ('` + xssPayload + `')`,
+		`INSERT INTO post_tags (post_id, tag_id) SELECT (SELECT MAX(id) FROM posts), id FROM tags`,
+	}
+	for _, query := range queries {
+		if _, err := db.DBConn.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, body = fetch(t, client, http.MethodGet, srv.URL+postPath, nil)
+	assertEscaped(t, "post page", body)
+	for _, part := range []string{"<strong>bold</strong>", "Option"} {
+		if !strings.Contains(body, part) {
+			t.Errorf("post page: %q not found", part)
+		}
+	}
+
+	// Гость видит опрос без формы голосования
+	_, body = fetch(t, newTestClient(t), http.MethodGet, srv.URL+postPath, nil)
+	assertEscaped(t, "post page for guest", body)
+
+	assertPagesEscaped(t, client, srv,
+		"/",
+		"/categories",
+		"/category/xss",
+		"/tag/"+url.PathEscape(xssPayload),
+		"/profile",
+		postPath+"/history",
+	)
+}
+
+// Комментарии создаются через CommentService: HTTP-обработчика
+// для добавления комментария пока нет
+func TestCommentsAreEscaped(t *testing.T) {
+	srv, db := newTestServer(t)
+	client := newTestClient(t)
+	registerTestUser(t, client, srv, "alice")
+
+	postPath := createTestPost(t, client, srv, db, url.Values{
+		"title":      {"Post"},
+		"content":    {"Content"},
+		"categories": {"1"},
+	})
+	postID, err := strconv.Atoi(strings.TrimPrefix(postPath, "/post/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Markdown убирает script из текста комментария, поэтому
+	// экранированный текст ищем в истории правок
+	comment, err := database.NewCommentService(db).CreateComment(xssPayload, postID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, body := fetch(t, client, http.MethodGet, srv.URL+postPath, nil)
+	if strings.Contains(body, xssPayload) {
+		t.Error("post page: comment payload is not escaped")
+	}
+	assertPagesEscaped(t, client, srv, "/comment/"+strconv.Itoa(comment.ID)+"/history")
+}
+
+func TestMessagesAreEscaped(t *testing.T) {
+	srv, _ := newTestServer(t)
+	alice := newTestClient(t)
+	bob := newTestClient(t)
+	registerTestUser(t, alice, srv, "alice")
+	registerTestUser(t, bob, srv, "bob")
+
+	resp, _ := fetch(t, alice, http.MethodPost, srv.URL+"/messages/new", url.Values{
+		"to":      {"bob"},
+		"subject": {xssPayload},
+		"content": {xssPayload},
+	})
+	conversationPath := resp.Request.URL.Path
+	if !strings.HasPrefix(conversationPath, "/messages/") {
+		t.Fatalf("new conversation ended on %s", conversationPath)
+	}
+
+	assertPagesEscaped(t, alice, srv, "/messages", conversationPath)
+	assertPagesEscaped(t, bob, srv, "/messages", conversationPath)
+}
+
+func TestGroupsAreEscaped(t *testing.T) {
+	srv, db := newTestServer(t)
+	client := newTestClient(t)
+	registerTestUser(t, client, srv, "alice")
+
+	if _, err := db.DBConn.Exec(`UPDATE users SET role = 'admin' WHERE username = 'alice'`); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := fetch(t, client, http.MethodPost, srv.URL+"/groups/create", url.Values{
+		"name":        {xssPayload},
+		"slug":        {"xss"},
+		"description": {xssPayload},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("group creation: status %d", resp.StatusCode)
+	}
+
+	assertPagesEscaped(t, client, srv, "/groups", "/group/xss")
+}
+
+func TestBookmarksAreEscaped(t *testing.T) {
+	srv, db := newTestServer(t)
+	client := newTestClient(t)
+	registerTestUser(t, client, srv, "alice")
+
+	postPath := createTestPost(t, client, srv, db, url.Values{
+		"title":      {"Post"},
+		"content":    {"Content"},
+		"categories": {"1"},
+	})
+	fetch(t, client, http.MethodPost, srv.URL+postPath+"/bookmark", nil)
+
+	resp, _ := fetch(t, client, http.MethodPost, srv.URL+"/saved/folders", url.Values{"name": {xssPayload}})
+	folderID := resp.Request.URL.Query().Get("folder")
+	if folderID == "" {
+		t.Fatalf("folder creation ended on %s", resp.Request.URL)
+	}
+
+	fetch(t, client, http.MethodPost, srv.URL+postPath+"/bookmark/edit", url.Values{
+		"folder_id": {folderID},
+		"note":      {xssPayload},
+	})
+
+	assertPagesEscaped(t, client, srv, "/saved", "/saved?folder="+folderID)
+}
+
+func TestDraftsAreEscaped(t *testing.T) {
+	srv, db := newTestServer(t)
+	client := newTestClient(t)
+	registerTestUser(t, client, srv, "alice")
+
+	resp, _ := fetch(t, client, http.MethodPost, srv.URL+"/drafts/autosave", url.Values{
+		"title":   {xssPayload},
+		"content": {xssPayload},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("draft autosave: status %d", resp.StatusCode)
+	}
+
+	var draftID string
+	if err := db.DBConn.QueryRow("SELECT MAX(id) FROM drafts").Scan(&draftID); err != nil {
+		t.Fatal(err)
+	}
+
+	assertPagesEscaped(t, client, srv, "/drafts", "/post/create?draft="+draftID)
+}
+
+func TestJavaScriptLinksAreStripped(t *testing.T) {
+	srv, db := newTestServer(t)
+	client := newTestClient(t)
+	registerTestUser(t, client, srv, "alice")
+
+	content := "[markdown](javascript:alert(1))\n\n" +
+		"[mixed case](JaVaScRiPt:alert(2))\n\n" +
+		`<a href="javascript:alert(3)">html</a>` + "\n\n" +
+		"[safe](https://example.com)"
+	postPath := createTestPost(t, client, srv, db, url.Values{
+		"title":      {"Links"},
+		"content":    {content},
+		"categories": {"1"},
+	})
+
+	_, body := fetch(t, client, http.MethodGet, srv.URL+postPath, nil)
+	if strings.Contains(strings.ToLower(body), "javascript:") {
+		t.Error("javascript: link is not stripped")
+	}
+	if !strings.Contains(body, `href="https://example.com"`) {
+		t.Error("safe link is missing")
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	srv, _ := newTestServer(t)
+	client := newTestClient(t)
+
+	want := map[string]string{
+		"Content-Security-Policy": "default-src 'self'",
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "strict-origin-when-cross-origin",
+	}
+
+	// Заголовки ставятся на все ответы, включая ошибки
+	for _, page := range []string{"/", "/login", "/post/999"} {
+		resp, _ := fetch(t, client, http.MethodGet, srv.URL+page, nil)
+		for header, value := range want {
+			if got := resp.Header.Get(header); !strings.Contains(got, value) {
+				t.Errorf("%s: %s = %q, want %q", page, header, got, value)
+			}
+		}
+	}
+}
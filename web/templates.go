@@ -2,11 +2,15 @@ package web
 
 import (
 	"bytes"
+	"fmt"
+	"forum/internal/database"
+	"forum/internal/diff"
 	"forum/internal/models"
+	"html/template"
 	"log"
 	"net/http"
 	"path/filepath"
-	"text/template"
+	"strings"
 	"time"
 	"unicode"
 )
@@ -21,11 +25,87 @@ type HTMLData struct {
 	Category       *models.Category
 	PostCategories []*models.Category
 	FilterCategory string
+	FilterTag      string
+	Tag            *models.Tag
+	TagCloud       []*models.Tag
 	FormError      string
-	FormData       map[string]string // для хранения введённых значений в форму
+	FormData       map[string]string   // для хранения введённых значений в форму
+	ConflictPost   *models.Post        // актуальная версия поста при конфликте правок
+	PendingEdit    *models.PendingEdit // правка поста, ждущая проверки
+	Attachments    []*models.Attachment
+	Comment        *models.Comment
+	Revisions      []*models.Revision
+	FromRevision   *models.Revision
+	ToRevision     *models.Revision
+	TitleDiff      []diff.Line
+	Diff           []diff.Line
+	DiffTooLarge   bool         // изменения слишком большие для построчного сравнения
+	PollOptions    []string     // значения полей вариантов в форме опроса
+	ProfileUser    *models.User // пользователь, чья страница открыта
+	Subscribed     bool         // подписан ли текущий пользователь на пост, категорию или пользователя
+	DirectOnly     bool         // на странице категории только её посты, без подкатегорий
+
+	// Права категории для формы администратора
+	Permissions []*models.CategoryPermission
+	Roles       []string
+
+	// Группы пользователей
+	Group        *models.Group
+	Groups       []*models.Group
+	GroupMembers []*models.User
+	GroupMember  bool // состоит ли текущий пользователь в открытой группе
+	GroupAudit   []*models.GroupAuditEntry
+
+	// Очередь проверки содержимого
+	ReviewCount   int // для значка в шапке модератора
+	ReviewQueue   []*models.ReviewItem
+	ContentChecks []*models.ContentCheckEntry
+
+	// Уведомления
+	UnreadNotifications  int // для значка в шапке
+	NotificationGroups   []*models.NotificationGroup
+	NotificationSettings []*models.NotificationSetting
+
+	// Закладки
+	Bookmark        *models.Bookmark // закладка текущего пользователя на открытый пост
+	Bookmarks       []*models.Bookmark
+	BookmarkFolders []*models.BookmarkFolder
+	BookmarkFolder  *models.BookmarkFolder // открытая папка (nil - все закладки)
+	Sort            string
+	PrevPage        int // 0, если предыдущей страницы нет
+	NextPage        int // 0, если следующей страницы нет
+
+	// Черновики
+	Draft  *models.Draft // черновик, из которого заполнена форма поста
+	Drafts []*models.Draft
+
+	// Публичная страница пользователя
+	Followers    int // количество подписчиков
+	Following    int // на сколько пользователей он подписан
+	PostCount    int
+	CommentCount int
+	Comments     []*models.Comment
+	LikedPosts   []*models.Post // nil, если пользователь скрыл свои лайки
+	Badges       []*models.Badge
+	ManualBadges []*models.Badge // ручные значки для формы администратора
+
+	// Лента главной страницы
+	Feed       string // "" - все посты, following - подписки
+	NextCursor string // курсор следующей страницы ("" - страниц больше нет)
+	FirstPage  bool
+
+	// Личные сообщения
+	UnreadMessages int // для значка в шапке
+	Conversation   *models.Conversation
+	Conversations  []*models.Conversation
+	Messages       []*models.Message
+	BlockedUsers   []*models.User
+	Blocked        bool // заблокировал ли текущий пользователь открытого пользователя
+	Archived       bool // открыт архив переписок
 }
 
 var functions = template.FuncMap{
+	"badgeName": database.BadgeName,
 	"cap": func(str string) string {
 		if str == "" {
 			return ""
@@ -40,6 +120,44 @@ var functions = template.FuncMap{
 		}
 		return t.Format("02 Jan 2006, 15:04")
 	},
+	// datetimeLocal форматирует время для значения поля datetime-local
+	"datetimeLocal": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Local().Format(datetimeLocalLayout)
+	},
+	// srcset строит список вариантов изображения для атрибута srcset
+	"srcset": func(attachment *models.Attachment) template.Srcset {
+		var parts []string
+		for _, variant := range attachment.Variants {
+			parts = append(parts, fmt.Sprintf("/uploads/%s %dw", variant.Hash, variant.Width))
+		}
+		return template.Srcset(strings.Join(parts, ", "))
+	},
+	// thumbnail возвращает хеш самого маленького варианта изображения
+	"thumbnail": func(attachment *models.Attachment) string {
+		if len(attachment.Variants) > 0 {
+			return attachment.Variants[0].Hash
+		}
+		return attachment.Hash
+	},
+	// tagLevel возвращает размер тега в облаке от 1 до 5 относительно самого популярного
+	"tagLevel": func(count int, cloud []*models.Tag) int {
+		max := 1
+		for _, tag := range cloud {
+			if tag.Count > max {
+				max = tag.Count
+			}
+		}
+		return 1 + count*4/max
+	},
+	"avatarURL": avatarURL,
+	// sanitizedHTML помечает HTML как безопасный. Использовать только для
+	// содержимого, прошедшего через markdown.Render (санитайзер)
+	"sanitizedHTML": func(s string) template.HTML {
+		return template.HTML(s)
+	},
 }
 
 func (app *app) RenderHTML(w http.ResponseWriter, r *http.Request, pageFile string, data *HTMLData) {
@@ -54,6 +172,29 @@ func (app *app) RenderHTML(w http.ResponseWriter, r *http.Request, pageFile stri
 		data.CurrentUser = app.getCurrentUser(r)
 	}
 
+	// Количество непрочитанных уведомлений и сообщений для шапки
+	if data.CurrentUser != nil {
+		unread, err := app.NotificationService.CountUnread(data.CurrentUser.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to count notifications of user %d: %v", data.CurrentUser.ID, err)
+		}
+		data.UnreadNotifications = unread
+
+		unreadMessages, err := app.MessageService.CountUnread(data.CurrentUser.ID)
+		if err != nil {
+			app.errorLog.Printf("Failed to count messages of user %d: %v", data.CurrentUser.ID, err)
+		}
+		data.UnreadMessages = unreadMessages
+
+		if data.CurrentUser.IsModerator() {
+			reviewCount, err := app.ReviewService.CountQueue()
+			if err != nil {
+				app.errorLog.Printf("Failed to count review queue: %v", err)
+			}
+			data.ReviewCount = reviewCount
+		}
+	}
+
 	layoutFile := "base.layout.html"
 
 	files := []string{
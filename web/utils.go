@@ -57,6 +57,14 @@ func (app *app) getCurrentUser(r *http.Request) *models.User {
 	return user
 }
 
+// currentUserID возвращает ID текущего пользователя или 0 для гостя
+func (app *app) currentUserID(r *http.Request) int {
+	if user := app.getCurrentUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
 // isAuthenticated проверяет, авторизован ли пользователь
 func (app *app) isAuthenticated(r *http.Request) bool {
 	return app.getCurrentUser(r) != nil